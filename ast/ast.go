@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"strconv"
 )
 
@@ -19,10 +20,33 @@ const (
 	BinopNameNodeType
 )
 
+// Pos is a position in the source code.
+type Pos struct {
+	Offset int // offset in runes, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in runes, starting at 1
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// A Comment is a '#' comment. Its text doesn't include the '#' nor the
+// trailing newline.
+type Comment struct {
+	Text     string
+	Pos, End Pos
+}
+
 type Node struct {
 	children []*Node
 	name     string
 	nodeType NodeType
+
+	pos, end Pos
+
+	// comments are only set on the root node
+	comments []Comment
 }
 
 func NewNode(nodeType NodeType, name string) *Node {
@@ -42,6 +66,25 @@ func (n *Node) Value() (v int64) {
 	return
 }
 
+// Pos returns the position of the first character of the node.
+func (n *Node) Pos() Pos { return n.pos }
+
+// End returns the position immediately after the node.
+func (n *Node) End() Pos { return n.end }
+
+func (n *Node) SetPos(pos, end Pos) {
+	n.pos = pos
+	n.end = end
+}
+
+// Comments returns the comments of the program, in source order. It's always
+// empty for non-root nodes.
+func (n *Node) Comments() []Comment { return n.comments }
+
+func (n *Node) AddComment(c Comment) {
+	n.comments = append(n.comments, c)
+}
+
 func (n1 *Node) AddChild(n2 *Node) {
 	n1.children = append(n1.children, n2)
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+)
+
+var buildCommand = &command{
+	name:        "build",
+	args:        "[-debug] [-O] [-bytecode] [-emit llvm] [-o output] <file>",
+	description: "Compile a program to bytecode or LLVM IR",
+	run:         buildMain,
+}
+
+func buildMain(cmd *command, args []string) int {
+	var output, emit string
+	var bytecode bool
+	var opts compileOptions
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&opts.debug, "debug", false, "debug")
+	opts.optimizeFlag(flags)
+	flags.StringVar(&output, "o", "", "output file; defaults to <file>"+bytecodeExt+" with -bytecode, and <file>"+llvmExt+" with -emit=llvm")
+	flags.BoolVar(&bytecode, "bytecode", false, "compile to bytecode, which 'quinoa run' can load")
+	flags.StringVar(&emit, "emit", "", "emit 'llvm' IR, to compile with llc and link with runtime/quinoa.c")
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() != 1 {
+		return cmd.usageError("expected one source file")
+	}
+	if emit != "" && emit != "llvm" {
+		return cmd.usageError("unknown output '%s'", emit)
+	}
+	if emit != "" && bytecode {
+		return cmd.usageError("-bytecode and -emit are exclusive")
+	}
+	if emit == "" && !bytecode {
+		// there's no native backend yet
+		return cmd.usageError("expected -bytecode or -emit=llvm")
+	}
+
+	filename := flags.Arg(0)
+
+	gs, err := compileFile(filename, opts)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	if bytecode {
+		if output == "" {
+			output = outputFilename(filename, bytecodeExt)
+		}
+
+		if err := ioutil.WriteFile(output, language.MarshalBytecode(gs), 0644); err != nil {
+			return fail(output, err)
+		}
+		return exitOK
+	}
+
+	if output == "" {
+		output = outputFilename(filename, llvmExt)
+	}
+
+	ir, err := compileLLVM(gs, filename)
+	if err != nil {
+		return fail(filename, err)
+	}
+	if err := ioutil.WriteFile(output, ir, 0644); err != nil {
+		return fail(output, err)
+	}
+	return exitOK
+}
+
+// compileLLVM compiles grains to LLVM IR.
+func compileLLVM(gs language.Grains, filename string) ([]byte, error) {
+	f, err := compiler.Lift(gs)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.LLVM(f, filepath.Base(filename))
+}
+
+// extensions of compiled programs and of LLVM IR
+const (
+	bytecodeExt = ".qbc"
+	llvmExt     = ".ll"
+)
+
+// outputFilename returns the default name of a compiled program, with an
+// extension
+func outputFilename(filename, ext string) string {
+	if filename == "-" {
+		return "a" + ext
+	}
+
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ext
+}
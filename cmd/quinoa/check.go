@@ -0,0 +1,31 @@
+package main
+
+var checkCommand = &command{
+	name:        "check",
+	args:        "[-debug] <file> [file ...]",
+	description: "Parse and compile programs without running them",
+	run:         checkMain,
+}
+
+func checkMain(cmd *command, args []string) int {
+	var debug bool
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&debug, "debug", false, "debug")
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() < 1 {
+		return cmd.usageError("missing source file")
+	}
+
+	status := exitOK
+	for _, filename := range flags.Args() {
+		if _, err := compileFile(filename, compileOptions{debug: debug}); err != nil {
+			status = fail(filename, err)
+		}
+	}
+	return status
+}
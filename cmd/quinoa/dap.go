@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bfontaine/quinoa/dap"
+	"github.com/bfontaine/quinoa/language"
+)
+
+var dapCommand = &command{
+	name:        "dap",
+	args:        "",
+	description: "Serve the Debug Adapter Protocol on the standard streams",
+	run:         dapMain,
+}
+
+func dapMain(cmd *command, args []string) int {
+	flags := cmd.flagSet()
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() > 0 {
+		return cmd.usageError("unexpected arguments")
+	}
+
+	server := dap.NewServer(os.Stdin, os.Stdout)
+	server.Compile = func(filename string, code []byte) (language.Grains, error) {
+		return compileSource(filename, code, compileOptions{})
+	}
+
+	if err := server.Serve(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
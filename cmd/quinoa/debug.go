@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/bfontaine/quinoa/debugger"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+var debugCommand = &command{
+	name:        "debug",
+	args:        "[-break line]... [-allow-...] <file> [arguments]",
+	description: "Run a program step by step in an interactive debugger",
+	run:         debugMain,
+}
+
+func debugMain(cmd *command, args []string) int {
+	var breakpoints stringList
+
+	flags := cmd.flagSet()
+	flags.Var(&breakpoints, "break", "set a breakpoint on a line (repeatable)")
+	caps := capabilityFlags(flags)
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() < 1 {
+		return cmd.usageError("missing source file")
+	}
+
+	filename := flags.Arg(0)
+	if filename == "-" {
+		return cmd.usageError("the standard input is used for the commands")
+	}
+
+	code, err := readSource(filename)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	gs, err := compileSource(filename, code, compileOptions{})
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	if isAssembly(filename) || language.IsBytecode(code) {
+		// the lines don't refer to this file
+		code = nil
+	}
+
+	// the program and the debugger share the standard input
+	stdin := bufio.NewReader(os.Stdin)
+
+	machine := vm.NewVM(false)
+	machine.Args = flags.Args()[1:]
+	machine.Stdin = stdin
+	caps.allow(machine)
+
+	d := debugger.New(machine, code, debugger.NewConsole(stdin, os.Stdout))
+	d.StopOnEntry = true
+	d.Load(gs)
+
+	for _, b := range breakpoints {
+		line, err := strconv.Atoi(b)
+		if err != nil {
+			return cmd.usageError("invalid breakpoint line %q", b)
+		}
+		if err := d.SetBreakpoint(line); err != nil {
+			return fail(filename, err)
+		}
+	}
+
+	if err := machine.Run(gs); err != nil {
+		if errors.Is(err, debugger.ErrAborted) {
+			fmt.Println("Program aborted.")
+			return exitError
+		}
+		return fail(filename, err)
+	}
+
+	fmt.Println("Program exited normally.")
+	return exitOK
+}
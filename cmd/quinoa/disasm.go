@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+var disasmCommand = &command{
+	name:        "disasm",
+	args:        "[-debug] [-O] <file>",
+	description: "Print the grains a program compiles to, in the assembly format",
+	run:         disasmMain,
+}
+
+func disasmMain(cmd *command, args []string) int {
+	var opts compileOptions
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&opts.debug, "debug", false, "debug")
+	opts.optimizeFlag(flags)
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() != 1 {
+		return cmd.usageError("expected one source file")
+	}
+
+	filename := flags.Arg(0)
+
+	code, err := readSource(filename)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	gs, err := compileSource(filename, code, opts)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	if isAssembly(filename) || language.IsBytecode(code) {
+		// the lines don't refer to this file
+		code = nil
+	}
+
+	fmt.Print(language.Disassemble(gs, code))
+
+	return exitOK
+}
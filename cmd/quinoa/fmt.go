@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/bfontaine/quinoa/format"
+)
+
+var fmtCommand = &command{
+	name:        "fmt",
+	args:        "[-w | -d] [file ...]",
+	description: "Format programs; without files, format the standard input",
+	run:         fmtMain,
+}
+
+func fmtMain(cmd *command, args []string) int {
+	var write, diff bool
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&write, "w", false, "write result to (source) file instead of stdout")
+	flags.BoolVar(&diff, "d", false, "display diffs instead of rewriting files")
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	filenames := flags.Args()
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
+
+	status := exitOK
+	for _, filename := range filenames {
+		if write && filename == "-" {
+			return cmd.usageError("cannot use -w with standard input")
+		}
+
+		if err := formatFile(filename, write, diff); err != nil {
+			status = fail(filename, err)
+		}
+	}
+	return status
+}
+
+func formatFile(filename string, write, diff bool) error {
+	code, err := readSource(filename)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(code)
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		name := filename
+		if name == "-" {
+			name = "<standard input>"
+		}
+		os.Stdout.Write(format.Diff(name+".orig", name, code, formatted))
+	}
+
+	if write {
+		if bytes.Equal(code, formatted) {
+			return nil
+		}
+		return ioutil.WriteFile(filename, formatted, 0644)
+	}
+
+	if !diff {
+		os.Stdout.Write(formatted)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bfontaine/quinoa/lsp"
+)
+
+var lspCommand = &command{
+	name:        "lsp",
+	args:        "",
+	description: "Serve the Language Server Protocol on the standard streams",
+	run:         lspMain,
+}
+
+func lspMain(cmd *command, args []string) int {
+	flags := cmd.flagSet()
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() > 0 {
+		return cmd.usageError("unexpected arguments")
+	}
+
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		// the protocol requires this exit code if the client exits without
+		// shutting down the server
+		if err != lsp.ErrNoShutdown {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitError
+	}
+	return exitOK
+}
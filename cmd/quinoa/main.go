@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1 // the script couldn't be compiled or failed
+	exitUsage = 2 // the command was misused
+)
+
+// A command is a 'quinoa <name>' subcommand. run gets the arguments that
+// follow the name, and returns the exit code.
+type command struct {
+	name, args, description string
+	run                     func(cmd *command, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		runCommand,
+		testCommand,
+		buildCommand,
+		checkCommand,
+		fmtCommand,
+		disasmCommand,
+		replCommand,
+		debugCommand,
+		dapCommand,
+		lspCommand,
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: quinoa <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'quinoa <command> -h' for the usage of a command.\n")
+	fmt.Fprintf(os.Stderr, "Source files can be '-' for the standard input.\n")
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		os.Exit(exitOK)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			os.Exit(cmd.run(cmd, os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "quinoa: unknown command '%s'\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// flagSet returns a new flag set for the command.
+func (cmd *command) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: quinoa %s %s\n\n%s.\n", cmd.name, cmd.args, cmd.description)
+		if hasFlags(flags) {
+			fmt.Fprintf(os.Stderr, "\nFlags:\n")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	has := false
+	flags.VisitAll(func(*flag.Flag) { has = true })
+	return has
+}
+
+// parseFlags parses the command-line arguments of a command. It returns an
+// exit code and false if the command must stop.
+func (cmd *command) parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// usageError reports a misuse of the command.
+func (cmd *command) usageError(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "quinoa %s: %s\n", cmd.name, fmt.Sprintf(format, args...))
+	fmt.Fprintf(os.Stderr, "Usage: quinoa %s %s\n", cmd.name, cmd.args)
+	return exitUsage
+}
+
+// fail reports an error about a source file.
+func fail(filename string, err error) int {
+	if filename == "-" {
+		filename = "<standard input>"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", filename, strings.TrimSpace(err.Error()))
+	return exitError
+}
+
+// readSource reads a source file, or the standard input if filename is "-".
+func readSource(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// options of the compilation of programs
+type compileOptions struct {
+	debug    bool
+	optimize bool
+}
+
+// optimizeFlag adds the -O flag to a command.
+func (opts *compileOptions) optimizeFlag(flags *flag.FlagSet) {
+	flags.BoolVar(&opts.optimize, "O", false, "optimize the program")
+}
+
+// compileFile reads and compiles a source file into grains.
+func compileFile(filename string, opts compileOptions) (language.Grains, error) {
+	code, err := readSource(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return compileSource(filename, code, opts)
+}
+
+// compileSource compiles code into grains. Compiled programs are loaded as
+// they are, and files with the assemblyExt extension are assembled. Only
+// programs are optimized.
+func compileSource(filename string, code []byte, opts compileOptions) (language.Grains, error) {
+	if language.IsBytecode(code) {
+		return language.UnmarshalBytecode(code)
+	}
+
+	if isAssembly(filename) {
+		return language.Assemble(string(code))
+	}
+
+	if opts.debug {
+		log.Println("Parsing...")
+	}
+
+	root, err := parser.Parse(string(code), opts.debug)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.debug {
+		log.Printf("Parsed:\n%v", root)
+	}
+
+	if !opts.optimize {
+		return compiler.CompileGrains(root)
+	}
+
+	f, err := compiler.OptimizeSSA(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.debug {
+		log.Printf("Optimized:\n%v", f)
+	}
+
+	gs, err := compiler.Raise(f)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Peephole(gs)
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// extension of files written in the format of 'quinoa disasm'
+const assemblyExt = ".qasm"
+
+func isAssembly(filename string) bool {
+	return strings.HasSuffix(filename, assemblyExt)
+}
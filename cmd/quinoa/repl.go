@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bfontaine/quinoa/repl"
+)
+
+var replCommand = &command{
+	name:        "repl",
+	args:        "[-debug]",
+	description: "Start an interactive session",
+	run:         replMain,
+}
+
+func replMain(cmd *command, args []string) int {
+	var debug bool
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&debug, "debug", false, "debug")
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() > 0 {
+		return cmd.usageError("unexpected arguments")
+	}
+
+	if err := repl.NewREPL(os.Stdin, os.Stdout, debug).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/profiler"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+var runCommand = &command{
+	name:        "run",
+	args:        "[-debug] [-O] [-engine stack|reg] [-max-stack n] [-max-instructions n] [-timeout d] [-max-heap bytes] [-profile file] [-allow-... ] <file> [arguments]",
+	description: "Run a program, its assembly or its bytecode in the VM",
+	run:         runMain,
+}
+
+func runMain(cmd *command, args []string) int {
+	var opts compileOptions
+	var maxStack int
+	var maxInstructions int64
+	var timeout time.Duration
+	var maxHeap int64
+	var profile string
+	var engine string
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&opts.debug, "debug", false, "debug")
+	opts.optimizeFlag(flags)
+	flags.StringVar(&engine, "engine", "stack", "execution engine: 'stack' or 'reg' for the register machine")
+	flags.IntVar(&maxStack, "max-stack", vm.DefaultMaxStackSize, "maximum number of values on the stack")
+	flags.Int64Var(&maxInstructions, "max-instructions", 0, "maximum number of instructions to execute (0 for no limit)")
+	flags.DurationVar(&timeout, "timeout", 0, "maximum duration of the run, e.g. 10s (0 for no limit)")
+	flags.Int64Var(&maxHeap, "max-heap", 0, "maximum size in bytes of the values held by the program (0 for no limit)")
+	flags.StringVar(&profile, "profile", "", "write a profile for 'go tool pprof' to a file, and a report on the standard error")
+	caps := capabilityFlags(flags)
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if flags.NArg() < 1 {
+		return cmd.usageError("missing source file")
+	}
+
+	if engine != "stack" && engine != "reg" {
+		return cmd.usageError("unknown engine '%s'", engine)
+	}
+	if engine == "reg" && profile != "" {
+		return cmd.usageError("the register machine can't be profiled")
+	}
+
+	filename := flags.Arg(0)
+
+	code, err := readSource(filename)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	gs, err := compileSource(filename, code, opts)
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	machine := vm.NewVM(opts.debug)
+	machine.Args = flags.Args()[1:]
+	machine.MaxStackSize = maxStack
+	machine.MaxInstructions = maxInstructions
+	machine.MaxDuration = timeout
+	machine.MaxHeapSize = maxHeap
+	caps.allow(machine)
+
+	// stop the program cleanly on ^C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var prof *profiler.Profiler
+	if profile != "" {
+		if isAssembly(filename) || language.IsBytecode(code) {
+			// the lines don't refer to this file
+			code = nil
+		}
+		prof = profiler.New(gs, code)
+		machine.Hook = prof
+	}
+
+	if engine == "reg" {
+		rc, cerr := compileRegisters(gs)
+		if cerr != nil {
+			return fail(filename, cerr)
+		}
+		err = machine.RunRegistersContext(ctx, rc)
+	} else {
+		err = machine.RunContext(ctx, gs)
+	}
+
+	if prof != nil {
+		// the partial profile of a failed run is still useful
+		prof.Stop()
+		if perr := writeProfile(prof, profile, filename); perr != nil {
+			fail(profile, perr)
+			if err == nil {
+				return exitError
+			}
+		}
+	}
+
+	if err != nil {
+		return fail(filename, err)
+	}
+
+	return exitOK
+}
+
+// compileRegisters compiles grains for the register machine.
+func compileRegisters(gs language.Grains) (*language.RegCode, error) {
+	f, err := compiler.Lift(gs)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.CompileRegisters(f)
+}
+
+// writeProfile writes the pprof profile to a file, and the report on the
+// standard error.
+func writeProfile(prof *profiler.Profiler, profile, filename string) error {
+	f, err := os.Create(profile)
+	if err != nil {
+		return err
+	}
+
+	if err := prof.WritePprof(f, filename); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return prof.WriteReport(os.Stderr)
+}
+
+// capabilities allowed by command-line flags
+type capabilities struct {
+	read, write           stringList
+	env, clock, exec, all bool
+}
+
+func capabilityFlags(flags *flag.FlagSet) *capabilities {
+	caps := &capabilities{}
+	flags.Var(&caps.read, "allow-read", "allow the program to read files in a directory (repeatable)")
+	flags.Var(&caps.write, "allow-write", "allow the program to write files in a directory (repeatable)")
+	flags.BoolVar(&caps.env, "allow-env", false, "allow the program to read environment variables")
+	flags.BoolVar(&caps.clock, "allow-clock", false, "allow the program to read the clock")
+	flags.BoolVar(&caps.exec, "allow-exec", false, "allow the program to run commands")
+	flags.BoolVar(&caps.all, "allow-all", false, "allow everything")
+	return caps
+}
+
+func (caps *capabilities) allow(machine *vm.VM) {
+	if caps.all {
+		for _, c := range []vm.Capability{vm.CapFSRead, vm.CapFSWrite, vm.CapEnv, vm.CapClock, vm.CapExec} {
+			machine.Allow(c)
+		}
+		return
+	}
+
+	if len(caps.read) > 0 {
+		machine.Allow(vm.CapFSRead, caps.read...)
+	}
+	if len(caps.write) > 0 {
+		machine.Allow(vm.CapFSWrite, caps.write...)
+	}
+	if caps.env {
+		machine.Allow(vm.CapEnv)
+	}
+	if caps.clock {
+		machine.Allow(vm.CapClock)
+	}
+	if caps.exec {
+		machine.Allow(vm.CapExec)
+	}
+}
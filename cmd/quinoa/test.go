@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bfontaine/quinoa/coverage"
+	"github.com/bfontaine/quinoa/tester"
+)
+
+var testCommand = &command{
+	name:        "test",
+	args:        "[-v] [-format text|tap|junit] [-cover] [-coverprofile file] [-coverhtml file] [-allow-... ] [file or directory ...]",
+	description: "Run the tests of programs; without arguments, the tests of the current directory",
+	run:         testMain,
+}
+
+// suffix of the test files found in directories
+const testSuffix = "_test.qi"
+
+func testMain(cmd *command, args []string) int {
+	var cover, verbose bool
+	var coverProfile, coverHTML, outputFormat string
+
+	flags := cmd.flagSet()
+	flags.BoolVar(&verbose, "v", false, "list all the tests, and show their output")
+	flags.StringVar(&outputFormat, "format", "text", "format of the results: text, tap or junit")
+	flags.BoolVar(&cover, "cover", false, "measure the coverage of the tests")
+	flags.StringVar(&coverProfile, "coverprofile", "coverage.lcov", "with -cover, write the coverage in the lcov format to a file")
+	flags.StringVar(&coverHTML, "coverhtml", "coverage.html", "with -cover, write an HTML report of the coverage to a file")
+	caps := capabilityFlags(flags)
+
+	if code, ok := cmd.parseFlags(flags, args); !ok {
+		return code
+	}
+
+	var write func(io.Writer, []*tester.Result) error
+	switch outputFormat {
+	case "text":
+		write = func(w io.Writer, results []*tester.Result) error {
+			return tester.WriteText(w, results, verbose)
+		}
+	case "tap":
+		write = tester.WriteTAP
+	case "junit":
+		write = tester.WriteJUnit
+	default:
+		return cmd.usageError("unknown format '%s'", outputFormat)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	filenames, err := findTests(paths)
+	if err != nil {
+		return fail("quinoa test", err)
+	}
+	if len(filenames) == 0 {
+		fmt.Fprintf(os.Stderr, "quinoa test: no test files\n")
+		return exitOK
+	}
+
+	runner := &tester.Runner{Configure: caps.allow}
+	if cover {
+		runner.Coverage = coverage.NewProfile()
+	}
+
+	var results []*tester.Result
+	for _, filename := range filenames {
+		source, err := readSource(filename)
+		if err != nil {
+			return fail(filename, err)
+		}
+		results = append(results, runner.RunFile(filename, source)...)
+	}
+
+	if err := write(os.Stdout, results); err != nil {
+		return fail("quinoa test", err)
+	}
+
+	if runner.Coverage != nil {
+		// keep the other formats parsable
+		out := os.Stderr
+		if outputFormat == "text" {
+			out = os.Stdout
+		}
+		fmt.Fprintf(out, "coverage: %.1f%% of lines\n", runner.Coverage.Percent())
+
+		if err := writeCoverage(runner.Coverage, coverProfile, coverHTML); err != nil {
+			return fail("quinoa test", err)
+		}
+	}
+
+	if _, failed := tester.Summary(results); failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// findTests returns the test files of paths. Files are test files as they are;
+// directories are searched recursively for files named *_test.qi.
+func findTests(paths []string) ([]string, error) {
+	var filenames []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, path)
+			continue
+		}
+
+		var found []string
+		err = filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.HasSuffix(name, testSuffix) {
+				found = append(found, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		filenames = append(filenames, found...)
+	}
+
+	return filenames, nil
+}
+
+// writeCoverage writes the coverage in the lcov format and as HTML.
+func writeCoverage(profile *coverage.Profile, lcov, html string) error {
+	for _, out := range []struct {
+		filename string
+		write    func(*os.File) error
+	}{
+		{lcov, func(f *os.File) error { return profile.WriteLcov(f) }},
+		{html, func(f *os.File) error { return profile.WriteHTML(f) }},
+	} {
+		f, err := os.Create(out.filename)
+		if err != nil {
+			return err
+		}
+		if err := out.write(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
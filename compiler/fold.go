@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"strconv"
+
+	"github.com/bfontaine/quinoa/ast"
+)
+
+// Fold returns a copy of a program where the additions of constants are
+// computed, unary pluses are removed, and x + 0 and 0 + x are replaced by x
+// when x is an int. The program fails the same way as the original one:
+// adding 0 to a value that isn't an int fails, so it's kept in that case.
+//
+// Statements run in order, so the variables set to an int by the previous
+// statements are known to be ints. The others can be set by the host or the
+// previous runs of the VM, and can have any type.
+func Fold(root *ast.Node) *ast.Node {
+	f := &folder{ints: make(map[string]bool)}
+
+	folded := copyNode(root)
+	for _, stmt := range root.Children() {
+		folded.AddChild(f.statement(stmt))
+	}
+	return folded
+}
+
+type folder struct {
+	// variables that are known to hold an int
+	ints map[string]bool
+}
+
+func (f *folder) statement(n *ast.Node) *ast.Node {
+	if n.Type() != ast.AssignNodeType {
+		return f.expr(n)
+	}
+
+	variable, expr := n.Child(), f.expr(n.SecondChild())
+	f.ints[variable.Name()] = f.isInt(expr)
+
+	assign := copyNode(n)
+	assign.AddChild(copyNode(variable))
+	assign.AddChild(expr)
+	return assign
+}
+
+// expr returns the folded copy of an expression.
+func (f *folder) expr(n *ast.Node) *ast.Node {
+	switch n.Type() {
+	case ast.UnopNodeType:
+		// +x is x, whatever its type
+		return f.expr(n.Child())
+
+	case ast.BinopNodeType:
+		left, right := f.expr(n.Child()), f.expr(n.SecondChild())
+
+		switch {
+		case isLitteral(left) && isLitteral(right):
+			// ints wrap around like in the VM
+			return litteral(left.Value()+right.Value(), n)
+		case isZero(right) && f.isInt(left):
+			return left
+		case isZero(left) && f.isInt(right):
+			return right
+		}
+
+		binop := copyNode(n)
+		binop.AddChild(left)
+		binop.AddChild(right)
+		return binop
+
+	case ast.FuncCallNodeType:
+		call := copyNode(n)
+		for _, arg := range n.Children() {
+			call.AddChild(f.expr(arg))
+		}
+		return call
+	}
+
+	return copyNode(n)
+}
+
+// isInt tests if an expression is known to be an int.
+func (f *folder) isInt(n *ast.Node) bool {
+	switch n.Type() {
+	case ast.LitteralNodeType:
+		return true
+	case ast.VariableNodeType:
+		return f.ints[n.Name()]
+	case ast.BinopNodeType:
+		return f.isInt(n.Child()) && f.isInt(n.SecondChild())
+	}
+	return false
+}
+
+func isLitteral(n *ast.Node) bool {
+	return n.Type() == ast.LitteralNodeType
+}
+
+func isZero(n *ast.Node) bool {
+	return isLitteral(n) && n.Value() == 0
+}
+
+// copyNode returns a copy of a node without its children.
+func copyNode(n *ast.Node) *ast.Node {
+	c := ast.NewNode(n.Type(), n.Name())
+	c.SetPos(n.Pos(), n.End())
+	for _, comment := range n.Comments() {
+		c.AddComment(comment)
+	}
+	return c
+}
+
+// litteral returns a litteral at the position of the expression it replaces.
+func litteral(v int64, at *ast.Node) *ast.Node {
+	n := ast.NewNode(ast.LitteralNodeType, strconv.FormatInt(v, 10))
+	n.SetPos(at.Pos(), at.End())
+	return n
+}
@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/bfontaine/quinoa/format"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFold(t *testing.T) {
+	for src, expected := range map[string]string{
+		"x = 1 + 2 + 3\n":          "x = 6\n",
+		"x = +1 + +(+2)\n":         "x = 3\n",
+		"print(+a, 1 + (2 + 3))\n": "print(a, 6)\n",
+		"x = a + 1 + 2\n":          "x = a + 3\n",
+		// the order of the additions is kept: a could be a float
+		"x = 1 + 2 + a\n": "x = 1 + 2 + a\n",
+		// ints wrap around
+		"x = 9223372036854775807 + 1\n": "x = -9223372036854775808\n",
+
+		// a could be a string, so a + 0 can fail
+		"x = a + 0\n":                         "x = a + 0\n",
+		"a = 1\nx = a + 0\ny = 0 + (a + a)\n": "a = 1\nx = a\ny = a + a\n",
+		"a = 1\nb = a + 0\nc = b + 0\n":       "a = 1\nb = a\nc = b\n",
+		"a = arg(0)\nx = a + 0\n":             "a = arg(0)\nx = a + 0\n",
+		// until a is set to something else
+		"a = 1\na = input()\nx = a + 0\n": "a = 1\na = input()\nx = a + 0\n",
+	} {
+		root, err := parser.Parse(src, false)
+		if !assert.Nil(t, err, src) {
+			continue
+		}
+		assert.Equal(t, expected, string(format.Node(Fold(root))), src)
+	}
+}
+
+func TestFoldKeepsTheOriginal(t *testing.T) {
+	src := "# comment\nx = 1 + 2\n"
+	root, err := parser.Parse(src, false)
+	assert.Nil(t, err)
+
+	folded := Fold(root)
+	assert.Equal(t, "# comment\nx = 3\n", string(format.Node(folded)))
+	assert.Equal(t, src, string(format.Node(root)))
+}
+
+func TestFoldGrains(t *testing.T) {
+	root, err := parser.Parse("x = 1 + 2 + 3\n", false)
+	assert.Nil(t, err)
+
+	gs, err := CompileGrains(Fold(root))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(gs))
+	assert.Equal(t, int64(6), gs[0].Value)
+	assert.Equal(t, 1, gs[0].Line)
+}
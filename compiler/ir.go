@@ -1,7 +0,0 @@
-package compiler
-
-// import "llvm.org/llvm/bindings/go/llvm"
-
-//type IR struct {
-//	mod llvm.Module
-//}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// Lift returns the SSA form of grains, which can come from a program, an
+// assembly file or bytecode. The values on the stack at the end are dropped.
+//
+// Like in Lower, the loads of a variable after a store use the stored value.
+func Lift(gs language.Grains) (*Func, error) {
+	if _, err := language.Verify(gs); err != nil {
+		return nil, err
+	}
+
+	f := NewFunc()
+	b := f.Entry()
+
+	vars := make(map[string]*Value)
+	load := func(name string, line int) *Value {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		v := b.NewNamed(OpLoad, name, line)
+		vars[name] = v
+		return v
+	}
+	store := func(name string, v *Value, line int) {
+		b.NewNamed(OpStore, name, line, v)
+		vars[name] = v
+	}
+
+	// the grains are verified, so the stack can't underflow
+	var stack []*Value
+	push := func(v *Value) { stack = append(stack, v) }
+	pop := func() *Value {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+
+	for _, g := range gs {
+		switch g.OpCode {
+		case language.ConstOpCode:
+			push(b.NewConst(g.Value, g.Line))
+
+		case language.LoadOpCode:
+			push(load(g.Name, g.Line))
+
+		case language.StoreOpCode:
+			store(g.Name, stack[len(stack)-1], g.Line)
+
+		case language.StorePopOpCode:
+			store(g.Name, pop(), g.Line)
+
+		case language.DiscardOpCode:
+			pop()
+
+		case language.AddOpCode:
+			left, right := pop(), pop()
+			push(b.NewValue(OpAdd, g.Line, left, right))
+
+		case language.AddConstOpCode:
+			left := pop()
+			push(b.NewValue(OpAdd, g.Line, left, b.NewConst(g.Value, g.Line)))
+
+		case language.IncLocalOpCode:
+			v := b.NewValue(OpAdd, g.Line, load(g.Name, g.Line), b.NewConst(g.Value, g.Line))
+			store(g.Name, v, g.Line)
+
+		case language.CallOpCode:
+			args := make([]*Value, g.PopN)
+			for i := range args {
+				args[i] = pop()
+			}
+			push(b.NewNamed(OpCall, g.Name, g.Line, args...))
+
+		default:
+			return nil, fmt.Errorf("Unsupported grain: %s", g)
+		}
+	}
+
+	return f, nil
+}
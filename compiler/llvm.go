@@ -0,0 +1,138 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// functions of the runtime of the LLVM IR, by builtin. They take the number
+// of arguments, then the arguments, and return 0.
+var llvmRuntime = map[string]string{
+	"print":  "quinoa_print",
+	"eprint": "quinoa_eprint",
+}
+
+// LLVM returns the textual LLVM IR of a module whose main function runs a
+// function with a single block. Its calls are calls to the runtime in
+// runtime/quinoa.c, which only has print() and eprint().
+//
+// The only values are then ints, which are i64 that wrap around like in the
+// VM. Variables are 0 until they're assigned, and the values assigned to
+// them are named after them.
+func LLVM(f *Func, name string) ([]byte, error) {
+	if len(f.Blocks) != 1 {
+		return nil, errors.New("Code with branches can't be compiled to LLVM IR yet")
+	}
+	CopyProp(f)
+
+	values := f.Entry().Values
+
+	l := &llvmWriter{names: make(map[*Value]string), taken: make(map[string]bool)}
+	// the label of the block shares the namespace of the values
+	l.taken["%entry"] = true
+
+	// values assigned to variables are named after the first one
+	for _, v := range values {
+		if v.Op != OpStore {
+			continue
+		}
+		if arg := v.Args[0]; (arg.Op == OpAdd || arg.Op == OpCall) && l.names[arg] == "" {
+			l.names[arg] = l.localName(v.Name)
+		}
+	}
+
+	var body bytes.Buffer
+	line := 0
+	for _, v := range values {
+		var inst string
+
+		switch v.Op {
+		case OpConst, OpLoad, OpCopy, OpStore:
+			// they're operands of the instructions
+
+		case OpAdd:
+			inst = fmt.Sprintf("add i64 %s, %s", l.operand(v.Args[0]), l.operand(v.Args[1]))
+
+		case OpCall:
+			fn, ok := llvmRuntime[v.Name]
+			if !ok {
+				return nil, fmt.Errorf("line %d: Function '%s' isn't supported in LLVM IR", v.Line, v.Name)
+			}
+			args := fmt.Sprintf("i64 %d", len(v.Args))
+			for _, arg := range v.Args {
+				args += ", i64 " + l.operand(arg)
+			}
+			inst = fmt.Sprintf("call i64 (i64, ...) @%s(%s)", fn, args)
+
+		default:
+			return nil, fmt.Errorf("Can't compile %s to LLVM IR", v.LongString())
+		}
+
+		if inst == "" {
+			continue
+		}
+
+		if v.Line != line && v.Line > 0 {
+			line = v.Line
+			fmt.Fprintf(&body, "  ; line %d\n", line)
+		}
+
+		// the results of the calls that aren't used are numbered too
+		fmt.Fprintf(&body, "  %s = %s\n", l.name(v), inst)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "; ModuleID = %s\n", strconv.Quote(name))
+	fmt.Fprintf(&b, "source_filename = %s\n\n", strconv.Quote(name))
+	b.WriteString("declare i64 @quinoa_print(i64, ...)\n")
+	b.WriteString("declare i64 @quinoa_eprint(i64, ...)\n\n")
+	b.WriteString("define i32 @main() {\nentry:\n")
+	b.Write(body.Bytes())
+	b.WriteString("  ret i32 0\n}\n")
+
+	return b.Bytes(), nil
+}
+
+type llvmWriter struct {
+	names map[*Value]string
+	taken map[string]bool
+
+	// next number of the unnamed values
+	next int
+}
+
+// localName returns an unused name for a value assigned to a variable: x,
+// then x.1, x.2, etc.
+func (l *llvmWriter) localName(variable string) string {
+	name := "%" + variable
+	for i := 1; l.taken[name]; i++ {
+		name = fmt.Sprintf("%%%s.%d", variable, i)
+	}
+	l.taken[name] = true
+	return name
+}
+
+// name returns the name of the value computed by an instruction. The unnamed
+// ones are numbered in order, like LLVM requires.
+func (l *llvmWriter) name(v *Value) string {
+	if name := l.names[v]; name != "" {
+		return name
+	}
+	name := fmt.Sprintf("%%%d", l.next)
+	l.next++
+	l.names[v] = name
+	return name
+}
+
+func (l *llvmWriter) operand(v *Value) string {
+	switch v.Op {
+	case OpConst:
+		return strconv.FormatInt(v.Const, 10)
+	case OpLoad:
+		// no variable is assigned before the program starts
+		return "0"
+	}
+	return l.name(v)
+}
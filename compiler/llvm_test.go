@@ -0,0 +1,64 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLLVM(t *testing.T) {
+	f, err := Lift(compile(t, "a = 1\nb = +a + x\nprint(b, print())\nb = b + 1\na = b\neprint(a)\n", false))
+	assert.Nil(t, err)
+
+	ir, err := LLVM(f, "foo.qi")
+	assert.Nil(t, err)
+	assert.Equal(t, `; ModuleID = "foo.qi"
+source_filename = "foo.qi"
+
+declare i64 @quinoa_print(i64, ...)
+declare i64 @quinoa_eprint(i64, ...)
+
+define i32 @main() {
+entry:
+  ; line 2
+  %b = add i64 1, 0
+  ; line 3
+  %0 = call i64 (i64, ...) @quinoa_print(i64 0)
+  %1 = call i64 (i64, ...) @quinoa_print(i64 2, i64 %b, i64 %0)
+  ; line 4
+  %b.1 = add i64 %b, 1
+  ; line 6
+  %2 = call i64 (i64, ...) @quinoa_eprint(i64 1, i64 %b.1)
+  ret i32 0
+}
+`, string(ir))
+}
+
+func TestLLVMEntry(t *testing.T) {
+	f, err := Lift(compile(t, "entry = print(1) + 2\nprint(entry)\n", false))
+	assert.Nil(t, err)
+
+	ir, err := LLVM(f, "foo.qi")
+	assert.Nil(t, err)
+	assert.Contains(t, string(ir), `define i32 @main() {
+entry:
+  ; line 1
+  %0 = call i64 (i64, ...) @quinoa_print(i64 1, i64 1)
+  %entry.1 = add i64 %0, 2
+  ; line 2
+  %1 = call i64 (i64, ...) @quinoa_print(i64 1, i64 %entry.1)
+`)
+}
+
+func TestLLVMErrors(t *testing.T) {
+	f, err := Lift(compile(t, "a = 1\nprint(arg(a))\n", false))
+	assert.Nil(t, err)
+	_, err = LLVM(f, "foo.qi")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 2: Function 'arg' isn't supported in LLVM IR", err.Error())
+	}
+
+	f, _ = diamond()
+	_, err = LLVM(f, "foo.qi")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/bfontaine/quinoa/ast"
+)
+
+// Lower returns the SSA form of a program. Programs have no branches, so the
+// function has a single block.
+//
+// A variable is loaded the first time it's read before being assigned; the
+// reads of a variable after an assignment use the assigned value. Values are
+// defined in the order they're computed by the grains of the program.
+func Lower(root *ast.Node) (*Func, error) {
+	l := &lowerer{
+		f:    NewFunc(),
+		vars: make(map[string]*Value),
+	}
+	l.b = l.f.Entry()
+
+	for _, stmt := range root.Children() {
+		if err := l.statement(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return l.f, nil
+}
+
+type lowerer struct {
+	f *Func
+	b *Block
+
+	// current value of the variables
+	vars map[string]*Value
+}
+
+func (l *lowerer) statement(n *ast.Node) error {
+	if n.Type() != ast.AssignNodeType {
+		_, err := l.expr(n)
+		return err
+	}
+
+	name := n.Child().Name()
+	v, err := l.expr(n.SecondChild())
+	if err != nil {
+		return err
+	}
+
+	l.b.NewNamed(OpStore, name, n.Pos().Line, v)
+	l.vars[name] = v
+	return nil
+}
+
+func (l *lowerer) expr(n *ast.Node) (*Value, error) {
+	line := n.Pos().Line
+
+	switch n.Type() {
+	case ast.LitteralNodeType:
+		return l.b.NewConst(n.Value(), line), nil
+
+	case ast.VariableNodeType:
+		if v, ok := l.vars[n.Name()]; ok {
+			return v, nil
+		}
+		v := l.b.NewNamed(OpLoad, n.Name(), line)
+		l.vars[n.Name()] = v
+		return v, nil
+
+	case ast.UnopNodeType:
+		if name := n.Name(); name != "+" {
+			return nil, fmt.Errorf("Unsupported unop: %s", name)
+		}
+		v, err := l.expr(n.Child())
+		if err != nil {
+			return nil, err
+		}
+		return l.b.NewValue(OpCopy, line, v), nil
+
+	case ast.BinopNodeType:
+		if name := n.Name(); name != "+" {
+			return nil, fmt.Errorf("Unsupported binop: %s", name)
+		}
+		// the right operand is computed first, like in the grains
+		right, err := l.expr(n.SecondChild())
+		if err != nil {
+			return nil, err
+		}
+		left, err := l.expr(n.Child())
+		if err != nil {
+			return nil, err
+		}
+		return l.b.NewValue(OpAdd, line, left, right), nil
+
+	case ast.FuncCallNodeType:
+		children := n.Children()
+		args := make([]*Value, len(children))
+		for i := len(children) - 1; i >= 0; i-- {
+			v, err := l.expr(children[i])
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return l.b.NewNamed(OpCall, n.Name(), line, args...), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported node: %s", n)
+}
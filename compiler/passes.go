@@ -0,0 +1,209 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/language"
+)
+
+// Optimize compiles a program with all the optimizations: constant folding,
+// the SSA passes, and the peephole optimizer.
+func Optimize(root *ast.Node) (language.Grains, error) {
+	f, err := OptimizeSSA(root)
+	if err != nil {
+		return nil, err
+	}
+
+	gs, err := Raise(f)
+	if err != nil {
+		return nil, err
+	}
+	return Peephole(gs)
+}
+
+// OptimizeSSA folds the constants of a program, then returns its SSA form
+// optimized by the SSA passes.
+func OptimizeSSA(root *ast.Node) (*Func, error) {
+	f, err := Lower(Fold(root))
+	if err != nil {
+		return nil, err
+	}
+
+	CopyProp(f)
+	ConstProp(f)
+	CSE(f)
+	DCE(f)
+	return f, nil
+}
+
+// CopyProp replaces the uses of copies by the values they copy. Phis whose
+// arguments are all the same value, or the phi itself, are copies of that
+// value.
+func CopyProp(f *Func) {
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for i, arg := range v.Args {
+				v.Args[i] = copied(arg)
+			}
+		}
+	}
+}
+
+// copied returns the value copied by a value, or the value itself.
+func copied(v *Value) *Value {
+	seen := make(map[*Value]bool)
+	for !seen[v] {
+		seen[v] = true
+
+		switch v.Op {
+		case OpCopy:
+			v = v.Args[0]
+		case OpPhi:
+			var src *Value
+			for _, arg := range v.Args {
+				if arg == v || arg == src {
+					continue
+				}
+				if src != nil {
+					return v
+				}
+				src = arg
+			}
+			if src == nil {
+				return v
+			}
+			v = src
+		default:
+			return v
+		}
+	}
+	return v
+}
+
+// ConstProp replaces the additions of constants by their results.
+func ConstProp(f *Func) {
+	post := f.postorder()
+	for i := len(post) - 1; i >= 0; i-- {
+		for _, v := range post[i].Values {
+			if v.Op != OpAdd {
+				continue
+			}
+			left, right := copied(v.Args[0]), copied(v.Args[1])
+			if left.Op == OpConst && right.Op == OpConst {
+				// ints wrap around like in the VM
+				v.Op, v.Const, v.Args = OpConst, left.Const+right.Const, nil
+			}
+		}
+	}
+}
+
+// CSE replaces the values that compute the same thing as a value that
+// dominates them by that value. Only constants and additions of ints are
+// replaced: the other values have effects, or depend on the stores.
+func CSE(f *Func) {
+	idom := f.dominators()
+	seen := make(map[string][]*Value)
+
+	// reverse postorder: the dominators of a block come before it
+	post := f.postorder()
+	for i := len(post) - 1; i >= 0; i-- {
+		for _, v := range post[i].Values {
+			if v.Op != OpConst && (v.Op != OpAdd || hasEffects(v)) {
+				continue
+			}
+
+			key := cseKey(v)
+			found := false
+			for _, w := range seen[key] {
+				if dominates(idom, w.Block, v.Block) {
+					f.replace(v, w)
+					found = true
+					break
+				}
+			}
+			if !found {
+				seen[key] = append(seen[key], v)
+			}
+		}
+	}
+}
+
+func cseKey(v *Value) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d %s", v.Op, v.Const, v.Name)
+	for _, arg := range v.Args {
+		fmt.Fprintf(&b, " %d", arg.ID)
+	}
+	return b.String()
+}
+
+// DCE removes the blocks that can't be reached from the entry, and the values
+// without effects that aren't used.
+func DCE(f *Func) {
+	reachable := make(map[*Block]bool)
+	for _, b := range f.postorder() {
+		reachable[b] = true
+	}
+
+	var blocks []*Block
+	for _, b := range f.Blocks {
+		if !reachable[b] {
+			continue
+		}
+		blocks = append(blocks, b)
+
+		// remove the edges from unreachable blocks, and the phi arguments
+		// that come from them
+		var preds []*Block
+		var kept []int
+		for i, pred := range b.Preds {
+			if reachable[pred] {
+				preds = append(preds, pred)
+				kept = append(kept, i)
+			}
+		}
+		for _, v := range b.Values {
+			if v.Op == OpPhi {
+				args := make([]*Value, len(kept))
+				for j, i := range kept {
+					args[j] = v.Args[i]
+				}
+				v.Args = args
+			}
+		}
+		b.Preds = preds
+	}
+	f.Blocks = blocks
+
+	// mark the values that are used by values with effects
+	live := make(map[*Value]bool)
+	var mark func(v *Value)
+	mark = func(v *Value) {
+		if live[v] {
+			return
+		}
+		live[v] = true
+		for _, arg := range v.Args {
+			mark(arg)
+		}
+	}
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			if hasEffects(v) {
+				mark(v)
+			}
+		}
+	}
+
+	for _, b := range f.Blocks {
+		values := b.Values[:0]
+		for _, v := range b.Values {
+			if live[v] {
+				values = append(values, v)
+			}
+		}
+		b.Values = values
+	}
+}
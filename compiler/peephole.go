@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"github.com/bfontaine/quinoa/language"
+)
+
+// Peephole returns a copy of grains where common sequences are replaced by
+// superinstructions:
+//
+//	CONST k; <x>; ADD        ->  <x>; ADDCONST k    (x + k)
+//	STORE x; DISCARD         ->  STOREPOP x
+//	LOAD x; ADDCONST k; STOREPOP x  ->  INCLOCAL x k  (x = x + k)
+//
+// The operands of additions keep their order, so that the results and the
+// errors are the same.
+func Peephole(gs language.Grains) (language.Grains, error) {
+	gs, err := addConsts(gs)
+	if err != nil {
+		return nil, err
+	}
+	return incLocals(storePops(gs)), nil
+}
+
+// addConsts replaces the additions of constants on the right.
+func addConsts(gs language.Grains) (language.Grains, error) {
+	v, err := language.Verify(gs)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]bool, len(gs))
+	fused := make([]bool, len(gs))
+
+	for pc, g := range gs {
+		if g.OpCode != language.AddOpCode || g.Name != "+" {
+			continue
+		}
+
+		// the left operand is on the top of the stack, and was pushed
+		// after the right one; operands start at the last grain with the
+		// depth before them
+		depth := v.Depths[pc]
+		left := pc - 1
+		for v.Depths[left] != depth-1 {
+			left--
+		}
+		right := left - 1
+		if right < 0 || v.Depths[right] != depth-2 || gs[right].OpCode != language.ConstOpCode {
+			continue
+		}
+
+		removed[right] = true
+		fused[pc] = true
+	}
+
+	out := make(language.Grains, 0, len(gs))
+	var constants []int64
+	for pc, g := range gs {
+		switch {
+		case removed[pc]:
+			constants = append(constants, g.Value)
+			continue
+		case fused[pc]:
+			// the constant of this addition is the last one removed that
+			// isn't used yet
+			k := constants[len(constants)-1]
+			constants = constants[:len(constants)-1]
+			g = language.Grain{OpCode: language.AddConstOpCode, Value: k, PopN: 1, Line: g.Line}
+		}
+		out = append(out, g)
+	}
+
+	return out, nil
+}
+
+// storePops replaces the stores followed by discards.
+func storePops(gs language.Grains) language.Grains {
+	out := make(language.Grains, 0, len(gs))
+	for pc := 0; pc < len(gs); pc++ {
+		g := gs[pc]
+		if g.OpCode == language.StoreOpCode && pc+1 < len(gs) && gs[pc+1].OpCode == language.DiscardOpCode {
+			g.OpCode = language.StorePopOpCode
+			pc++
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// incLocals replaces the increments of variables.
+func incLocals(gs language.Grains) language.Grains {
+	out := make(language.Grains, 0, len(gs))
+	for pc := 0; pc < len(gs); pc++ {
+		g := gs[pc]
+		if pc+2 < len(gs) && g.OpCode == language.LoadOpCode &&
+			gs[pc+1].OpCode == language.AddConstOpCode &&
+			gs[pc+2].OpCode == language.StorePopOpCode && gs[pc+2].Name == g.Name {
+			g = language.Grain{OpCode: language.IncLocalOpCode, Name: g.Name, Value: gs[pc+1].Value, Line: gs[pc+2].Line}
+			pc += 2
+		}
+		out = append(out, g)
+	}
+	return out
+}
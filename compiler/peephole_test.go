@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func compile(t testing.TB, src string, optimize bool) language.Grains {
+	root, err := parser.Parse(src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compile := CompileGrains
+	if optimize {
+		compile = Optimize
+	}
+	gs, err := compile(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
+
+// grains returns grains on a line, separated by semicolons.
+func grains(gs language.Grains) string {
+	var s []string
+	for _, g := range gs {
+		s = append(s, strings.Join(strings.Fields(g.String()), " "))
+	}
+	return strings.Join(s, "; ")
+}
+
+func TestPeephole(t *testing.T) {
+	for _, tc := range []struct{ code, expected string }{
+		{"CONST 1\nSTORE x\nDISCARD", "CONST 1; STOREPOP x"},
+		{"CONST 1\nLOAD x\nADD\nSTORE x\nDISCARD", "INCLOCAL x 1"},
+		{"CONST 1\nLOAD y\nADD\nSTORE x\nDISCARD", "LOAD y; ADDCONST 1; STOREPOP x"},
+		// the constants are paired with their additions in reverse order
+		{"CONST 2\nCONST 1\nLOAD y\nADD\nADD\nSTORE x\nDISCARD", "LOAD y; ADDCONST 1; ADDCONST 2; STOREPOP x"},
+		{"CONST 2\nLOAD z\nLOAD y\nADD\nADD\nSTORE x\nDISCARD", "LOAD z; LOAD y; ADD; ADDCONST 2; STOREPOP x"},
+		{"CONST 2\nCONST 1\nLOAD y\nCALL f/2\nADD\nSTORE x\nDISCARD", "CONST 1; LOAD y; CALL f/2; ADDCONST 2; STOREPOP x"},
+		{"LOAD x\nCONST 2\nADD\nCONST 1\nLOAD x\nADD\nCALL print/2\nDISCARD", "LOAD x; CONST 2; ADD; LOAD x; ADDCONST 1; CALL print/2; DISCARD"},
+		// the constant on the left is kept there
+		{"LOAD x\nCONST 1\nADD\nSTORE x\nDISCARD", "LOAD x; CONST 1; ADD; STOREPOP x"},
+		// the increments store in the variable they load
+		{"CONST 1\nLOAD x\nADD\nSTORE y\nDISCARD", "LOAD x; ADDCONST 1; STOREPOP y"},
+		{"CONST 1\nLOAD x\nADD\nSTORE x\nSTORE y\nDISCARD", "LOAD x; ADDCONST 1; STORE x; STOREPOP y"},
+	} {
+		code, err := language.Assemble(tc.code)
+		if !assert.Nil(t, err, tc.code) {
+			continue
+		}
+		gs, err := Peephole(code)
+		assert.Nil(t, err, tc.code)
+		assert.Equal(t, tc.expected, grains(gs), tc.code)
+	}
+}
+
+func TestPeepholeKeepsTheLines(t *testing.T) {
+	gs := peephole(t, "a = 1\n\nb = a + 2\n")
+	assert.Equal(t, "CONST 1; STOREPOP a; LOAD a; ADDCONST 2; STOREPOP b", grains(gs))
+	for _, g := range gs {
+		assert.NotEqual(t, 2, g.Line, g.String())
+		assert.True(t, g.Line > 0, g.String())
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	for src, expected := range map[string]string{
+		"x = 1\n":                           "CONST 1; STOREPOP x",
+		"x = x + 1\n":                       "INCLOCAL x 1",
+		"x = y + 1\n":                       "LOAD y; ADDCONST 1; STOREPOP x",
+		"x = (y + 1) + 2\n":                 "LOAD y; ADDCONST 1; ADDCONST 2; STOREPOP x",
+		"x = f(y, 1) + 2\n":                 "CONST 1; LOAD y; CALL f/2; ADDCONST 2; STOREPOP x",
+		"x = arg(0)\nx = x + 1\nprint(x)\n": "CONST 0; CALL arg/1; STOREPOP x; INCLOCAL x 1; LOAD x; CALL print/1; DISCARD",
+		// the known values are propagated
+		"x = 1\nx = x + 1\ny = x + 0\n": "CONST 1; STOREPOP x; CONST 2; STOREPOP x; CONST 2; STOREPOP y",
+		"x = arg(0)\nx = x + 0\n":       "CONST 0; CALL arg/1; STOREPOP x; INCLOCAL x 0",
+		"x = 1 + x\n":                   "LOAD x; CONST 1; ADD; STOREPOP x",
+	} {
+		assert.Equal(t, expected, grains(compile(t, src, true)), src)
+	}
+}
+
+// benchmark is a program with the common patterns of the compiled programs:
+// assignments, increments and additions of constants. Its values come from
+// its first argument, so that they're unknown at compile time.
+func benchmark(statements int) string {
+	var b strings.Builder
+	b.WriteString("i = arg(0)\ntotal = arg(0)\n")
+	for n := 0; n < statements; n++ {
+		fmt.Fprintf(&b, "i = i + 1\nx = i + %d\ntotal = total + x\n", n%10)
+	}
+	b.WriteString("print(total)\n")
+	return b.String()
+}
+
+// benchmarkVM returns a VM for the benchmark program.
+func benchmarkVM(out *bytes.Buffer) *vm.VM {
+	machine := vm.NewVM(false)
+	machine.Args = []string{"0"}
+	machine.Stdout = out
+	return machine
+}
+
+// peephole compiles a program then replaces its grains with
+// superinstructions.
+func peephole(t testing.TB, src string) language.Grains {
+	gs, err := Peephole(compile(t, src, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
+
+func benchmarkRun(b *testing.B, code language.Grains) {
+	machine := benchmarkVM(&bytes.Buffer{})
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := machine.Run(code); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B)         { benchmarkRun(b, compile(b, benchmark(1000), false)) }
+func BenchmarkRunPeephole(b *testing.B) { benchmarkRun(b, peephole(b, benchmark(1000))) }
+
+func TestBenchmarkProgram(t *testing.T) {
+	code := peephole(t, benchmark(100))
+
+	// the benchmark measures the superinstructions
+	counts := make(map[language.OpCode]int)
+	for _, g := range code {
+		counts[g.OpCode]++
+	}
+	assert.Equal(t, 100, counts[language.IncLocalOpCode])
+	assert.Equal(t, 100, counts[language.AddConstOpCode])
+
+	// both versions print the same total
+	var outputs []string
+	for _, gs := range []language.Grains{compile(t, benchmark(100), false), code} {
+		var out bytes.Buffer
+		assert.Nil(t, benchmarkVM(&out).Run(gs))
+		outputs = append(outputs, out.String())
+	}
+	assert.Equal(t, outputs[0], outputs[1])
+	assert.Equal(t, "5500\n", outputs[0])
+}
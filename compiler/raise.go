@@ -0,0 +1,195 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// Raise returns the grains of a function. Grains have no jumps, so the
+// function must have a single block.
+//
+// Stores, calls and additions that can fail are computed once, in the order
+// of the block; each one that isn't an operand of another one is a
+// statement. The other values are computed where they're used: constants are
+// pushed, and values held by variables are loaded.
+func Raise(f *Func) (language.Grains, error) {
+	if len(f.Blocks) != 1 {
+		return nil, errors.New("Code with branches can't be raised to grains")
+	}
+	b := f.Entry()
+
+	r := &raiser{
+		held:    make(map[string]*Value),
+		emitted: make(map[*Value]bool),
+	}
+	for _, v := range b.Values {
+		if v.Op == OpLoad && r.held[v.Name] == nil {
+			r.held[v.Name] = v
+		}
+	}
+	initial := make(map[string]*Value, len(r.held))
+	for name, v := range r.held {
+		initial[name] = v
+	}
+
+	// the values with effects that are operands of other ones, which aren't
+	// statements
+	operand := make(map[*Value]bool)
+	for _, v := range b.Values {
+		for _, arg := range v.Args {
+			if !hasEffects(arg) || r.holder(arg) != "" {
+				continue
+			}
+			if operand[arg] {
+				return nil, fmt.Errorf("Can't raise %s: it's used twice", arg)
+			}
+			operand[arg] = true
+		}
+		r.assign(v)
+	}
+	r.held = initial
+
+	for _, v := range b.Values {
+		if !hasEffects(v) || operand[v] {
+			continue
+		}
+
+		if err := r.statement(v); err != nil {
+			return nil, err
+		}
+	}
+
+	// check that the effects stay in order
+	var effects []*Value
+	for _, v := range b.Values {
+		if hasEffects(v) && v.Op != OpCopy {
+			effects = append(effects, v)
+		}
+	}
+	for i, v := range effects {
+		if i >= len(r.effects) || r.effects[i] != v {
+			return nil, fmt.Errorf("Can't raise %s: its effects would be reordered", v)
+		}
+	}
+
+	return r.gs, nil
+}
+
+type raiser struct {
+	gs language.Grains
+
+	// current value of the variables
+	held map[string]*Value
+
+	// values with effects, in the order they're computed
+	effects []*Value
+	emitted map[*Value]bool
+
+	// line of the current statement
+	line int
+}
+
+// lineOf returns the line of the grains of a value used on a line of the
+// current statement: values that come from previous statements are on the
+// line of their use.
+func (r *raiser) lineOf(v *Value, use int) int {
+	if v.Line < r.line {
+		return use
+	}
+	return v.Line
+}
+
+func (r *raiser) assign(v *Value) {
+	if v.Op == OpStore {
+		r.held[v.Name] = v.Args[0]
+	}
+}
+
+// holder returns the first variable, by name, that holds a value, if any.
+func (r *raiser) holder(v *Value) string {
+	var names []string
+	for name, held := range r.held {
+		if held == v {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+func (r *raiser) add(g language.Grain) {
+	r.gs = append(r.gs, g)
+}
+
+func (r *raiser) statement(v *Value) error {
+	r.line = v.Line
+	if v.Op == OpStore {
+		if err := r.value(v.Args[0], v.Line); err != nil {
+			return err
+		}
+		r.effects = append(r.effects, v)
+		r.add(language.Grain{OpCode: language.StoreOpCode, Name: v.Name, PopN: 1, Line: v.Line})
+		r.assign(v)
+	} else if err := r.value(v, v.Line); err != nil {
+		return err
+	}
+
+	r.add(language.Grain{OpCode: language.DiscardOpCode, PopN: 1, Line: v.Line})
+	return nil
+}
+
+// value adds the grains that push a value used on a line.
+func (r *raiser) value(v *Value, use int) error {
+	line := r.lineOf(v, use)
+
+	if v.Op == OpConst {
+		r.add(language.Grain{OpCode: language.ConstOpCode, Value: v.Const, Line: line})
+		return nil
+	}
+	if name := r.holder(v); name != "" {
+		r.add(language.Grain{OpCode: language.LoadOpCode, Name: name, Line: line})
+		return nil
+	}
+	if hasEffects(v) && r.emitted[v] {
+		return fmt.Errorf("Can't raise %s: its value is lost", v)
+	}
+
+	switch v.Op {
+	case OpLoad:
+		return fmt.Errorf("Can't raise %s: %s was assigned", v, v.Name)
+
+	case OpCopy:
+		return r.value(v.Args[0], line)
+
+	case OpAdd:
+		for _, arg := range []*Value{v.Args[1], v.Args[0]} {
+			if err := r.value(arg, line); err != nil {
+				return err
+			}
+		}
+		r.add(language.Grain{OpCode: language.AddOpCode, Name: "+", PopN: 2, Line: line})
+
+	case OpCall:
+		for i := len(v.Args) - 1; i >= 0; i-- {
+			if err := r.value(v.Args[i], line); err != nil {
+				return err
+			}
+		}
+		r.add(language.Grain{OpCode: language.CallOpCode, Name: v.Name, PopN: len(v.Args), Line: line})
+
+	default:
+		return fmt.Errorf("Can't raise %s", v.LongString())
+	}
+
+	if hasEffects(v) {
+		r.emitted[v] = true
+		r.effects = append(r.effects, v)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// CompileRegisters returns the code of the register machine for a function
+// with a single block. It propagates the copies of the function first.
+//
+// Each value gets a register, which is reused once the value is no longer
+// used. The constants that are only added on the right of other values are
+// operands of ADDCONST instructions instead.
+func CompileRegisters(f *Func) (*language.RegCode, error) {
+	if len(f.Blocks) != 1 {
+		return nil, errors.New("Code with branches can't be compiled for the register machine")
+	}
+	CopyProp(f)
+
+	values := f.Entry().Values
+
+	lastUse := make(map[*Value]int)
+	addConst := make(map[*Value]bool)
+	for i, v := range values {
+		if v.Op == OpCopy {
+			// unused after the propagation
+			continue
+		}
+		for j, arg := range v.Args {
+			lastUse[arg] = i
+
+			if arg.Op != OpConst {
+				continue
+			}
+			if _, seen := addConst[arg]; !seen {
+				addConst[arg] = true
+			}
+			if v.Op != OpAdd || j != 1 || v.Args[0] == arg {
+				addConst[arg] = false
+			}
+		}
+	}
+
+	r := &regAllocator{regs: make(map[*Value]int)}
+	code := &language.RegCode{}
+
+	for i, v := range values {
+		inst := language.RegInstr{Line: v.Line}
+
+		switch v.Op {
+		case OpCopy:
+			continue
+
+		case OpConst:
+			if addConst[v] {
+				continue
+			}
+			inst.OpCode = language.RegConstOpCode
+			inst.Value = v.Const
+
+		case OpLoad:
+			inst.OpCode = language.RegLoadOpCode
+			inst.Name = v.Name
+
+		case OpStore:
+			inst.OpCode = language.RegStoreOpCode
+			inst.Name = v.Name
+			inst.Args = r.args(v.Args)
+
+		case OpAdd:
+			if right := v.Args[1]; addConst[right] {
+				inst.OpCode = language.RegAddConstOpCode
+				inst.Value = right.Const
+				inst.Args = r.args(v.Args[:1])
+			} else {
+				inst.OpCode = language.RegAddOpCode
+				inst.Args = r.args(v.Args)
+			}
+
+		case OpCall:
+			inst.OpCode = language.RegCallOpCode
+			inst.Name = v.Name
+			inst.Args = r.args(v.Args)
+
+		default:
+			return nil, fmt.Errorf("Can't compile %s for the register machine", v.LongString())
+		}
+
+		// the registers of the values used for the last time can be the
+		// destination
+		for _, arg := range v.Args {
+			if lastUse[arg] == i {
+				r.free(arg)
+			}
+		}
+
+		if v.Op != OpStore {
+			inst.Dst = r.alloc(v)
+			if _, used := lastUse[v]; !used {
+				r.free(v)
+			}
+		}
+
+		code.Instrs = append(code.Instrs, inst)
+	}
+
+	code.NumRegs = r.n
+	return code, nil
+}
+
+type regAllocator struct {
+	regs map[*Value]int
+	// free registers, the last one is reused first
+	available []int
+	n         int
+}
+
+func (r *regAllocator) alloc(v *Value) int {
+	var reg int
+	if n := len(r.available); n > 0 {
+		reg = r.available[n-1]
+		r.available = r.available[:n-1]
+	} else {
+		reg = r.n
+		r.n++
+	}
+	r.regs[v] = reg
+	return reg
+}
+
+func (r *regAllocator) free(v *Value) {
+	reg, ok := r.regs[v]
+	if !ok {
+		return
+	}
+	delete(r.regs, v)
+	r.available = append(r.available, reg)
+}
+
+func (r *regAllocator) args(vs []*Value) []int {
+	regs := make([]int, len(vs))
+	for i, v := range vs {
+		regs[i] = r.regs[v]
+	}
+	return regs
+}
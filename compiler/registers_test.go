@@ -0,0 +1,138 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func compileRegisters(t testing.TB, gs language.Grains) *language.RegCode {
+	f, err := Lift(gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := CompileRegisters(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLift(t *testing.T) {
+	gs, err := language.Assemble("CONST 1\nLOAD x\nADD\nSTORE x\nDISCARD\nLOAD x\nADDCONST 2\nSTOREPOP y\nINCLOCAL z 3\nLOAD y\nCALL print/1\nDISCARD\nLOAD z")
+	assert.Nil(t, err)
+
+	f, err := Lift(gs)
+	assert.Nil(t, err)
+	assert.Equal(t, `b0:
+  v0 = const 1
+  v1 = load x
+  v2 = add v1, v0
+  store x, v2
+  v4 = const 2
+  v5 = add v2, v4
+  store y, v5
+  v7 = load z
+  v8 = const 3
+  v9 = add v7, v8
+  store z, v9
+  v11 = call print(v5)
+`, f.String())
+
+	_, err = Lift(language.Grains{{OpCode: language.DiscardOpCode}})
+	assert.NotNil(t, err)
+}
+
+func TestCompileRegisters(t *testing.T) {
+	code := compileRegisters(t, compile(t, "a = 1\nb = x + a\nprint(b + 2, +a, 3 + b)\n", false))
+	assert.Equal(t, `0000  r0 = CONST 1
+0001  STORE a, r0
+0002  r1 = LOAD x
+0003  r1 = ADD r1, r0
+0004  STORE b, r1
+0005  r2 = CONST 3
+0006  r2 = ADD r2, r1
+0007  r1 = ADDCONST r1, 2
+0008  r2 = CALL print(r1, r0, r2)
+`, code.String())
+	assert.Equal(t, 3, code.NumRegs)
+	assert.Nil(t, code.Verify())
+
+	f, _ := diamond()
+	_, err := CompileRegisters(f)
+	assert.NotNil(t, err)
+}
+
+var differentialPrograms = []string{
+	"a = 1\nb = a + 2\nprint(a, b, a + b)\n",
+	"print(x + 1, x + 1)\nx = 2\nprint(x + 1)\n",
+	"a = s\ns = 1\nprint(a + s)\n",
+	"a = x\nx = a + 1\nb = x + a\nprint(a, b, x)\n",
+	"print(1)\nb = s + 1\nprint(2)\n",
+	"print(1, s + 1, print(2))\n",
+	"a = print(1)\nb = a\na = 2\nprint(b + a)\n",
+	"a = +(+print(1))\nc = a + 1 + a\n",
+	"x = 1 + 2\nx = x + x\nx = x + x\nprint(x, s + s)\n",
+	"print(argc(), read_line() + s)\n",
+	"x = 9223372036854775807 + x\nprint(x + 1)\n",
+	"print(unknown(1))\n",
+	"print(1, 2\n, 3)\nprint(arg(5))\n",
+}
+
+// runEngines runs grains in both engines, and returns what they print, and
+// their memory.
+func runEngines(t *testing.T, gs language.Grains) (outputs [2]string, memories [2]map[string]vm.Value) {
+	for i := range outputs {
+		machine := vm.NewVM(false)
+		var out bytes.Buffer
+		machine.Stdin = &bytes.Buffer{}
+		machine.Stdout = &out
+		machine.Stderr = &out
+		machine.Set("s", "str")
+
+		var err error
+		if i == 0 {
+			err = machine.Run(gs)
+		} else {
+			err = machine.RunRegisters(compileRegisters(t, gs))
+		}
+		if err != nil {
+			out.WriteString(err.Error())
+		}
+
+		outputs[i] = out.String()
+		memories[i] = make(map[string]vm.Value)
+		for _, name := range machine.Variables() {
+			memories[i][name], _ = machine.Get(name)
+		}
+	}
+	return outputs, memories
+}
+
+func TestRegistersDifferential(t *testing.T) {
+	for _, src := range append(differentialPrograms, benchmark(20)) {
+		for _, optimize := range []bool{false, true} {
+			outputs, memories := runEngines(t, compile(t, src, optimize))
+			assert.Equal(t, outputs[0], outputs[1], src)
+			assert.Equal(t, memories[0], memories[1], src)
+		}
+	}
+}
+
+func benchmarkRegisters(b *testing.B, optimize bool) {
+	code := compileRegisters(b, compile(b, benchmark(1000), optimize))
+	machine := benchmarkVM(&bytes.Buffer{})
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := machine.RunRegisters(code); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunRegisters(b *testing.B)          { benchmarkRegisters(b, false) }
+func BenchmarkRunRegistersOptimized(b *testing.B) { benchmarkRegisters(b, true) }
@@ -0,0 +1,351 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// An Op is the operation of an SSA value.
+type Op int8
+
+const (
+	OpConst Op = iota // Const
+	OpLoad            // the value of the variable Name before the code runs
+	OpCopy            // Args[0]
+	OpPhi             // Args[i] when coming from Block.Preds[i]
+	OpAdd             // Args[0] + Args[1]
+	OpCall            // Name(Args...)
+	OpStore           // Name = Args[0]; it has no value
+)
+
+var opNames = [...]string{
+	OpConst: "const",
+	OpLoad:  "load",
+	OpCopy:  "copy",
+	OpPhi:   "phi",
+	OpAdd:   "add",
+	OpCall:  "call",
+	OpStore: "store",
+}
+
+func (op Op) String() string {
+	if op < 0 || int(op) >= len(opNames) {
+		return fmt.Sprintf("op(%d)", op)
+	}
+	return opNames[op]
+}
+
+// A Value is an instruction of the SSA form. Each value is assigned once, by
+// the instruction that defines it.
+type Value struct {
+	ID    int
+	Op    Op
+	Const int64
+	Name  string
+	Args  []*Value
+
+	Block *Block
+
+	// Line is the line of the source code the value comes from, or 0 if it's
+	// unknown.
+	Line int
+}
+
+func (v *Value) String() string { return fmt.Sprintf("v%d", v.ID) }
+
+// A Block is a basic block: values executed in order, followed by a jump to
+// one of its successors. A block without successors ends the code.
+type Block struct {
+	ID     int
+	Values []*Value
+	Preds  []*Block
+	Succs  []*Block
+
+	Func *Func
+}
+
+func (b *Block) String() string { return fmt.Sprintf("b%d", b.ID) }
+
+// A Func is the control-flow graph of some code. Its first block is its entry.
+type Func struct {
+	Blocks []*Block
+
+	nextValue, nextBlock int
+}
+
+// NewFunc returns a function with an empty entry block.
+func NewFunc() *Func {
+	f := &Func{}
+	f.NewBlock()
+	return f
+}
+
+// Entry returns the entry block of the function.
+func (f *Func) Entry() *Block { return f.Blocks[0] }
+
+// NewBlock adds an empty block to the function.
+func (f *Func) NewBlock() *Block {
+	b := &Block{ID: f.nextBlock, Func: f}
+	f.nextBlock++
+	f.Blocks = append(f.Blocks, b)
+	return b
+}
+
+// AddEdge adds a jump from b to succ. The phis of succ must get an argument
+// for it.
+func (b *Block) AddEdge(succ *Block) {
+	b.Succs = append(b.Succs, succ)
+	succ.Preds = append(succ.Preds, b)
+}
+
+// NewValue adds a value at the end of the block.
+func (b *Block) NewValue(op Op, line int, args ...*Value) *Value {
+	v := &Value{ID: b.Func.nextValue, Op: op, Args: args, Block: b, Line: line}
+	b.Func.nextValue++
+	b.Values = append(b.Values, v)
+	return v
+}
+
+// NewConst adds a constant at the end of the block.
+func (b *Block) NewConst(c int64, line int) *Value {
+	v := b.NewValue(OpConst, line)
+	v.Const = c
+	return v
+}
+
+// NewNamed adds a value with a name (a load, a call or a store) at the end of
+// the block.
+func (b *Block) NewNamed(op Op, name string, line int, args ...*Value) *Value {
+	v := b.NewValue(op, line, args...)
+	v.Name = name
+	return v
+}
+
+// isInt tests if a value is known to be an int.
+func isInt(v *Value) bool {
+	return isIntValue(v, make(map[*Value]bool))
+}
+
+func isIntValue(v *Value, seen map[*Value]bool) bool {
+	if seen[v] {
+		// a loop of phis doesn't bring other values
+		return true
+	}
+	seen[v] = true
+
+	switch v.Op {
+	case OpConst:
+		return true
+	case OpCopy, OpPhi, OpAdd:
+		for _, arg := range v.Args {
+			if !isIntValue(arg, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// hasEffects tests if computing a value does more than giving its result:
+// stores and calls change the state of the VM, and the additions of values
+// that aren't known to be ints can fail.
+func hasEffects(v *Value) bool {
+	switch v.Op {
+	case OpStore, OpCall:
+		return true
+	case OpAdd:
+		return !isInt(v)
+	case OpCopy:
+		return hasEffects(v.Args[0])
+	}
+	return false
+}
+
+// replace replaces the uses of a value by another one.
+func (f *Func) replace(old, new *Value) {
+	for _, b := range f.Blocks {
+		for _, v := range b.Values {
+			for i, arg := range v.Args {
+				if arg == old {
+					v.Args[i] = new
+				}
+			}
+		}
+	}
+}
+
+// postorder returns the blocks reachable from the entry, in postorder.
+func (f *Func) postorder() []*Block {
+	var order []*Block
+	seen := make(map[*Block]bool)
+
+	var visit func(b *Block)
+	visit = func(b *Block) {
+		seen[b] = true
+		for _, succ := range b.Succs {
+			if !seen[succ] {
+				visit(succ)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(f.Entry())
+
+	return order
+}
+
+// dominators returns the immediate dominator of each reachable block; the
+// entry is its own dominator. It uses the algorithm of Cooper, Harvey and
+// Kennedy, "A Simple, Fast Dominance Algorithm".
+func (f *Func) dominators() map[*Block]*Block {
+	post := f.postorder()
+	index := make(map[*Block]int, len(post))
+	for i, b := range post {
+		index[b] = i
+	}
+
+	idom := map[*Block]*Block{f.Entry(): f.Entry()}
+
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for index[a] < index[b] {
+				a = idom[a]
+			}
+			for index[b] < index[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		// reverse postorder, without the entry
+		for i := len(post) - 2; i >= 0; i-- {
+			b := post[i]
+
+			var dom *Block
+			for _, pred := range b.Preds {
+				if idom[pred] == nil {
+					continue
+				}
+				if dom == nil {
+					dom = pred
+				} else {
+					dom = intersect(pred, dom)
+				}
+			}
+
+			if idom[b] != dom {
+				idom[b] = dom
+				changed = true
+			}
+		}
+	}
+
+	return idom
+}
+
+// dominates tests if every path from the entry to b goes through a.
+func dominates(idom map[*Block]*Block, a, b *Block) bool {
+	for {
+		if a == b {
+			return true
+		}
+		dom := idom[b]
+		if dom == nil || dom == b {
+			return false
+		}
+		b = dom
+	}
+}
+
+// String returns a textual dump of the function, such as:
+//
+//	b0:
+//	  v0 = load x
+//	  v1 = const 1
+//	  v2 = add v0, v1
+//	  store x, v2
+//	  v3 = call print(v2)
+func (f *Func) String() string {
+	var b bytes.Buffer
+
+	for _, block := range f.Blocks {
+		fmt.Fprintf(&b, "%s:", block)
+		for i, pred := range block.Preds {
+			sep := ","
+			if i == 0 {
+				sep = " <-"
+			}
+			fmt.Fprintf(&b, "%s %s", sep, pred)
+		}
+		b.WriteByte('\n')
+
+		for _, v := range block.Values {
+			b.WriteString("  ")
+			b.WriteString(v.LongString())
+			b.WriteByte('\n')
+		}
+
+		for i, succ := range block.Succs {
+			sep := ","
+			if i == 0 {
+				sep = "  ->"
+			}
+			fmt.Fprintf(&b, "%s %s", sep, succ)
+		}
+		if len(block.Succs) > 0 {
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String()
+}
+
+// LongString returns the instruction that defines the value.
+func (v *Value) LongString() string {
+	var b bytes.Buffer
+
+	if v.Op != OpStore {
+		fmt.Fprintf(&b, "%s = ", v)
+	}
+	b.WriteString(v.Op.String())
+
+	switch v.Op {
+	case OpConst:
+		fmt.Fprintf(&b, " %d", v.Const)
+	case OpLoad:
+		fmt.Fprintf(&b, " %s", v.Name)
+	case OpStore:
+		fmt.Fprintf(&b, " %s, %s", v.Name, v.Args[0])
+	case OpCall:
+		fmt.Fprintf(&b, " %s(", v.Name)
+		for i, arg := range v.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(arg.String())
+		}
+		b.WriteByte(')')
+	case OpPhi:
+		b.WriteString(" [")
+		for i, arg := range v.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s: %s", v.Block.Preds[i], arg)
+		}
+		b.WriteByte(']')
+	default:
+		for i, arg := range v.Args {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, " %s", arg)
+		}
+	}
+
+	return b.String()
+}
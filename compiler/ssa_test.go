@@ -0,0 +1,273 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func lower(t *testing.T, src string) *Func {
+	root, err := parser.Parse(src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Lower(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestLower(t *testing.T) {
+	f := lower(t, "x = x + 1\ny = +x\nprint(x, y + a)\n")
+	assert.Equal(t, `b0:
+  v0 = const 1
+  v1 = load x
+  v2 = add v1, v0
+  store x, v2
+  v4 = copy v2
+  store y, v4
+  v6 = load a
+  v7 = add v4, v6
+  v8 = call print(v2, v7)
+`, f.String())
+
+	lines := []int{1, 1, 1, 1, 2, 2, 3, 3, 3}
+	for i, v := range f.Entry().Values {
+		assert.Equal(t, lines[i], v.Line, v.LongString())
+	}
+}
+
+// diamond returns the function of:
+//
+//	b0: x = 1; y = input()
+//	if ... b1: z = x + y; else b2: z = y + x
+//	b3: print(z, x + y)
+func diamond() (*Func, map[string]*Value) {
+	f := NewFunc()
+	b0 := f.Entry()
+	b1, b2, b3 := f.NewBlock(), f.NewBlock(), f.NewBlock()
+	b0.AddEdge(b1)
+	b0.AddEdge(b2)
+	b1.AddEdge(b3)
+	b2.AddEdge(b3)
+
+	vs := make(map[string]*Value)
+	vs["x"] = b0.NewConst(1, 1)
+	vs["y"] = b0.NewNamed(OpCall, "input", 1)
+	vs["z1"] = b1.NewValue(OpAdd, 2, vs["x"], vs["y"])
+	vs["z2"] = b2.NewValue(OpAdd, 3, vs["y"], vs["x"])
+	vs["z"] = b3.NewValue(OpPhi, 4, vs["z1"], vs["z2"])
+	vs["sum"] = b3.NewValue(OpAdd, 4, vs["x"], vs["y"])
+	b3.NewNamed(OpCall, "print", 4, vs["z"], vs["sum"])
+	return f, vs
+}
+
+func TestString(t *testing.T) {
+	f, _ := diamond()
+	assert.Equal(t, `b0:
+  v0 = const 1
+  v1 = call input()
+  -> b1, b2
+b1: <- b0
+  v2 = add v0, v1
+  -> b3
+b2: <- b0
+  v3 = add v1, v0
+  -> b3
+b3: <- b1, b2
+  v4 = phi [b1: v2, b2: v3]
+  v5 = add v0, v1
+  v6 = call print(v4, v5)
+`, f.String())
+}
+
+func TestDominators(t *testing.T) {
+	f, _ := diamond()
+	b := f.Blocks
+	idom := f.dominators()
+
+	assert.Equal(t, b[0], idom[b[1]])
+	assert.Equal(t, b[0], idom[b[2]])
+	assert.Equal(t, b[0], idom[b[3]])
+	assert.True(t, dominates(idom, b[0], b[3]))
+	assert.False(t, dominates(idom, b[1], b[3]))
+	assert.True(t, dominates(idom, b[3], b[3]))
+}
+
+func TestCopyProp(t *testing.T) {
+	f := lower(t, "y = +(+x)\nprint(y)\n")
+	CopyProp(f)
+	DCE(f)
+	assert.Equal(t, `b0:
+  v0 = load x
+  store y, v0
+  v4 = call print(v0)
+`, f.String())
+
+	// a phi of a single value is a copy of it
+	f, vs := diamond()
+	vs["z"].Args[1] = vs["z1"]
+	CopyProp(f)
+	assert.Equal(t, vs["z1"], f.Blocks[3].Values[2].Args[0])
+
+	// a phi of a value and of itself too
+	vs["z"].Args[1] = vs["z"]
+	assert.Equal(t, vs["z1"], copied(vs["z"]))
+}
+
+func TestConstProp(t *testing.T) {
+	f := lower(t, "a = 1\nb = +a + 2\nprint(b + x, b + 9223372036854775807)\n")
+	ConstProp(f)
+	DCE(f)
+	assert.Equal(t, `b0:
+  v0 = const 1
+  store a, v0
+  v4 = const 3
+  store b, v4
+  v7 = const -9223372036854775806
+  v8 = load x
+  v9 = add v4, v8
+  v10 = call print(v9, v7)
+`, f.String())
+}
+
+func TestCSE(t *testing.T) {
+	f := lower(t, "print(1 + 2, 1 + 2, x + 1, x + 1)\n")
+	CSE(f)
+	DCE(f)
+	// x + 1 can fail, so both additions are kept
+	assert.Equal(t, `b0:
+  v0 = const 1
+  v1 = load x
+  v2 = add v1, v0
+  v4 = add v1, v0
+  v5 = const 2
+  v7 = add v0, v5
+  v11 = call print(v7, v7, v4, v2)
+`, f.String())
+
+	// the addition of b3 is computed in b1 and b2, which don't dominate it
+	f, _ = diamond()
+	CSE(f)
+	assert.Equal(t, "v5 = add v0, v1", f.Blocks[3].Values[1].LongString())
+
+	// in b0, it would be
+	f, vs := diamond()
+	vs["x"].Op = OpConst
+	vs["y"].Op, vs["y"].Name = OpConst, ""
+	vs["y"].Const = 2
+	first := f.Entry().NewValue(OpAdd, 1, vs["x"], vs["y"])
+	CSE(f)
+	assert.Equal(t, first, f.Blocks[3].Values[2].Args[1])
+}
+
+func TestDCE(t *testing.T) {
+	f := lower(t, "a = +1\nprint(a + 2, +x)\n")
+	CopyProp(f)
+	DCE(f)
+	assert.Equal(t, `b0:
+  v0 = const 1
+  store a, v0
+  v3 = load x
+  v5 = const 2
+  v6 = add v0, v5
+  v7 = call print(v6, v3)
+`, f.String())
+
+	// the additions that can fail are kept
+	f = lower(t, "print(x + 1)\n")
+	f.Entry().Values = f.Entry().Values[:3]
+	DCE(f)
+	assert.Equal(t, 3, len(f.Entry().Values))
+
+	// unreachable blocks are removed, with the phi arguments from them
+	f, vs := diamond()
+	f.Entry().Succs = f.Entry().Succs[:1]
+	f.Blocks[2].Preds = nil
+	DCE(f)
+	assert.Equal(t, 3, len(f.Blocks))
+	assert.Equal(t, []*Value{vs["z1"]}, vs["z"].Args)
+}
+
+func run(t *testing.T, src string, optimize bool) (string, map[string]vm.Value) {
+	machine := vm.NewVM(false)
+	var out bytes.Buffer
+	machine.Stdout = &out
+	machine.Set("s", "str")
+
+	err := machine.Run(compile(t, src, optimize))
+	if err != nil {
+		out.WriteString(err.Error())
+	}
+
+	memory := make(map[string]vm.Value)
+	for _, name := range []string{"a", "b", "c", "s", "x"} {
+		memory[name], _ = machine.Get(name)
+	}
+	return out.String(), memory
+}
+
+func TestRaise(t *testing.T) {
+	for _, src := range []string{
+		"a = 1\nb = a + 2\nprint(a, b, a + b)\n",
+		"print(x + 1, x + 1)\nx = 2\nprint(x + 1)\n",
+		"a = s\ns = 1\nprint(a + s)\n",
+		"a = x\nx = a + 1\nb = x + a\n",
+		"print(1)\nb = s + 1\nprint(2)\n",
+		"print(1, s + 1, print(2))\n",
+		"a = print(1)\nb = a\na = 2\nprint(b + a)\n",
+		"a = +(+print(1))\nc = a + 1 + a\n",
+		"x = 1 + 2\nx = x + x\nx = x + x\nprint(x)\n",
+	} {
+		root, err := parser.Parse(src, false)
+		assert.Nil(t, err, src)
+		f, err := Lower(root)
+		assert.Nil(t, err, src)
+
+		_, err = Raise(f)
+		assert.Nil(t, err, src)
+
+		output, memory := run(t, src, false)
+		optimized, optimizedMemory := run(t, src, true)
+		assert.Equal(t, output, optimized, src)
+		assert.Equal(t, memory, optimizedMemory, src)
+	}
+}
+
+func TestRaiseErrors(t *testing.T) {
+	f, _ := diamond()
+	_, err := Raise(f)
+	assert.NotNil(t, err)
+
+	// the value of x is lost when it's assigned
+	f = NewFunc()
+	b := f.Entry()
+	x := b.NewNamed(OpLoad, "x", 1)
+	b.NewNamed(OpStore, "x", 1, b.NewConst(1, 1))
+	b.NewNamed(OpCall, "print", 2, x)
+	_, err = Raise(f)
+	assert.NotNil(t, err)
+
+	// calls are computed once
+	f = NewFunc()
+	b = f.Entry()
+	call := b.NewNamed(OpCall, "input", 1)
+	b.NewNamed(OpCall, "print", 1, call, call)
+	_, err = Raise(f)
+	assert.NotNil(t, err)
+
+	// and in order
+	f = NewFunc()
+	b = f.Entry()
+	first := b.NewNamed(OpCall, "input", 1)
+	second := b.NewNamed(OpCall, "input", 1)
+	b.NewNamed(OpCall, "print", 1, first, second)
+	_, err = Raise(f)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Can't raise v0: its effects would be reordered", err.Error())
+	}
+}
@@ -8,6 +8,8 @@ import (
 func CompileGrains(a *ast.Node) (language.Grains, error) {
 	var grains language.Grains
 
+	line := a.Pos().Line
+
 	switch a.Type() {
 	case ast.RootNodeType:
 		for _, ch := range a.Children() {
@@ -15,7 +17,7 @@ func CompileGrains(a *ast.Node) (language.Grains, error) {
 				return nil, err
 			} else {
 				grains = append(grains, gs...)
-				grains = append(grains, language.Grain{language.DiscardOpCode, "", 0, 1})
+				grains = append(grains, language.Grain{OpCode: language.DiscardOpCode, PopN: 1, Line: ch.Pos().Line})
 			}
 		}
 
@@ -29,13 +31,13 @@ func CompileGrains(a *ast.Node) (language.Grains, error) {
 			grains = append(grains, gs...)
 		}
 
-		grains = append(grains, language.Grain{language.StoreOpCode, variable.Name(), a.Value(), 1})
+		grains = append(grains, language.Grain{OpCode: language.StoreOpCode, Name: variable.Name(), PopN: 1, Line: line})
 
 	case ast.LitteralNodeType:
-		grains = append(grains, language.Grain{language.ConstOpCode, a.Name(), a.Value(), 0})
+		grains = append(grains, language.Grain{OpCode: language.ConstOpCode, Value: a.Value(), Line: line})
 
 	case ast.VariableNodeType:
-		grains = append(grains, language.Grain{language.LoadOpCode, a.Name(), a.Value(), 0})
+		grains = append(grains, language.Grain{OpCode: language.LoadOpCode, Name: a.Name(), Line: line})
 
 	case ast.UnopNodeType:
 		if name := a.Name(); name != "+" {
@@ -61,7 +63,7 @@ func CompileGrains(a *ast.Node) (language.Grains, error) {
 			}
 		}
 
-		grains = append(grains, language.Grain{language.AddOpCode, a.Name(), a.Value(), 2})
+		grains = append(grains, language.Grain{OpCode: language.AddOpCode, Name: a.Name(), PopN: 2, Line: line})
 
 	case ast.FuncCallNodeType:
 		args := a.Children()
@@ -74,7 +76,7 @@ func CompileGrains(a *ast.Node) (language.Grains, error) {
 				grains = append(grains, gs...)
 			}
 		}
-		grains = append(grains, language.Grain{language.CallOpCode, a.Name(), a.Value(), nargs})
+		grains = append(grains, language.Grain{OpCode: language.CallOpCode, Name: a.Name(), PopN: nargs, Line: line})
 	}
 
 	return grains, nil
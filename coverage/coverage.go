@@ -0,0 +1,176 @@
+// Package coverage records which statements of programs are executed. A
+// Counter is a vm.Hook that counts the executions of the grains of a run; a
+// Profile merges the counts of runs by source line, and writes them as lcov
+// or as an annotated HTML report.
+//
+// Programs have no branches, so a run executes its statements in order until
+// it ends or fails, and the reports have no branch data.
+package coverage
+
+import (
+	"sort"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// A Counter counts the executions of the grains of some code.
+type Counter struct {
+	code   language.Grains
+	counts []int64
+}
+
+// NewCounter returns a counter for code.
+func NewCounter(code language.Grains) *Counter {
+	return &Counter{code: code, counts: make([]int64, len(code))}
+}
+
+// Step implements vm.Hook. Other code, such as the expressions evaluated by
+// a debugger, isn't counted.
+func (c *Counter) Step(machine *vm.VM, code language.Grains, pc int) error {
+	if len(code) != len(c.code) || len(code) == 0 || &code[0] != &c.code[0] {
+		return nil
+	}
+	c.counts[pc]++
+	return nil
+}
+
+// A statement is the grains of a statement of the source code: a statement
+// ends with a DISCARD, which has its line, or with a superinstruction that
+// replaces it.
+type statement struct {
+	first int // address of its first grain
+	line  int
+}
+
+func statements(code language.Grains) []statement {
+	var stmts []statement
+
+	first := 0
+	for pc, g := range code {
+		switch g.OpCode {
+		case language.DiscardOpCode, language.StorePopOpCode, language.IncLocalOpCode:
+			stmts = append(stmts, statement{first, g.Line})
+			first = pc + 1
+		}
+	}
+	if first < len(code) {
+		// code that doesn't come from the compiler
+		stmts = append(stmts, statement{first, code[first].Line})
+	}
+	return stmts
+}
+
+// A File is the coverage of a source file.
+type File struct {
+	Name   string
+	Source []byte
+
+	// Lines maps the lines that have statements to the number of times they
+	// were executed. A line with several statements counts the executions
+	// of the least executed one.
+	Lines map[int]int64
+}
+
+// Covered returns the number of lines that were executed, and the number of
+// lines that have statements.
+func (f *File) Covered() (covered, total int) {
+	for _, count := range f.Lines {
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, len(f.Lines)
+}
+
+// Percent returns the percentage of lines that were executed.
+func (f *File) Percent() float64 {
+	return percent(f.Covered())
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+func (f *File) sortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for n := range f.Lines {
+		lines = append(lines, n)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// A Profile is the coverage of source files, merged over runs.
+type Profile struct {
+	files map[string]*File
+}
+
+// NewProfile returns an empty profile.
+func NewProfile() *Profile {
+	return &Profile{files: make(map[string]*File)}
+}
+
+// Add adds a run of the code counted by c to the coverage of a source file.
+// source is the source code of the file; it's used by the HTML report.
+func (p *Profile) Add(filename string, source []byte, c *Counter) {
+	run := make(map[int]int64)
+	for _, s := range statements(c.code) {
+		if s.line == 0 {
+			continue
+		}
+		count := c.counts[s.first]
+		if prev, ok := run[s.line]; !ok || count < prev {
+			run[s.line] = count
+		}
+	}
+
+	p.addFile(&File{Name: filename, Source: source, Lines: run})
+}
+
+// Merge adds the runs of another profile to p.
+func (p *Profile) Merge(other *Profile) {
+	for _, f := range other.files {
+		p.addFile(f)
+	}
+}
+
+func (p *Profile) addFile(f *File) {
+	merged, ok := p.files[f.Name]
+	if !ok {
+		merged = &File{Name: f.Name, Lines: make(map[int]int64)}
+		p.files[f.Name] = merged
+	}
+	if f.Source != nil {
+		merged.Source = f.Source
+	}
+
+	for n, count := range f.Lines {
+		merged.Lines[n] += count
+	}
+}
+
+// Files returns the files of the profile, sorted by name.
+func (p *Profile) Files() []*File {
+	files := make([]*File, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Percent returns the percentage of lines of all the files that were
+// executed.
+func (p *Profile) Percent() float64 {
+	var covered, total int
+	for _, f := range p.files {
+		c, t := f.Covered()
+		covered += c
+		total += t
+	}
+	return percent(covered, total)
+}
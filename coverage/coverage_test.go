@@ -0,0 +1,138 @@
+package coverage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bfontaine/quinoa/internal/testutil"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// the run fails on line 3, so lines 3 and 4 are partially or not executed
+const source = "a = 1\nb = a + 2\nprint(b); nope()\nprint(a)\n"
+
+func run(t *testing.T, code language.Grains) *Counter {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	c := NewCounter(code)
+	machine.Hook = c
+	assert.NotNil(t, machine.Run(code))
+	return c
+}
+
+func TestProfile(t *testing.T) {
+	code := testutil.Compile(t, source)
+
+	p := NewProfile()
+	p.Add("a.qi", []byte(source), run(t, code))
+
+	files := p.Files()
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "a.qi", files[0].Name)
+	assert.Equal(t, map[int]int64{1: 1, 2: 1, 3: 1, 4: 0}, files[0].Lines)
+
+	covered, total := files[0].Covered()
+	assert.Equal(t, 3, covered)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, 75.0, p.Percent())
+
+	// a second run and another file
+	p.Add("a.qi", nil, run(t, code))
+	other := NewProfile()
+	other.Add("b.qi", []byte("nope()\n"), run(t, testutil.Compile(t, "nope()\n")))
+	p.Merge(other)
+
+	files = p.Files()
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, map[int]int64{1: 2, 2: 2, 3: 2, 4: 0}, files[0].Lines)
+	assert.Equal(t, []byte(source), files[0].Source)
+	assert.Equal(t, map[int]int64{1: 1}, files[1].Lines)
+	assert.Equal(t, 80.0, p.Percent())
+}
+
+func TestUnreachedLines(t *testing.T) {
+	// the statements after the error aren't executed
+	src := "a = 1\nb = nope()\nc = a + 1\nprint(c)\n"
+	p := NewProfile()
+	p.Add("a.qi", []byte(src), run(t, testutil.Compile(t, src)))
+
+	files := p.Files()
+	assert.Equal(t, map[int]int64{1: 1, 2: 1, 3: 0, 4: 0}, files[0].Lines)
+	assert.Equal(t, 50.0, p.Percent())
+}
+
+func TestMultiGrainLines(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		code  language.Grains
+		lines map[int]int64
+	}{
+		{
+			// a line is covered if all its statements are executed
+			"statements",
+			testutil.Compile(t, "a = 1 + 2 + 3\nprint(a); nope(); print(a)\n"),
+			map[int]int64{1: 1, 2: 0},
+		},
+		{
+			// a statement is on the line of its last grain
+			"multi-line statement",
+			testutil.Compile(t, "print(1,\n2)\nnope()\n"),
+			map[int]int64{1: 1, 3: 1},
+		},
+		{
+			"superinstructions",
+			testutil.Assemble(t, "; 1\nCONST 6\nSTOREPOP a\n; 2\nINCLOCAL a 1\n; 3\nCALL nope/0\nDISCARD\n; 4\nLOAD a\nSTOREPOP b\n"),
+			map[int]int64{1: 1, 2: 1, 3: 1, 4: 0},
+		},
+	} {
+		p := NewProfile()
+		p.Add("a.qi", nil, run(t, tc.code))
+		assert.Equal(t, tc.lines, p.Files()[0].Lines, tc.name)
+	}
+}
+
+func TestOtherCode(t *testing.T) {
+	code := testutil.Compile(t, source)
+	c := NewCounter(code)
+
+	// e.g. an expression evaluated by a debugger
+	other := testutil.Compile(t, "a = 1\n")
+	assert.Nil(t, c.Step(nil, other, 0))
+	assert.Equal(t, make([]int64, len(code)), c.counts)
+}
+
+func TestWriteLcov(t *testing.T) {
+	p := NewProfile()
+	p.Add("a.qi", []byte(source), run(t, testutil.Compile(t, source)))
+
+	var b bytes.Buffer
+	assert.Nil(t, p.WriteLcov(&b))
+	assert.Equal(t, `TN:
+SF:a.qi
+DA:1,1
+DA:2,1
+DA:3,1
+DA:4,0
+LF:4
+LH:3
+end_of_record
+`, b.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	p := NewProfile()
+	p.Add("a<b>.qi", []byte(source+"# done\n"), run(t, testutil.Compile(t, source)))
+
+	var b bytes.Buffer
+	assert.Nil(t, p.WriteHTML(&b))
+	html := b.String()
+
+	assert.Contains(t, html, "<h1>Coverage: 75.0%</h1>")
+	assert.Contains(t, html, `<h2 id="file0">a&lt;b&gt;.qi: 75.0%</h2>`)
+	assert.Contains(t, html, `<tr class="covered"><td class="number">2</td><td class="count">1</td><td class="text">b = a &#43; 2</td></tr>`)
+	assert.Contains(t, html, `<tr class="uncovered"><td class="number">4</td><td class="count">0</td><td class="text">print(a)</td></tr>`)
+	assert.Contains(t, html, `<tr><td class="number">5</td><td class="count"></td><td class="text"># done</td></tr>`)
+}
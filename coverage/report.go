@@ -0,0 +1,118 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteLcov writes the profile in the lcov tracefile format, which is read
+// by genhtml and most coverage services.
+func (p *Profile) WriteLcov(w io.Writer) error {
+	var b strings.Builder
+
+	for _, f := range p.Files() {
+		b.WriteString("TN:\n")
+		fmt.Fprintf(&b, "SF:%s\n", f.Name)
+		for _, n := range f.sortedLines() {
+			fmt.Fprintf(&b, "DA:%d,%d\n", n, f.Lines[n])
+		}
+		covered, total := f.Covered()
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\n", total, covered)
+		b.WriteString("end_of_record\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// a line of a file in the HTML report
+type htmlLine struct {
+	Number int
+	Text   string
+	Count  string
+	Class  string // "covered", "uncovered", or "" for lines without statements
+}
+
+type htmlFile struct {
+	Name    string
+	ID      string
+	Percent string
+	Lines   []htmlLine
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; }
+table.source { border-collapse: collapse; font-family: monospace; }
+table.source td { padding: 0 0.5em; white-space: pre; }
+td.number, td.count { text-align: right; color: #888; }
+tr.covered td.text { background: #dfd; }
+tr.uncovered td.text { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Coverage: {{.Percent}}</h1>
+<ul>
+{{- range .Files}}
+<li><a href="#{{.ID}}">{{.Name}}</a>: {{.Percent}}</li>
+{{- end}}
+</ul>
+{{- range .Files}}
+<h2 id="{{.ID}}">{{.Name}}: {{.Percent}}</h2>
+<table class="source">
+{{- range .Lines}}
+<tr{{if .Class}} class="{{.Class}}"{{end}}><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="text">{{.Text}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes a report of the profile in HTML. It shows the source code
+// of the files, with the executed lines in green, the ones that weren't in
+// red, and the number of executions of each line.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	var files []htmlFile
+
+	for i, f := range p.Files() {
+		hf := htmlFile{
+			Name:    f.Name,
+			ID:      fmt.Sprintf("file%d", i),
+			Percent: fmt.Sprintf("%.1f%%", f.Percent()),
+		}
+
+		for i, text := range sourceLines(f.Source) {
+			l := htmlLine{Number: i + 1, Text: text}
+			if count, ok := f.Lines[i+1]; ok {
+				l.Count = fmt.Sprint(count)
+				l.Class = "uncovered"
+				if count > 0 {
+					l.Class = "covered"
+				}
+			}
+			hf.Lines = append(hf.Lines, l)
+		}
+
+		files = append(files, hf)
+	}
+
+	return htmlTemplate.Execute(w, struct {
+		Percent string
+		Files   []htmlFile
+	}{fmt.Sprintf("%.1f%%", p.Percent()), files})
+}
+
+func sourceLines(source []byte) []string {
+	if len(source) == 0 {
+		return nil
+	}
+	text := strings.Replace(string(source), "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,623 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/debugger"
+	"github.com/bfontaine/quinoa/internal/framing"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// Programs have a single thread, and a single scope.
+const (
+	threadID     = 1
+	localsScope  = 1
+	firstChildID = 2
+)
+
+// capabilities that can be allowed with the "allow" argument of launch
+var knownCapabilities = []vm.Capability{vm.CapFSRead, vm.CapFSWrite, vm.CapEnv, vm.CapClock, vm.CapExec}
+
+// state of the program being debugged
+type state int
+
+const (
+	notLaunched state = iota
+	launched          // waiting for configurationDone
+	running
+	stopped
+	terminated
+)
+
+// A Server is a debug adapter that reads requests and writes responses and
+// events in the format of the Debug Adapter Protocol. It debugs one program.
+//
+// The program runs in its own goroutine. Requests that inspect it are only
+// allowed while it's stopped; they're sent to its goroutine, which executes
+// them in order.
+type Server struct {
+	// Compile compiles a program. It defaults to compiling source code.
+	Compile func(filename string, code []byte) (language.Grains, error)
+
+	in *bufio.Reader
+
+	writeLock sync.Mutex
+	out       io.Writer
+	seq       int
+
+	program  string
+	code     language.Grains
+	machine  *vm.VM
+	debugger *debugger.Debugger
+
+	lock       sync.Mutex
+	state      state
+	configured bool
+	aborted    bool
+
+	// requests executed by the goroutine of the program while it's stopped;
+	// they tell if it must resume
+	requests chan func() (debugger.Action, bool)
+	// closed when the program terminates
+	done chan struct{}
+
+	// values of the variables references, valid until the program resumes
+	children []vm.Value
+}
+
+// NewServer returns a server that reads requests from in and writes to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		Compile:  compile,
+		in:       bufio.NewReader(in),
+		out:      out,
+		requests: make(chan func() (debugger.Action, bool)),
+		done:     make(chan struct{}),
+	}
+}
+
+func compile(filename string, code []byte) (language.Grains, error) {
+	root, err := parser.Parse(string(code), false)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.CompileGrains(root)
+}
+
+// Serve handles requests until the client disconnects or closes the input.
+// The program is aborted if it's still running. Invalid messages are reported
+// and ignored.
+func (s *Server) Serve() error {
+	for {
+		req, err := readMessage(s.in)
+		if errors.Is(err, errInvalidMessage) {
+			s.event("output", outputEvent{Category: "console", Output: err.Error() + "\n"})
+			continue
+		}
+		if err != nil {
+			s.abort()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if req.Type != "request" {
+			continue
+		}
+
+		if req.Command == "disconnect" {
+			s.abort()
+			s.respond(req, nil, nil)
+			return nil
+		}
+
+		s.handle(req)
+	}
+}
+
+func (s *Server) handle(req *message) {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsSetVariable:              true,
+		}, nil)
+
+	case "launch":
+		err := s.launch(req.Arguments)
+		s.respond(req, nil, err)
+		if err == nil {
+			// the client can now set the breakpoints
+			s.event("initialized", nil)
+			s.startIfReady()
+		}
+
+	case "configurationDone":
+		s.lock.Lock()
+		s.configured = true
+		s.lock.Unlock()
+
+		s.respond(req, nil, nil)
+		s.startIfReady()
+
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+
+	case "threads":
+		s.respond(req, map[string]interface{}{
+			"threads": []thread{{ID: threadID, Name: "main"}},
+		}, nil)
+
+	case "stackTrace":
+		s.whileStopped(req, s.stackTrace)
+	case "scopes":
+		s.whileStopped(req, func(json.RawMessage) (interface{}, error) {
+			return map[string]interface{}{
+				"scopes": []scope{{Name: "Locals", VariablesReference: localsScope}},
+			}, nil
+		})
+	case "variables":
+		s.whileStopped(req, s.variables)
+	case "setVariable":
+		s.whileStopped(req, s.setVariable)
+	case "evaluate":
+		s.whileStopped(req, s.evaluate)
+
+	case "continue":
+		s.resume(req, debugger.Continue, map[string]interface{}{"allThreadsContinued": true})
+	case "next":
+		s.resume(req, debugger.Next, nil)
+	case "stepIn":
+		s.resume(req, debugger.StepIn, nil)
+	case "stepOut":
+		s.resume(req, debugger.StepOut, nil)
+
+	case "pause":
+		s.lock.Lock()
+		if s.state == running {
+			s.debugger.Pause()
+		}
+		s.lock.Unlock()
+		s.respond(req, nil, nil)
+
+	default:
+		s.respond(req, nil, fmt.Errorf("Unknown command '%s'", req.Command))
+	}
+}
+
+func (s *Server) launch(arguments json.RawMessage) error {
+	var args launchArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return fmt.Errorf("Invalid arguments: %s", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.state != notLaunched {
+		return errors.New("A program is already launched")
+	}
+	if args.Program == "" {
+		return errors.New("Missing program")
+	}
+
+	code, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	gs, err := s.Compile(args.Program, code)
+	if err != nil {
+		return fmt.Errorf("%s: %s", args.Program, err)
+	}
+
+	machine := vm.NewVM(false)
+	machine.Args = args.Args
+	machine.Stdin = nil
+	machine.Stdout = &outputWriter{s, "stdout"}
+	machine.Stderr = &outputWriter{s, "stderr"}
+
+	for _, name := range args.Allow {
+		c, ok := capability(name)
+		if !ok {
+			return fmt.Errorf("Unknown capability '%s'", name)
+		}
+		machine.Allow(c)
+	}
+
+	// the client shows the source lines itself
+	d := debugger.New(machine, nil, s)
+	d.StopOnEntry = args.StopOnEntry
+	d.Load(gs)
+
+	s.program, s.code, s.machine, s.debugger = args.Program, gs, machine, d
+	s.state = launched
+	return nil
+}
+
+func capability(name string) (vm.Capability, bool) {
+	for _, c := range knownCapabilities {
+		if string(c) == name {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// startIfReady starts the program once it's launched and configured. It's
+// called after the responses, so that the events of the program come after
+// them.
+func (s *Server) startIfReady() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.state != launched || !s.configured {
+		return
+	}
+
+	s.state = running
+	go s.run()
+}
+
+func (s *Server) run() {
+	err := s.machine.Run(s.code)
+
+	s.lock.Lock()
+	s.state = terminated
+	s.lock.Unlock()
+
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		if !errors.Is(err, debugger.ErrAborted) {
+			s.event("output", outputEvent{Category: "stderr", Output: err.Error() + "\n"})
+		}
+	}
+
+	s.event("exited", exitedEvent{ExitCode: exitCode})
+	s.event("terminated", nil)
+	close(s.done)
+}
+
+// abort aborts the program if it's running, and waits for it to terminate.
+func (s *Server) abort() {
+	s.lock.Lock()
+	state := s.state
+	s.aborted = true
+	if state == stopped {
+		s.state = running
+	}
+	s.lock.Unlock()
+
+	switch state {
+	case running:
+		s.debugger.Pause()
+	case stopped:
+		s.requests <- func() (debugger.Action, bool) { return debugger.Abort, true }
+	default:
+		return
+	}
+
+	<-s.done
+}
+
+// Stopped implements debugger.Frontend. It runs in the goroutine of the
+// program and executes the requests until one resumes the execution.
+func (s *Server) Stopped(d *debugger.Debugger, reason debugger.StopReason) debugger.Action {
+	// send the output of the program before the event
+	d.VM().Flush()
+
+	s.lock.Lock()
+	if s.aborted {
+		s.lock.Unlock()
+		return debugger.Abort
+	}
+	s.state = stopped
+	s.lock.Unlock()
+
+	s.children = nil
+
+	s.event("stopped", stoppedEvent{
+		Reason:            stopReason(reason),
+		ThreadID:          threadID,
+		AllThreadsStopped: true,
+	})
+
+	for req := range s.requests {
+		if action, resume := req(); resume {
+			return action
+		}
+	}
+	return debugger.Abort
+}
+
+func stopReason(reason debugger.StopReason) string {
+	if reason == debugger.StopWatch {
+		return "data breakpoint"
+	}
+	return string(reason)
+}
+
+// whileStopped executes a request in the goroutine of the program if it's
+// stopped, and responds with the result.
+func (s *Server) whileStopped(req *message, f func(json.RawMessage) (interface{}, error)) {
+	s.lock.Lock()
+	state := s.state
+	s.lock.Unlock()
+
+	if state != stopped {
+		s.respond(req, nil, s.notStopped(state))
+		return
+	}
+
+	s.requests <- func() (debugger.Action, bool) {
+		body, err := f(req.Arguments)
+		s.respond(req, body, err)
+		return 0, false
+	}
+}
+
+// resume responds to a request and resumes the program with an action. The
+// response is sent before the program resumes, so it comes before the events
+// of the execution.
+func (s *Server) resume(req *message, action debugger.Action, body interface{}) {
+	s.lock.Lock()
+	state := s.state
+	if state == stopped {
+		s.state = running
+	}
+	s.lock.Unlock()
+
+	if state != stopped {
+		s.respond(req, nil, s.notStopped(state))
+		return
+	}
+
+	s.requests <- func() (debugger.Action, bool) {
+		s.respond(req, body, nil)
+		return action, true
+	}
+}
+
+func (s *Server) notStopped(state state) error {
+	switch state {
+	case running:
+		return errors.New("The program is running")
+	case terminated:
+		return errors.New("The program has terminated")
+	}
+	return errors.New("The program isn't started")
+}
+
+func (s *Server) setBreakpoints(req *message) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.respond(req, nil, fmt.Errorf("Invalid arguments: %s", err))
+		return
+	}
+
+	s.lock.Lock()
+	state := s.state
+	s.lock.Unlock()
+
+	if state == notLaunched {
+		s.respond(req, nil, s.notStopped(state))
+		return
+	}
+
+	var lines []int
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for i, b := range args.Breakpoints {
+		breakpoints[i] = breakpoint{Line: b.Line}
+		if debugger.HasLine(s.code, b.Line) {
+			breakpoints[i].Verified = true
+			lines = append(lines, b.Line)
+		} else {
+			breakpoints[i].Message = fmt.Sprintf("No code on line %d", b.Line)
+		}
+	}
+
+	set := func() {
+		s.debugger.ClearBreakpoints()
+		for _, line := range lines {
+			s.debugger.SetBreakpoint(line)
+		}
+	}
+
+	switch state {
+	case launched:
+		set()
+	case running:
+		s.debugger.Do(set)
+	case stopped:
+		s.requests <- func() (debugger.Action, bool) {
+			set()
+			return 0, false
+		}
+	}
+
+	s.respond(req, map[string]interface{}{"breakpoints": breakpoints}, nil)
+}
+
+// The following requests run in the goroutine of the program while it's
+// stopped.
+
+func (s *Server) stackTrace(json.RawMessage) (interface{}, error) {
+	src := &source{Name: filepath.Base(s.program), Path: s.program}
+
+	frames := s.debugger.Frames()
+	stackFrames := make([]stackFrame, len(frames))
+	for i, f := range frames {
+		stackFrames[i] = stackFrame{ID: i + 1, Name: f.Name, Source: src, Line: f.Line, Column: 1}
+	}
+
+	return map[string]interface{}{
+		"stackFrames": stackFrames,
+		"totalFrames": len(stackFrames),
+	}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var args variablesArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, fmt.Errorf("Invalid arguments: %s", err)
+	}
+
+	vars := []variable{}
+
+	if args.VariablesReference == localsScope {
+		for _, v := range s.debugger.Variables() {
+			vars = append(vars, s.variable(v.Name, v.Value))
+		}
+		return map[string]interface{}{"variables": vars}, nil
+	}
+
+	i := args.VariablesReference - firstChildID
+	if i < 0 || i >= len(s.children) {
+		return nil, fmt.Errorf("Unknown variables reference %d", args.VariablesReference)
+	}
+
+	switch v := s.children[i].(type) {
+	case []vm.Value:
+		for i, e := range v {
+			vars = append(vars, s.variable(strconv.Itoa(i), e))
+		}
+	case map[string]vm.Value:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vars = append(vars, s.variable(strconv.Quote(k), v[k]))
+		}
+	}
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// variable returns the description of a value. Lists and maps get a
+// reference to their elements.
+func (s *Server) variable(name string, v vm.Value) variable {
+	return variable{
+		Name:               name,
+		Value:              vm.Repr(v),
+		Type:               vm.TypeName(v),
+		VariablesReference: s.reference(v),
+	}
+}
+
+func (s *Server) reference(v vm.Value) int {
+	switch v := v.(type) {
+	case []vm.Value:
+		if len(v) == 0 {
+			return 0
+		}
+	case map[string]vm.Value:
+		if len(v) == 0 {
+			return 0
+		}
+	default:
+		return 0
+	}
+
+	s.children = append(s.children, v)
+	return firstChildID + len(s.children) - 1
+}
+
+func (s *Server) setVariable(arguments json.RawMessage) (interface{}, error) {
+	var args setVariableArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, fmt.Errorf("Invalid arguments: %s", err)
+	}
+
+	if args.VariablesReference != localsScope {
+		return nil, errors.New("Only variables can be set")
+	}
+
+	if err := s.debugger.Set(args.Name, args.Value); err != nil {
+		return nil, err
+	}
+
+	v, _ := s.machine.Get(args.Name)
+	d := s.variable(args.Name, v)
+	return map[string]interface{}{
+		"value":              d.Value,
+		"type":               d.Type,
+		"variablesReference": d.VariablesReference,
+	}, nil
+}
+
+func (s *Server) evaluate(arguments json.RawMessage) (interface{}, error) {
+	var args evaluateArguments
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, fmt.Errorf("Invalid arguments: %s", err)
+	}
+
+	v, err := s.debugger.Eval(args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	d := s.variable("", v)
+	return map[string]interface{}{
+		"result":             d.Value,
+		"type":               d.Type,
+		"variablesReference": d.VariablesReference,
+	}, nil
+}
+
+// Messages
+
+func (s *Server) respond(req *message, body interface{}, err error) {
+	success := err == nil
+	resp := &message{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Success:    &success,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	s.send(resp)
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&message{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) send(msg *message) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	// the client is gone if it fails; Serve stops when the input is closed
+	framing.Write(s.out, msg)
+}
+
+// An outputWriter sends what the program writes as output events.
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", outputEvent{Category: w.category, Output: string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,142 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bfontaine/quinoa/internal/framing"
+	"github.com/stretchr/testify/assert"
+)
+
+// client sends requests to a server and reads what it sends back
+type client struct {
+	in  *io.PipeWriter
+	out *bufio.Reader
+}
+
+func startServer(t *testing.T) (*client, chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+
+	return &client{in: inW, out: bufio.NewReader(outR)}, errs
+}
+
+func (c *client) send(t *testing.T, msg string) {
+	assert.Nil(t, writeRaw(c.in, []byte(msg)))
+}
+
+func (c *client) receive(t *testing.T) string {
+	msg, err := readMessage(c.out)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	b, err := json.Marshal(msg)
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func writeRaw(w io.Writer, content []byte) error {
+	var msg message
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return err
+	}
+	return framing.Write(w, &msg)
+}
+
+// normalize returns a JSON message with sorted keys and no spaces.
+func normalize(t *testing.T, msg string) string {
+	var v interface{}
+	if !assert.Nil(t, json.Unmarshal([]byte(msg), &v), msg) {
+		t.FailNow()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestSession(t *testing.T) {
+	transcript, err := ioutil.ReadFile("testdata/session.txt")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	c, errs := startServer(t)
+
+	for _, line := range strings.Split(string(transcript), "\n") {
+		switch {
+		case strings.HasPrefix(line, "-> "):
+			c.send(t, line[3:])
+		case strings.HasPrefix(line, "<- "):
+			assert.Equal(t, normalize(t, line[3:]), normalize(t, c.receive(t)))
+		}
+	}
+
+	assert.Nil(t, <-errs)
+}
+
+func TestAbortOnEOF(t *testing.T) {
+	c, errs := startServer(t)
+
+	c.send(t, `{"seq": 1, "type": "request", "command": "launch", "arguments": {"program": "testdata/count.qi", "stopOnEntry": true}}`)
+	assert.Contains(t, c.receive(t), `"launch"`)
+	assert.Contains(t, c.receive(t), `"initialized"`)
+
+	c.send(t, `{"seq": 2, "type": "request", "command": "configurationDone"}`)
+	assert.Contains(t, c.receive(t), `"configurationDone"`)
+	assert.Contains(t, c.receive(t), `"stopped"`)
+
+	c.in.Close()
+
+	assert.Contains(t, c.receive(t), `"exitCode":1`)
+	assert.Contains(t, c.receive(t), `"terminated"`)
+	assert.Nil(t, <-errs)
+}
+
+func TestRequestErrors(t *testing.T) {
+	c, errs := startServer(t)
+
+	for _, tc := range []struct{ request, message string }{
+		{`"command": "stackTrace"`, "The program isn't started"},
+		{`"command": "setBreakpoints", "arguments": {"breakpoints": []}`, "The program isn't started"},
+		{`"command": "launch", "arguments": {}`, "Missing program"},
+		{`"command": "launch", "arguments": {"program": "testdata/count.qi", "allow": ["net"]}`, "Unknown capability 'net'"},
+		{`"command": "frobnicate"`, "Unknown command 'frobnicate'"},
+	} {
+		c.send(t, `{"seq": 1, "type": "request", `+tc.request+`}`)
+		resp := c.receive(t)
+		assert.Contains(t, resp, `"success":false`)
+		assert.Contains(t, resp, `"message":"`+tc.message+`"`)
+	}
+
+	c.send(t, `{"seq": 1, "type": "request", "command": "disconnect"}`)
+	assert.Contains(t, c.receive(t), `"disconnect"`)
+	assert.Nil(t, <-errs)
+}
+
+func TestInvalidMessages(t *testing.T) {
+	c, errs := startServer(t)
+
+	_, err := io.WriteString(c.in, "Content-Length: 9\r\n\r\n{\"seq\": }")
+	assert.Nil(t, err)
+	assert.Contains(t, c.receive(t), `"output":"Invalid message: invalid character '}' looking for beginning of value\n"`)
+
+	// the session goes on
+	c.send(t, `{"seq": 1, "type": "request", "command": "stackTrace"}`)
+	assert.Contains(t, c.receive(t), `"message":"The program isn't started"`)
+
+	// but not after a framing error
+	_, err = io.WriteString(c.in, "Content-Length: x\r\n\r\n")
+	assert.Nil(t, err)
+	if err := <-errs; assert.NotNil(t, err) {
+		assert.Equal(t, `Invalid Content-Length header: "x"`, err.Error())
+	}
+}
@@ -0,0 +1,284 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bfontaine/quinoa/vm"
+)
+
+const consolePrompt = "(qdb) "
+
+const consoleHelp = `Commands:
+  break, b [line]      set a breakpoint, or list them
+  delete, d <line>     delete a breakpoint
+  continue, c          run until a breakpoint or a watch
+  next, n              run until the next line
+  step, s              step in the next line
+  stepi, si            execute one grain
+  finish               run until the current frame returns
+  backtrace, bt        show the call stack
+  list, l [line]       show the source around the current line
+  print, p <expr>      evaluate an expression
+  set <name> = <expr>  set a variable
+  locals               show the variables of the current frame
+  watch, w [expr]      watch an expression, or list the watches
+  unwatch <n>          remove a watch
+  quit, q              abort the program
+An empty line repeats the last command.
+`
+
+// A Console is a Frontend that reads commands from a terminal, in the style
+// of gdb.
+type Console struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// last command, repeated by an empty line
+	last string
+}
+
+// NewConsole returns a console that reads commands from in. The reader can
+// be shared with the VM so that the program reads the same input.
+func NewConsole(in *bufio.Reader, out io.Writer) *Console {
+	return &Console{in: in, out: out}
+}
+
+// Stopped implements Frontend.
+func (c *Console) Stopped(d *Debugger, reason StopReason) Action {
+	// show the output of the program before the location
+	d.VM().Flush()
+
+	switch reason {
+	case StopEntry:
+		fmt.Fprintf(c.out, "Stopped at the entry of the program, %s\n", c.location(d))
+	case StopBreakpoint:
+		fmt.Fprintf(c.out, "Breakpoint, %s\n", c.location(d))
+	case StopWatch:
+		fmt.Fprintf(c.out, "Watched value changed, %s\n", c.location(d))
+	case StopPause:
+		fmt.Fprintf(c.out, "Paused, %s\n", c.location(d))
+	}
+	c.showLine(d)
+	c.showWatches(d)
+
+	for {
+		fmt.Fprint(c.out, consolePrompt)
+
+		line, err := c.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(c.out)
+			return Abort
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = c.last
+		}
+		c.last = line
+
+		if action, resume := c.command(d, line); resume {
+			return action
+		}
+	}
+}
+
+// command executes a command, and tells if the execution must resume.
+func (c *Console) command(d *Debugger, line string) (Action, bool) {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	switch name {
+	case "":
+		return 0, false
+
+	case "help", "h":
+		fmt.Fprint(c.out, consoleHelp)
+
+	case "continue", "c":
+		return Continue, true
+	case "next", "n":
+		return Next, true
+	case "step", "s":
+		return StepIn, true
+	case "stepi", "si":
+		return StepInstruction, true
+	case "finish":
+		if len(d.Frames()) == 1 {
+			fmt.Fprintln(c.out, `"finish" not meaningful in the outermost frame.`)
+			return 0, false
+		}
+		return StepOut, true
+	case "quit", "q":
+		return Abort, true
+
+	case "break", "b":
+		if arg == "" {
+			c.listBreakpoints(d)
+			break
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			c.error("Usage: break <line>")
+			break
+		}
+		if err := d.SetBreakpoint(n); err != nil {
+			c.error(err.Error())
+			break
+		}
+		fmt.Fprintf(c.out, "Breakpoint on line %d\n", n)
+
+	case "delete", "d":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			c.error("Usage: delete <line>")
+			break
+		}
+		d.ClearBreakpoint(n)
+
+	case "backtrace", "bt":
+		for i, f := range d.Frames() {
+			fmt.Fprintf(c.out, "#%d  %s at %s\n", i, f.Name, c.frameLocation(f))
+		}
+
+	case "list", "l":
+		center := d.Line()
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				c.error("Usage: list [line]")
+				break
+			}
+			center = n
+		}
+		c.list(d, center)
+
+	case "print", "p":
+		if arg == "" {
+			c.error("Usage: print <expr>")
+			break
+		}
+		v, err := d.Eval(arg)
+		if err != nil {
+			c.error(err.Error())
+			break
+		}
+		fmt.Fprintln(c.out, vm.Repr(v))
+
+	case "set":
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			c.error("Usage: set <name> = <expr>")
+			break
+		}
+		if err := d.Set(strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+1:])); err != nil {
+			c.error(err.Error())
+		}
+
+	case "locals":
+		vars := d.Variables()
+		if len(vars) == 0 {
+			fmt.Fprintln(c.out, "No variables.")
+		}
+		for _, v := range vars {
+			fmt.Fprintf(c.out, "%s = %s\n", v.Name, vm.Repr(v.Value))
+		}
+
+	case "watch", "w":
+		if arg == "" {
+			c.showWatches(d)
+			break
+		}
+		if _, err := d.AddWatch(arg); err != nil {
+			c.error(err.Error())
+			break
+		}
+		c.showWatches(d)
+
+	case "unwatch":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			c.error("Usage: unwatch <n>")
+			break
+		}
+		if err := d.RemoveWatch(n); err != nil {
+			c.error(err.Error())
+		}
+
+	default:
+		c.error(fmt.Sprintf("Unknown command '%s'; see help", name))
+	}
+
+	return 0, false
+}
+
+func (c *Console) error(msg string) {
+	fmt.Fprintf(c.out, "error: %s\n", msg)
+}
+
+func (c *Console) location(d *Debugger) string {
+	return c.frameLocation(d.Frames()[0])
+}
+
+func (c *Console) frameLocation(f Frame) string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d", f.Line)
+	}
+	return fmt.Sprintf("grain %04d", f.PC)
+}
+
+// showLine shows the source line of the next grain, or the grain itself if
+// the source is unknown.
+func (c *Console) showLine(d *Debugger) {
+	if src, ok := d.SourceLine(d.Line()); ok {
+		fmt.Fprintf(c.out, "%4d  %s\n", d.Line(), src)
+		return
+	}
+	fmt.Fprintf(c.out, "%04d  %s\n", d.PC(), d.Code()[d.PC()])
+}
+
+func (c *Console) showWatches(d *Debugger) {
+	for i, w := range d.Watches() {
+		if w.Err != nil {
+			fmt.Fprintf(c.out, "w%d: %s = <error: %s>\n", i, w.Expr, w.Err)
+		} else {
+			fmt.Fprintf(c.out, "w%d: %s = %s\n", i, w.Expr, vm.Repr(w.Value))
+		}
+	}
+}
+
+func (c *Console) listBreakpoints(d *Debugger) {
+	lines := d.Breakpoints()
+	if len(lines) == 0 {
+		fmt.Fprintln(c.out, "No breakpoints.")
+	}
+	for _, line := range lines {
+		fmt.Fprintf(c.out, "Breakpoint on line %d\n", line)
+	}
+}
+
+// list shows the source lines around a line; the current one is marked.
+func (c *Console) list(d *Debugger, center int) {
+	if _, ok := d.SourceLine(1); !ok {
+		c.error("No source code")
+		return
+	}
+
+	for n := center - 5; n <= center+5; n++ {
+		src, ok := d.SourceLine(n)
+		if !ok {
+			continue
+		}
+
+		marker := "  "
+		if n == d.Line() {
+			marker = "=>"
+		}
+		fmt.Fprintf(c.out, "%s%4d  %s\n", marker, n, src)
+	}
+}
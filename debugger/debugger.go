@@ -0,0 +1,388 @@
+// Package debugger implements a step debugger on top of the hooks of the VM.
+// The Debugger controls the execution and a Frontend, such as the Console,
+// interacts with the user when it stops.
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// ErrAborted is the cause of the RuntimeError returned by the VM when the
+// user aborts the execution.
+var ErrAborted = errors.New("Execution aborted")
+
+// A StopReason tells why the execution stopped.
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopWatch      StopReason = "watch"
+	StopPause      StopReason = "pause"
+)
+
+// An Action tells how to resume the execution.
+type Action int
+
+const (
+	// Continue runs until a breakpoint or a watch stops the execution.
+	Continue Action = iota
+	// Next runs until the next source line.
+	Next
+	// StepIn is like Next, but stops in the functions it calls. Builtins
+	// can't be stepped in, so it's the same as Next for now.
+	StepIn
+	// StepOut runs until the current frame returns. Programs run in a single
+	// frame, so it's the same as Continue for now.
+	StepOut
+	// StepInstruction runs until the next grain.
+	StepInstruction
+	// Abort stops the execution with ErrAborted.
+	Abort
+)
+
+// A Frontend interacts with the user when the execution stops.
+type Frontend interface {
+	// Stopped is called when the execution stops, before the grain at
+	// d.PC() is executed. It can inspect and modify the state through the
+	// debugger, and returns how to resume the execution.
+	Stopped(d *Debugger, reason StopReason) Action
+}
+
+// A Frame is a function being executed.
+type Frame struct {
+	Name string
+	Line int
+	PC   int
+}
+
+// A Variable is a variable with a value.
+type Variable struct {
+	Name  string
+	Value vm.Value
+}
+
+// A Watch is an expression whose value is shown every time the execution
+// stops. The execution stops when its value changes.
+type Watch struct {
+	Expr string
+
+	// last value and error of the expression
+	Value vm.Value
+	Err   error
+
+	grains language.Grains
+}
+
+// A Debugger is a vm.Hook that stops the execution at breakpoints, after
+// steps or when watched values change, and lets its frontend inspect the
+// state of the VM.
+type Debugger struct {
+	vm     *vm.VM
+	source []string
+	fe     Frontend
+
+	// StopOnEntry stops the execution before the first grain.
+	StopOnEntry bool
+
+	breakpoints map[int]bool
+	watches     []*Watch
+
+	// state of the execution
+	code     language.Grains
+	pc       int
+	line     int // line of the last grain executed
+	started  bool
+	action   Action
+	stepLine int // line where the current step started
+	pause    int32
+
+	// functions to run before the next grain; see Do
+	queueLock sync.Mutex
+	queue     []func()
+	queued    int32
+}
+
+// New returns a debugger for a VM, and installs it as the hook of the VM.
+// source is the source code of the program, if any, used to show its lines.
+func New(machine *vm.VM, source []byte, fe Frontend) *Debugger {
+	d := &Debugger{
+		vm:          machine,
+		fe:          fe,
+		breakpoints: make(map[int]bool),
+	}
+
+	if source != nil {
+		d.source = strings.Split(strings.TrimSuffix(string(source), "\n"), "\n")
+	}
+
+	machine.Hook = d
+	return d
+}
+
+// VM returns the VM of the debugger.
+func (d *Debugger) VM() *vm.VM {
+	return d.vm
+}
+
+// Load tells the debugger which code will be run, so that breakpoints can be
+// checked before the execution starts.
+func (d *Debugger) Load(code language.Grains) {
+	d.code = code
+}
+
+// Step implements vm.Hook.
+func (d *Debugger) Step(machine *vm.VM, code language.Grains, pc int) error {
+	if atomic.LoadInt32(&d.queued) == 1 {
+		d.runQueue()
+	}
+
+	line := code[pc].Line
+	newLine := pc == 0 || line != d.line
+
+	d.code, d.pc, d.line = code, pc, line
+
+	var reason StopReason
+
+	switch {
+	case !d.started:
+		d.started = true
+		if d.StopOnEntry {
+			reason = StopEntry
+		}
+	case atomic.CompareAndSwapInt32(&d.pause, 1, 0):
+		reason = StopPause
+	case newLine && d.breakpoints[line]:
+		reason = StopBreakpoint
+	case d.action == StepInstruction:
+		reason = StopStep
+	case (d.action == Next || d.action == StepIn) && (line != d.stepLine || line == 0):
+		reason = StopStep
+	case newLine && d.watchesChanged():
+		reason = StopWatch
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	d.updateWatches()
+	action := d.fe.Stopped(d, reason)
+	if action == Abort {
+		return ErrAborted
+	}
+
+	d.action = action
+	d.stepLine = line
+	// the frontend may have modified the variables
+	d.updateWatches()
+
+	return nil
+}
+
+// Pause stops the execution before the next grain. It can be called from
+// another goroutine.
+func (d *Debugger) Pause() {
+	atomic.StoreInt32(&d.pause, 1)
+}
+
+// Do runs f in the goroutine of the VM before the next grain. Other
+// goroutines use it to modify the debugger while the program runs.
+func (d *Debugger) Do(f func()) {
+	d.queueLock.Lock()
+	defer d.queueLock.Unlock()
+
+	d.queue = append(d.queue, f)
+	atomic.StoreInt32(&d.queued, 1)
+}
+
+func (d *Debugger) runQueue() {
+	d.queueLock.Lock()
+	queue := d.queue
+	d.queue = nil
+	atomic.StoreInt32(&d.queued, 0)
+	d.queueLock.Unlock()
+
+	for _, f := range queue {
+		f()
+	}
+}
+
+// PC returns the address of the next grain.
+func (d *Debugger) PC() int {
+	return d.pc
+}
+
+// Line returns the source line of the next grain, or 0 if it's unknown.
+func (d *Debugger) Line() int {
+	return d.line
+}
+
+// Code returns the code being executed.
+func (d *Debugger) Code() language.Grains {
+	return d.code
+}
+
+// SourceLine returns the n-th line of the source code, starting at 1.
+func (d *Debugger) SourceLine(n int) (string, bool) {
+	if n < 1 || n > len(d.source) {
+		return "", false
+	}
+	return d.source[n-1], true
+}
+
+// Frames returns the stack of frames, the innermost first.
+func (d *Debugger) Frames() []Frame {
+	// programs have no functions, so they only have the main frame
+	return []Frame{{Name: "main", Line: d.line, PC: d.pc}}
+}
+
+// Variables returns the variables of the current frame, sorted by name.
+func (d *Debugger) Variables() []Variable {
+	var vars []Variable
+	for _, name := range d.vm.Variables() {
+		v, _ := d.vm.Get(name)
+		vars = append(vars, Variable{Name: name, Value: v})
+	}
+	return vars
+}
+
+// SetBreakpoint sets a breakpoint on a source line. If the code is known, the
+// line must have some.
+func (d *Debugger) SetBreakpoint(line int) error {
+	if d.code != nil && !HasLine(d.code, line) {
+		return fmt.Errorf("No code on line %d", line)
+	}
+	d.breakpoints[line] = true
+	return nil
+}
+
+// ClearBreakpoint removes the breakpoint of a source line.
+func (d *Debugger) ClearBreakpoint(line int) {
+	delete(d.breakpoints, line)
+}
+
+// ClearBreakpoints removes all the breakpoints.
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints returns the sorted lines of the breakpoints.
+func (d *Debugger) Breakpoints() []int {
+	var lines []int
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// HasLine tests if some grains come from a source line.
+func HasLine(gs language.Grains, line int) bool {
+	for _, g := range gs {
+		if g.Line == line {
+			return true
+		}
+	}
+	return false
+}
+
+// AddWatch watches an expression.
+func (d *Debugger) AddWatch(expr string) (*Watch, error) {
+	gs, err := compileExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watch{Expr: expr, grains: gs}
+	w.Value, w.Err = d.eval(gs)
+	d.watches = append(d.watches, w)
+
+	return w, nil
+}
+
+// RemoveWatch removes the i-th watch, starting at 0.
+func (d *Debugger) RemoveWatch(i int) error {
+	if i < 0 || i >= len(d.watches) {
+		return fmt.Errorf("No watch %d", i)
+	}
+	d.watches = append(d.watches[:i], d.watches[i+1:]...)
+	return nil
+}
+
+// Watches returns the watched expressions with their last values.
+func (d *Debugger) Watches() []*Watch {
+	return d.watches
+}
+
+// watchesChanged tests if the value of a watched expression changed since
+// the last stop.
+func (d *Debugger) watchesChanged() bool {
+	for _, w := range d.watches {
+		v, err := d.eval(w.grains)
+		if (err == nil) != (w.Err == nil) || (err == nil && vm.Repr(v) != vm.Repr(w.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) updateWatches() {
+	for _, w := range d.watches {
+		w.Value, w.Err = d.eval(w.grains)
+	}
+}
+
+// Eval evaluates an expression in the current frame.
+func (d *Debugger) Eval(expr string) (vm.Value, error) {
+	gs, err := compileExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return d.eval(gs)
+}
+
+// Set sets a variable of the current frame to the value of an expression.
+func (d *Debugger) Set(name, expr string) error {
+	root, err := parser.ParseExpression(name, false)
+	if err != nil || root.Child().Type() != ast.VariableNodeType {
+		return fmt.Errorf("Invalid variable name '%s'", name)
+	}
+
+	v, err := d.Eval(expr)
+	if err != nil {
+		return err
+	}
+
+	d.vm.Set(name, v)
+	return nil
+}
+
+// eval evaluates code without stopping in it.
+func (d *Debugger) eval(gs language.Grains) (vm.Value, error) {
+	hook := d.vm.Hook
+	d.vm.Hook = nil
+	defer func() { d.vm.Hook = hook }()
+
+	return d.vm.Eval(gs)
+}
+
+func compileExpression(expr string) (language.Grains, error) {
+	root, err := parser.ParseExpression(expr, false)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression '%s'", expr)
+	}
+	return compiler.CompileGrains(root.Child())
+}
@@ -0,0 +1,199 @@
+package debugger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bfontaine/quinoa/internal/testutil"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+const source = "a = 1\nb = a + 2\nprint(a, b)\nc = b + b\n"
+
+// a frontend that records the stops and resumes with a list of actions
+type recorder struct {
+	stops   []string
+	actions []Action
+	onStop  func(d *Debugger)
+}
+
+func (r *recorder) Stopped(d *Debugger, reason StopReason) Action {
+	r.stops = append(r.stops, string(reason)+" "+strings.TrimSpace(d.Code()[d.PC()].String()))
+	if r.onStop != nil {
+		r.onStop(d)
+	}
+
+	if len(r.actions) == 0 {
+		return Continue
+	}
+	action := r.actions[0]
+	r.actions = r.actions[1:]
+	return action
+}
+
+func TestBreakpointsAndSteps(t *testing.T) {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	var frames []Frame
+
+	r := &recorder{actions: []Action{Next, StepInstruction, StepInstruction, Continue}}
+	r.onStop = func(d *Debugger) { frames = d.Frames() }
+	d := New(machine, []byte(source), r)
+	d.StopOnEntry = true
+
+	gs := testutil.Compile(t, source)
+	d.Load(gs)
+	assert.Nil(t, d.SetBreakpoint(4))
+	assert.NotNil(t, d.SetBreakpoint(5))
+	assert.Equal(t, []int{4}, d.Breakpoints())
+
+	assert.Nil(t, machine.Run(gs))
+	assert.Equal(t, []string{
+		"entry CONST  1",
+		"step CONST  2",
+		"step LOAD   a",
+		"step ADD",
+		"breakpoint LOAD   b",
+	}, r.stops)
+
+	line, _ := d.SourceLine(4)
+	assert.Equal(t, "c = b + b", line)
+	assert.Equal(t, []Frame{{Name: "main", Line: 4, PC: 12}}, frames)
+}
+
+func TestInspection(t *testing.T) {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	r := &recorder{}
+	r.onStop = func(d *Debugger) {
+		assert.Equal(t, []Variable{{"a", int64(1)}, {"b", int64(3)}}, d.Variables())
+
+		v, err := d.Eval("a + b")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), v)
+
+		_, err = d.Eval("a +")
+		assert.NotNil(t, err)
+
+		assert.Nil(t, d.Set("b", "b + 10"))
+		assert.NotNil(t, d.Set("1", "2"))
+	}
+
+	d := New(machine, nil, r)
+	assert.Nil(t, d.SetBreakpoint(4))
+
+	assert.Nil(t, machine.Run(testutil.Compile(t, source)))
+	assert.Equal(t, []string{"breakpoint LOAD   b"}, r.stops)
+
+	c, _ := machine.Get("c")
+	assert.Equal(t, int64(26), c)
+}
+
+func TestWatches(t *testing.T) {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	r := &recorder{}
+	d := New(machine, nil, r)
+
+	w, err := d.AddWatch("b + 1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), w.Value)
+
+	assert.Nil(t, machine.Run(testutil.Compile(t, source)))
+	// b changes on line 2
+	assert.Equal(t, []string{"watch LOAD   b"}, r.stops)
+	assert.Equal(t, int64(4), w.Value)
+
+	assert.Nil(t, d.RemoveWatch(0))
+	assert.NotNil(t, d.RemoveWatch(0))
+}
+
+func TestAbortAndPause(t *testing.T) {
+	machine := vm.NewVM(testing.Verbose())
+
+	r := &recorder{actions: []Action{Abort}}
+	d := New(machine, nil, r)
+	d.Pause()
+
+	err := machine.Run(testutil.Compile(t, source))
+	assert.True(t, errors.Is(err, ErrAborted))
+	// the pause happens on the first grain that isn't the entry
+	assert.Equal(t, []string{"pause STORE  a"}, r.stops)
+}
+
+func TestDo(t *testing.T) {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	r := &recorder{}
+	d := New(machine, nil, r)
+	d.Do(func() { assert.Nil(t, d.SetBreakpoint(4)) })
+
+	assert.Nil(t, machine.Run(testutil.Compile(t, source)))
+	assert.Equal(t, []string{"breakpoint LOAD   b"}, r.stops)
+}
+
+func TestConsole(t *testing.T) {
+	var out bytes.Buffer
+
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &out
+
+	commands := strings.Join([]string{
+		"n",
+		"",
+		"p a + 1",
+		"bt",
+		"locals",
+		"set a = 10",
+		"watch b",
+		"break",
+		"b 4",
+		"b 9",
+		"list",
+		"finish",
+		"foo",
+		"c",
+		"si",
+		"q",
+	}, "\n") + "\n"
+
+	d := New(machine, []byte(source), NewConsole(bufio.NewReader(strings.NewReader(commands)), &out))
+	d.StopOnEntry = true
+
+	err := machine.Run(testutil.Compile(t, source))
+	assert.True(t, errors.Is(err, ErrAborted))
+
+	assert.Equal(t, `Stopped at the entry of the program, line 1
+   1  a = 1
+(qdb)    2  b = a + 2
+(qdb)    3  print(a, b)
+(qdb) 2
+(qdb) #0  main at line 3
+(qdb) a = 1
+b = 3
+(qdb) (qdb) w0: b = 3
+(qdb) No breakpoints.
+(qdb) Breakpoint on line 4
+(qdb) error: No code on line 9
+(qdb)      1  a = 1
+     2  b = a + 2
+=>   3  print(a, b)
+     4  c = b + b
+(qdb) "finish" not meaningful in the outermost frame.
+(qdb) error: Unknown command 'foo'; see help
+(qdb) 10 3
+Breakpoint, line 4
+   4  c = b + b
+w0: b = 3
+(qdb)    4  c = b + b
+w0: b = 3
+(qdb) `, out.String())
+}
@@ -0,0 +1,262 @@
+// Package format implements the canonical formatting of Quinoa source code.
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/parser"
+)
+
+const indentation = "\t"
+
+// Source formats the given Quinoa source code. Comments are preserved.
+func Source(src []byte) ([]byte, error) {
+	root, err := parser.Parse(string(src), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return Node(root), nil
+}
+
+// Node returns the canonical source code of a program. Its comments are the
+// ones attached to the root node.
+func Node(root *ast.Node) []byte {
+	p := &printer{
+		comments: root.Comments(),
+		used:     make([]bool, len(root.Comments())),
+		owned:    make(map[*ast.Node][]ast.Comment),
+	}
+
+	p.root(root)
+	return p.buf.Bytes()
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	comments []ast.Comment
+	used     []bool
+
+	// comments placed inside multi-line function calls
+	owned map[*ast.Node][]ast.Comment
+
+	// last source line that was printed
+	line int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat(indentation, p.indent))
+}
+
+func (p *printer) comment(c ast.Comment) {
+	p.write("#")
+	p.write(strings.TrimRight(c.Text, " \t"))
+}
+
+// separate keeps at most one blank line between two elements if there was
+// at least one in the source.
+func (p *printer) separate(line int) {
+	if p.line > 0 && line > p.line+1 {
+		p.write("\n")
+	}
+}
+
+func (p *printer) root(root *ast.Node) {
+	for _, stmt := range root.Children() {
+		// leading comments
+		for i, c := range p.comments {
+			if !p.used[i] && c.End.Offset <= stmt.Pos().Offset {
+				p.used[i] = true
+				p.separate(c.Pos.Line)
+				p.comment(c)
+				p.write("\n")
+				p.line = c.Pos.Line
+			}
+		}
+
+		p.separate(stmt.Pos().Line)
+
+		// comments that can't be kept inside the statement go before it
+		for _, c := range p.assignComments(stmt) {
+			p.comment(c)
+			p.write("\n")
+		}
+
+		p.expr(stmt)
+		p.line = stmt.End().Line
+
+		// trailing comment
+		for i, c := range p.comments {
+			if !p.used[i] && c.Pos.Line == stmt.End().Line && c.Pos.Offset >= stmt.End().Offset {
+				p.used[i] = true
+				p.write(" ")
+				p.comment(c)
+				break
+			}
+		}
+
+		p.write("\n")
+	}
+
+	// comments at the end of the program
+	for i, c := range p.comments {
+		if !p.used[i] {
+			p.used[i] = true
+			p.separate(c.Pos.Line)
+			p.comment(c)
+			p.write("\n")
+			p.line = c.Pos.Line
+		}
+	}
+}
+
+func contains(n *ast.Node, c ast.Comment) bool {
+	return n.Pos().Offset <= c.Pos.Offset && c.Pos.Offset < n.End().Offset
+}
+
+func multiline(n *ast.Node) bool {
+	return n.Pos().Line != n.End().Line
+}
+
+// assignComments attaches each comment within the statement to the innermost
+// multi-line function call that contains it. It returns the remaining ones.
+func (p *printer) assignComments(stmt *ast.Node) []ast.Comment {
+	var orphans []ast.Comment
+
+	for i, c := range p.comments {
+		if p.used[i] || !contains(stmt, c) {
+			continue
+		}
+		p.used[i] = true
+
+		var owner *ast.Node
+		for n := stmt; n != nil; {
+			if n.Type() == ast.FuncCallNodeType && multiline(n) {
+				owner = n
+			}
+
+			var next *ast.Node
+			for _, ch := range n.Children() {
+				if contains(ch, c) {
+					next = ch
+					break
+				}
+			}
+			n = next
+		}
+
+		if owner == nil {
+			orphans = append(orphans, c)
+		} else {
+			p.owned[owner] = append(p.owned[owner], c)
+		}
+	}
+
+	return orphans
+}
+
+func (p *printer) expr(n *ast.Node) {
+	switch n.Type() {
+	case ast.AssignNodeType:
+		p.expr(n.Child())
+		p.write(" = ")
+		p.expr(n.SecondChild())
+
+	case ast.LitteralNodeType, ast.VariableNodeType:
+		p.write(n.Name())
+
+	case ast.UnopNodeType:
+		p.write(n.Name())
+		// the operand of an unop can't be an operation unless it has
+		// parentheses
+		p.operand(n.Child(), true)
+
+	case ast.BinopNodeType:
+		// binops are right-associative: a + b + c is a + (b + c)
+		p.operand(n.Child(), false)
+		p.write(" ")
+		p.write(n.Name())
+		p.write(" ")
+		p.expr(n.SecondChild())
+
+	case ast.FuncCallNodeType:
+		p.funcCall(n)
+	}
+}
+
+func (p *printer) operand(n *ast.Node, unop bool) {
+	if n.Type() == ast.BinopNodeType || (unop && n.Type() == ast.UnopNodeType) {
+		p.write("(")
+		p.expr(n)
+		p.write(")")
+		return
+	}
+	p.expr(n)
+}
+
+func (p *printer) funcCall(n *ast.Node) {
+	args := n.Children()
+	comments := p.owned[n]
+
+	p.write(n.Name())
+	p.write("(")
+
+	if len(comments) == 0 && (len(args) == 0 || !multiline(n)) {
+		for i, arg := range args {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(arg)
+		}
+		p.write(")")
+		return
+	}
+
+	// one argument per line, each followed by a comma
+	p.indent++
+
+	// comments before the first argument
+	for len(comments) > 0 && (len(args) == 0 || comments[0].Pos.Offset < args[0].Pos().Offset) {
+		if comments[0].Pos.Line == n.Pos().Line {
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		p.comment(comments[0])
+		comments = comments[1:]
+	}
+
+	for i, arg := range args {
+		p.newline()
+		p.expr(arg)
+		p.write(",")
+
+		for j := 0; len(comments) > 0; j++ {
+			c := comments[0]
+			if i+1 < len(args) && c.Pos.Offset >= args[i+1].Pos().Offset {
+				break
+			}
+
+			if j == 0 && c.Pos.Line == arg.End().Line {
+				p.write(" ")
+			} else {
+				p.newline()
+			}
+			p.comment(c)
+			comments = comments[1:]
+		}
+	}
+
+	p.indent--
+	p.newline()
+	p.write(")")
+}
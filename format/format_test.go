@@ -0,0 +1,114 @@
+package format
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+var formatTests = []struct {
+	code, expected string
+}{
+	{"a=1", "a = 1\n"},
+	{"a=1\n", "a = 1\n"},
+	{"a=1;b=2;;c=3", "a = 1\nb = 2\nc = 3\n"},
+	{"a  =   a+1", "a = a + 1\n"},
+	{"a = + 2", "a = +2\n"},
+	{"a = +(+2)", "a = +(+2)\n"},
+	{"a = (1 + 2) + 3", "a = (1 + 2) + 3\n"},
+	{"a = 1 + (2 + 3)", "a = 1 + 2 + 3\n"},
+	{"a = +(1 + 2)", "a = +(1 + 2)\n"},
+	{"print(a,a ,  a)", "print(a, a, a)\n"},
+	{"f    ()", "f()\n"},
+	{"f    (\n\n1\n\n)", "f(\n\t1,\n)\n"},
+	{"f(\n\t1,\n\t2,\n)", "f(\n\t1,\n\t2,\n)\n"},
+	{"f(1,\n2)", "f(\n\t1,\n\t2,\n)\n"},
+	{"f(g(h(), i(), j()), k(42))", "f(g(h(), i(), j()), k(42))\n"},
+	{"f(g(\n1), 2)", "f(\n\tg(\n\t\t1,\n\t),\n\t2,\n)\n"},
+	{"a = 1 +\n  2", "a = 1 + 2\n"},
+
+	// blank lines
+	{"a=1\n\n\n\nb=2", "a = 1\n\nb = 2\n"},
+	{"a=1\n\nb=2\nc=3", "a = 1\n\nb = 2\nc = 3\n"},
+
+	// comments
+	{"a=1#\n", "a = 1 #\n"},
+	{"a=1#x\n", "a = 1 #x\n"},
+	{"a=1   # x   \n", "a = 1 # x\n"},
+	{"# hello\na=1", "# hello\na = 1\n"},
+	{"# hello\n\n# world\na=1", "# hello\n\n# world\na = 1\n"},
+	{"a = a + 1\n\n\t          \n\n\t # end\n", "a = a + 1\n\n# end\n"},
+	{"print(a, # hey\n b)", "print(\n\ta, # hey\n\tb,\n)\n"},
+	{"print(a # hey\n, b)", "print(\n\ta, # hey\n\tb,\n)\n"},
+	{"print( # hey\n a)", "print( # hey\n\ta,\n)\n"},
+	{"print(\n # hey\n a)", "print(\n\t# hey\n\ta,\n)\n"},
+	{"print(a,\n # hey\n b)", "print(\n\ta,\n\t# hey\n\tb,\n)\n"},
+	{"print(a,\n b # hey\n)", "print(\n\ta,\n\tb, # hey\n)\n"},
+	{"f( # hey\n)", "f( # hey\n)\n"},
+	{"f(g(1, # a\n2), # b\n3)", "f(\n\tg(\n\t\t1, # a\n\t\t2,\n\t), # b\n\t3,\n)\n"},
+	{"f(\n1) # end\n", "f(\n\t1,\n) # end\n"},
+	{"a = # hey\n 1", "# hey\na = 1\n"},
+	{"a = 1 + # hey\n 2 # ho\n", "# hey\na = 1 + 2 # ho\n"},
+}
+
+func TestSource(t *testing.T) {
+	for _, tt := range formatTests {
+		t.Log(strconv.Quote(tt.code))
+
+		formatted, err := Source([]byte(tt.code))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, string(formatted))
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	for _, tt := range formatTests {
+		t.Log(strconv.Quote(tt.code))
+
+		once, err := Source([]byte(tt.code))
+		assert.Nil(t, err)
+
+		twice, err := Source(once)
+		assert.Nil(t, err)
+		assert.Equal(t, string(once), string(twice))
+	}
+}
+
+func TestSourceKeepsTheAST(t *testing.T) {
+	for _, tt := range formatTests {
+		t.Log(strconv.Quote(tt.code))
+
+		formatted, err := Source([]byte(tt.code))
+		assert.Nil(t, err)
+
+		before, err := parser.Parse(tt.code, false)
+		assert.Nil(t, err)
+		after, err := parser.Parse(string(formatted), false)
+		assert.Nil(t, err)
+
+		assert.Equal(t, before.String(), after.String())
+		assert.Equal(t, len(before.Comments()), len(after.Comments()))
+	}
+}
+
+func TestSourceInvalidProgram(t *testing.T) {
+	_, err := Source([]byte("a = 1 + "))
+	assert.NotNil(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	assert.Nil(t, Diff("a", "b", []byte("x\n"), []byte("x\n")))
+
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,3 +1,3 @@\n x\n-y\n+Y\n z\n",
+		string(Diff("a", "b", []byte("x\ny\nz\n"), []byte("x\nY\nz\n"))))
+
+	assert.Equal(t, "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n",
+		string(Diff("a", "b", []byte("x"), []byte("x\n"))))
+
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n")
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		string(Diff("a", "b", old, new)))
+}
@@ -0,0 +1,217 @@
+package quinoa
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// golden files of a program foo.qi: its grains, its optimized grains, its
+// output, the error that stopped it, and its LLVM IR if the backend supports
+// it. A missing file is an empty one.
+var goldenExts = []string{".qasm", ".O.qasm", ".out", ".err", ".ll"}
+
+// runPipeline parses, compiles and runs a program like 'quinoa run', in the
+// register machine if registers is set, with an empty input and no arguments.
+// It returns the content of its golden files, by extension.
+func runPipeline(source []byte, optimize, registers bool) map[string]string {
+	golden := make(map[string]string)
+
+	root, err := parser.Parse(string(source), false)
+	if err != nil {
+		golden[".err"] = err.Error()
+		return golden
+	}
+
+	compile := compiler.CompileGrains
+	if optimize {
+		compile = compiler.Optimize
+	}
+
+	gs, err := compile(root)
+	if err != nil {
+		golden[".err"] = err.Error()
+		return golden
+	}
+	golden[".qasm"] = language.Disassemble(gs, source)
+
+	var stdout bytes.Buffer
+	machine := vm.NewVM(false)
+	machine.Stdin = &bytes.Buffer{}
+	machine.Stdout = &stdout
+	machine.Stderr = &stdout
+
+	if registers {
+		err = runRegisters(machine, gs)
+	} else {
+		err = machine.Run(gs)
+	}
+	if err != nil {
+		golden[".err"] = err.Error()
+	}
+	golden[".out"] = stdout.String()
+
+	return golden
+}
+
+// emitLLVM compiles a program to LLVM IR like 'quinoa build -emit=llvm'. It
+// returns an empty string if the program isn't supported by the backend.
+func emitLLVM(source []byte, name string) string {
+	root, err := parser.Parse(string(source), false)
+	if err != nil {
+		return ""
+	}
+	gs, err := compiler.CompileGrains(root)
+	if err != nil {
+		return ""
+	}
+	f, err := compiler.Lift(gs)
+	if err != nil {
+		return ""
+	}
+	ir, err := compiler.LLVM(f, name)
+	if err != nil {
+		return ""
+	}
+	return string(ir)
+}
+
+// runRegisters runs grains like 'quinoa run --engine=reg'.
+func runRegisters(machine *vm.VM, gs language.Grains) error {
+	f, err := compiler.Lift(gs)
+	if err != nil {
+		return err
+	}
+	code, err := compiler.CompileRegisters(f)
+	if err != nil {
+		return err
+	}
+	return machine.RunRegisters(code)
+}
+
+func TestGolden(t *testing.T) {
+	programs, err := filepath.Glob(filepath.Join("testdata", "*.qi"))
+	assert.Nil(t, err)
+	assert.True(t, len(programs) > 0)
+
+	for _, program := range programs {
+		program := program
+		t.Run(filepath.Base(program), func(t *testing.T) {
+			source, err := ioutil.ReadFile(program)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			actual := runPipeline(source, false, false)
+
+			// neither do the optimizations and the register machine change
+			// what programs do
+			for _, registers := range []bool{false, true} {
+				for _, optimize := range []bool{false, true} {
+					if !optimize && !registers {
+						continue
+					}
+					other := runPipeline(source, optimize, registers)
+					assert.Equal(t, actual[".out"], other[".out"], "output with optimize=%v registers=%v", optimize, registers)
+					assert.Equal(t, actual[".err"], other[".err"], "error with optimize=%v registers=%v", optimize, registers)
+				}
+			}
+			optimized := runPipeline(source, true, false)
+			actual[".O.qasm"] = optimized[".qasm"]
+			actual[".ll"] = emitLLVM(source, filepath.Base(program))
+			base := strings.TrimSuffix(program, ".qi")
+
+			for _, ext := range goldenExts {
+				filename := base + ext
+				content := actual[ext]
+				if ext == ".err" && content != "" {
+					content = strings.TrimSpace(content) + "\n"
+				}
+
+				if *update {
+					updateGolden(t, filename, content)
+					continue
+				}
+
+				expected, err := ioutil.ReadFile(filename)
+				if err != nil && !os.IsNotExist(err) {
+					t.Fatal(err)
+				}
+				assert.Equal(t, string(expected), content, "%s (run 'go test -run TestGolden -update' if it's expected)", filename)
+			}
+		})
+	}
+}
+
+// updateGolden writes a golden file, or removes it if it's empty.
+func updateGolden(t *testing.T, filename, content string) {
+	if content == "" {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGoldenLLVM compiles the LLVM IR of the golden files with llc and runs
+// it, if llc and a C compiler are available.
+func TestGoldenLLVM(t *testing.T) {
+	llc, err := exec.LookPath("llc")
+	if err != nil {
+		t.Skip("llc isn't available")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("cc isn't available")
+	}
+
+	irs, err := filepath.Glob(filepath.Join("testdata", "*.ll"))
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "quinoa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, ir := range irs {
+		base := strings.TrimSuffix(filepath.Base(ir), ".ll")
+		asm := filepath.Join(dir, base+".s")
+		exe := filepath.Join(dir, base)
+
+		if out, err := exec.Command(llc, ir, "-o", asm).CombinedOutput(); err != nil {
+			t.Errorf("%s: %s\n%s", ir, err, out)
+			continue
+		}
+		if out, err := exec.Command(cc, asm, filepath.Join("runtime", "quinoa.c"), "-o", exe).CombinedOutput(); err != nil {
+			t.Errorf("%s: %s\n%s", ir, err, out)
+			continue
+		}
+
+		out, err := exec.Command(exe).CombinedOutput()
+		assert.Nil(t, err, ir)
+
+		expected, err := ioutil.ReadFile(strings.TrimSuffix(ir, ".ll") + ".out")
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(expected), string(out), ir)
+	}
+}
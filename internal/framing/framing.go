@@ -0,0 +1,51 @@
+// Package framing reads and writes the messages of the Language Server
+// Protocol and of the Debug Adapter Protocol: a header with the length of the
+// content, then the content in JSON.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// MaxLength is the maximum length of the content of a message that is read,
+// so that a peer can't make us allocate any amount of memory.
+const MaxLength = 64 << 20
+
+// Read reads the content of a message with its header.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("Invalid Content-Length header: %q", header.Get("Content-Length"))
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("Content-Length %d exceeds the limit of %d bytes", length, MaxLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// Write writes a message in JSON with its header.
+func Write(w io.Writer, msg interface{}) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
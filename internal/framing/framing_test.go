@@ -0,0 +1,45 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWrite(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, Write(&b, map[string]int{"a": 1}))
+	assert.Nil(t, Write(&b, []string{}))
+	assert.Equal(t, "Content-Length: 7\r\n\r\n{\"a\":1}Content-Length: 2\r\n\r\n[]", b.String())
+
+	r := bufio.NewReader(&b)
+	for _, expected := range []string{`{"a":1}`, "[]"} {
+		content, err := Read(r)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	_, err := Read(r)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		input, err string
+	}{
+		{"Content-Type: json\r\n\r\n{}", `Invalid Content-Length header: ""`},
+		{"Content-Length: -1\r\n\r\n{}", `Invalid Content-Length header: "-1"`},
+		{"Content-Length: 1e3\r\n\r\n{}", `Invalid Content-Length header: "1e3"`},
+		{"Content-Length: 67108865\r\n\r\n{}", "Content-Length 67108865 exceeds the limit of 67108864 bytes"},
+		{"Content-Length: 3\r\n\r\n{}", "unexpected EOF"},
+	} {
+		_, err := Read(bufio.NewReader(strings.NewReader(tc.input)))
+		if assert.NotNil(t, err, tc.input) {
+			assert.Equal(t, tc.err, err.Error(), tc.input)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package testutil has the helpers shared by the tests of the packages that
+// run programs.
+package testutil
+
+import (
+	"testing"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+)
+
+// Compile parses and compiles a program, or fails the test.
+func Compile(t testing.TB, src string) language.Grains {
+	t.Helper()
+
+	root, err := parser.Parse(src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := compiler.CompileGrains(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
+
+// Assemble assembles grains, or fails the test.
+func Assemble(t testing.TB, code string) language.Grains {
+	t.Helper()
+
+	gs, err := language.Assemble(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs
+}
@@ -0,0 +1,205 @@
+package language
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assemble parses grains in the format returned by Disassemble. Addresses
+// are optional and ignored. A "; <line>" comment sets the source line of the
+// grains that follow it; other comments are ignored.
+func Assemble(text string) (Grains, error) {
+	var gs Grains
+
+	line := 0
+
+	for n, l := range strings.Split(text, "\n") {
+		l = strings.TrimSpace(l)
+
+		comment := ""
+		if i := strings.IndexByte(l, ';'); i >= 0 {
+			l, comment = strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+		}
+
+		if l == "" {
+			// a line annotation must be alone on its line
+			if sourceLine, ok := parseLineAnnotation(comment); ok {
+				line = sourceLine
+			}
+			continue
+		}
+
+		g, err := assembleGrain(strings.Fields(l))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n+1, err)
+		}
+
+		g.Line = line
+		gs = append(gs, g)
+	}
+
+	return gs, nil
+}
+
+// parseLineAnnotation parses comments like "12" or "12: a = 1"
+func parseLineAnnotation(comment string) (int, bool) {
+	if i := strings.IndexByte(comment, ':'); i >= 0 {
+		comment = comment[:i]
+	}
+
+	line, err := strconv.Atoi(comment)
+	if err != nil || line < 0 {
+		return 0, false
+	}
+	return line, true
+}
+
+func parseOpCode(name string) (OpCode, bool) {
+	name = strings.ToUpper(name)
+
+	for op, opName := range opCodeNames {
+		if opName == name {
+			return OpCode(op), true
+		}
+	}
+	return 0, false
+}
+
+func assembleGrain(fields []string) (Grain, error) {
+	var g Grain
+
+	// optional address
+	if isAddress(fields[0]) {
+		fields = fields[1:]
+		if len(fields) == 0 {
+			return g, fmt.Errorf("missing instruction")
+		}
+	}
+
+	op, ok := parseOpCode(fields[0])
+	if !ok {
+		return g, fmt.Errorf("unknown instruction '%s'", fields[0])
+	}
+	g.OpCode = op
+
+	operands := fields[1:]
+
+	operand := func() (string, error) {
+		if len(operands) != 1 {
+			return "", fmt.Errorf("%s takes 1 operand, got %d", op, len(operands))
+		}
+		return operands[0], nil
+	}
+	variable := func(name string) (string, error) {
+		if !isName(name) {
+			return "", fmt.Errorf("invalid variable name '%s'", name)
+		}
+		return name, nil
+	}
+	constant := func(value string) (int64, error) {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid constant '%s'", value)
+		}
+		return v, nil
+	}
+
+	switch op {
+	case StoreOpCode, LoadOpCode, StorePopOpCode:
+		name, err := operand()
+		if err != nil {
+			return g, err
+		}
+		if g.Name, err = variable(name); err != nil {
+			return g, err
+		}
+		if op != LoadOpCode {
+			g.PopN = 1
+		}
+
+	case ConstOpCode, AddConstOpCode:
+		value, err := operand()
+		if err != nil {
+			return g, err
+		}
+		if g.Value, err = constant(value); err != nil {
+			return g, err
+		}
+		if op == AddConstOpCode {
+			g.PopN = 1
+		}
+
+	case IncLocalOpCode:
+		if len(operands) != 2 {
+			return g, fmt.Errorf("%s takes 2 operands, got %d", op, len(operands))
+		}
+		var err error
+		if g.Name, err = variable(operands[0]); err != nil {
+			return g, err
+		}
+		if g.Value, err = constant(operands[1]); err != nil {
+			return g, err
+		}
+
+	case AddOpCode:
+		g.Name = "+"
+		g.PopN = 2
+		if len(operands) > 0 {
+			name, err := operand()
+			if err != nil {
+				return g, err
+			}
+			g.Name = name
+		}
+
+	case CallOpCode:
+		operand, err := operand()
+		if err != nil {
+			return g, err
+		}
+
+		i := strings.LastIndexByte(operand, '/')
+		if i < 0 {
+			return g, fmt.Errorf("expected <function>/<arity>, got '%s'", operand)
+		}
+
+		name := operand[:i]
+		arity, err := strconv.Atoi(operand[i+1:])
+		if !isName(name) || err != nil || arity < 0 {
+			return g, fmt.Errorf("expected <function>/<arity>, got '%s'", operand)
+		}
+		g.Name = name
+		g.PopN = arity
+
+	case DiscardOpCode:
+		if len(operands) > 0 {
+			return g, fmt.Errorf("%s takes no operand", op)
+		}
+		g.PopN = 1
+	}
+
+	return g, nil
+}
+
+func isAddress(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isName tests if s is a valid variable or function name
+func isName(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && '0' <= c && c <= '9':
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,397 @@
+package language
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// Binary format of compiled programs:
+//
+//	header:
+//	  magic    "\x7fQBC"
+//	  version  uint16
+//	  checksum uint32, CRC-32 (IEEE) of the sections
+//	sections, in this order:
+//	  id       byte
+//	  length   uint32
+//	  payload  length bytes
+//
+// Fixed-size integers are little-endian. Payloads are made of varints:
+//
+//	constants: count, then each constant (signed)
+//	strings:   count, then each string as its length followed by its bytes
+//	code:      count, then each grain as its opcode followed by its operands:
+//	             STORE, LOAD, ADD, STOREPOP: string index
+//	             CONST, ADDCONST: constant index
+//	             CALL: string index, arity
+//	             INCLOCAL: string index, constant index
+//	lines:     count, then (number of grains, source line) pairs that
+//	           cover the code in order
+
+// BytecodeVersion is the version of the binary format written by
+// MarshalBytecode. Version 2 added STOREPOP, ADDCONST and INCLOCAL.
+const BytecodeVersion = 2
+
+var bytecodeMagic = []byte("\x7fQBC")
+
+const bytecodeHeaderSize = 4 + 2 + 4
+
+const (
+	constantsSection byte = iota + 1
+	stringsSection
+	codeSection
+	linesSection
+)
+
+// IsBytecode tests if data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, bytecodeMagic)
+}
+
+// MarshalBytecode encodes grains in the binary format.
+func MarshalBytecode(gs Grains) []byte {
+	var constants, strs, code, lines bytecodeWriter
+
+	constantIndexes := make(map[int64]int)
+	stringIndexes := make(map[string]int)
+
+	constant := func(v int64) int {
+		i, ok := constantIndexes[v]
+		if !ok {
+			i = len(constantIndexes)
+			constantIndexes[v] = i
+			constants.varint(v)
+		}
+		return i
+	}
+	str := func(s string) int {
+		i, ok := stringIndexes[s]
+		if !ok {
+			i = len(stringIndexes)
+			stringIndexes[s] = i
+			strs.uvarint(len(s))
+			strs.WriteString(s)
+		}
+		return i
+	}
+
+	code.uvarint(len(gs))
+	for _, g := range gs {
+		code.WriteByte(byte(g.OpCode))
+
+		switch g.OpCode {
+		case StoreOpCode, LoadOpCode, AddOpCode, StorePopOpCode:
+			code.uvarint(str(g.Name))
+		case ConstOpCode, AddConstOpCode:
+			code.uvarint(constant(g.Value))
+		case IncLocalOpCode:
+			code.uvarint(str(g.Name))
+			code.uvarint(constant(g.Value))
+		case CallOpCode:
+			code.uvarint(str(g.Name))
+			code.uvarint(g.PopN)
+		}
+	}
+
+	// run-length encoding of the lines
+	var runs [][2]int
+	for i, g := range gs {
+		if i == 0 || g.Line != runs[len(runs)-1][1] {
+			runs = append(runs, [2]int{0, g.Line})
+		}
+		runs[len(runs)-1][0]++
+	}
+	lines.uvarint(len(runs))
+	for _, run := range runs {
+		lines.uvarint(run[0])
+		lines.uvarint(run[1])
+	}
+
+	var sections bytes.Buffer
+	for _, section := range []struct {
+		id      byte
+		payload []byte
+		count   int
+	}{
+		{constantsSection, constants.Bytes(), len(constantIndexes)},
+		{stringsSection, strs.Bytes(), len(stringIndexes)},
+		{codeSection, code.Bytes(), -1},
+		{linesSection, lines.Bytes(), -1},
+	} {
+		var payload bytecodeWriter
+		if section.count >= 0 {
+			payload.uvarint(section.count)
+		}
+		payload.Write(section.payload)
+
+		sections.WriteByte(section.id)
+		binary.Write(&sections, binary.LittleEndian, uint32(payload.Len()))
+		sections.Write(payload.Bytes())
+	}
+
+	var b bytes.Buffer
+	b.Write(bytecodeMagic)
+	binary.Write(&b, binary.LittleEndian, uint16(BytecodeVersion))
+	binary.Write(&b, binary.LittleEndian, crc32.ChecksumIEEE(sections.Bytes()))
+	b.Write(sections.Bytes())
+
+	return b.Bytes()
+}
+
+type bytecodeWriter struct {
+	bytes.Buffer
+}
+
+func (w *bytecodeWriter) uvarint(n int) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], uint64(n))])
+}
+
+func (w *bytecodeWriter) varint(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+// ErrInvalidBytecode is returned, possibly wrapped, when decoding data that
+// isn't a valid compiled program.
+var ErrInvalidBytecode = errors.New("Invalid bytecode")
+
+func invalidBytecode(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBytecode, fmt.Sprintf(format, args...))
+}
+
+// UnmarshalBytecode decodes grains in the binary format. The data is fully
+// validated, so the grains are well-formed if it returns no error.
+func UnmarshalBytecode(data []byte) (Grains, error) {
+	if len(data) < bytecodeHeaderSize || !IsBytecode(data) {
+		return nil, invalidBytecode("not a compiled program")
+	}
+
+	version := binary.LittleEndian.Uint16(data[4:])
+	if version != BytecodeVersion {
+		return nil, invalidBytecode("unsupported version %d, expected %d", version, BytecodeVersion)
+	}
+
+	checksum := binary.LittleEndian.Uint32(data[6:])
+	data = data[bytecodeHeaderSize:]
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, invalidBytecode("bad checksum; the file is corrupted")
+	}
+
+	var payloads [linesSection + 1][]byte
+	for id := constantsSection; id <= linesSection; id++ {
+		if len(data) < 5 {
+			return nil, invalidBytecode("missing section %d", id)
+		}
+		if data[0] != id {
+			return nil, invalidBytecode("expected section %d, got %d", id, data[0])
+		}
+
+		length := binary.LittleEndian.Uint32(data[1:])
+		data = data[5:]
+		if uint64(length) > uint64(len(data)) {
+			return nil, invalidBytecode("section %d is truncated", id)
+		}
+
+		payloads[id], data = data[:length], data[length:]
+	}
+	if len(data) > 0 {
+		return nil, invalidBytecode("%d unexpected bytes after the sections", len(data))
+	}
+
+	var constants []int64
+	r := &bytecodeReader{data: payloads[constantsSection], section: "constants"}
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		constants = append(constants, r.varint())
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	var strs []string
+	r = &bytecodeReader{data: payloads[stringsSection], section: "strings"}
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		strs = append(strs, string(r.bytes(r.count())))
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	r = &bytecodeReader{data: payloads[codeSection], section: "code"}
+
+	index := func(kind string, max int) int {
+		i := r.uvarint()
+		if r.err == nil && i >= uint64(max) {
+			r.fail("%s index %d out of range", kind, i)
+		}
+		return int(i)
+	}
+	name := func() string {
+		i := index("string", len(strs))
+		if r.err != nil {
+			return ""
+		}
+		if !isName(strs[i]) && strs[i] != "+" {
+			r.fail("invalid name %q", strs[i])
+		}
+		return strs[i]
+	}
+
+	gs := make(Grains, r.count())
+	for i := 0; i < len(gs) && r.err == nil; i++ {
+		g := &gs[i]
+		g.OpCode = OpCode(r.byte())
+
+		switch g.OpCode {
+		case StoreOpCode:
+			g.Name = name()
+			g.PopN = 1
+		case LoadOpCode:
+			g.Name = name()
+		case ConstOpCode:
+			if c := index("constant", len(constants)); r.err == nil {
+				g.Value = constants[c]
+			}
+		case AddOpCode:
+			g.Name = name()
+			g.PopN = 2
+		case CallOpCode:
+			g.Name = name()
+			if arity := r.uvarint(); arity > math.MaxInt32 {
+				r.fail("arity %d is too large", arity)
+			} else {
+				g.PopN = int(arity)
+			}
+		case DiscardOpCode:
+			g.PopN = 1
+		case StorePopOpCode:
+			g.Name = name()
+			g.PopN = 1
+		case AddConstOpCode:
+			if c := index("constant", len(constants)); r.err == nil {
+				g.Value = constants[c]
+			}
+			g.PopN = 1
+		case IncLocalOpCode:
+			g.Name = name()
+			if c := index("constant", len(constants)); r.err == nil {
+				g.Value = constants[c]
+			}
+		default:
+			r.fail("unknown opcode %d at %04d", g.OpCode, i)
+		}
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	r = &bytecodeReader{data: payloads[linesSection], section: "lines"}
+	covered := 0
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		count, line := r.uvarint(), r.uvarint()
+		if r.err == nil && (count == 0 || count > uint64(len(gs)-covered) || line > uint64(^uint32(0))) {
+			r.fail("invalid entry (%d, %d)", count, line)
+		}
+		for ; count > 0 && r.err == nil; count-- {
+			gs[covered].Line = int(line)
+			covered++
+		}
+	}
+	if r.err == nil && covered != len(gs) {
+		r.fail("%d grains have no line", len(gs)-covered)
+	}
+	if err := r.end(); err != nil {
+		return nil, err
+	}
+
+	return gs, nil
+}
+
+// bytecodeReader reads the payload of a section. Its first error is kept in
+// err and makes subsequent reads no-ops.
+type bytecodeReader struct {
+	data    []byte
+	section string
+	err     error
+}
+
+func (r *bytecodeReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = invalidBytecode("%s section: %s", r.section, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *bytecodeReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.fail("truncated")
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *bytecodeReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.fail("truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *bytecodeReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *bytecodeReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a number of elements or bytes, which can't exceed the remaining
+// size of the payload.
+func (r *bytecodeReader) count() int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.data)) {
+		r.fail("count %d is too large", n)
+		return 0
+	}
+	return int(n)
+}
+
+// end checks that the whole payload has been read.
+func (r *bytecodeReader) end() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d unexpected bytes", len(r.data))
+	}
+	return r.err
+}
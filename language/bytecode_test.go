@@ -0,0 +1,131 @@
+package language
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	for _, gs := range []Grains{
+		{},
+		sampleGrains,
+		superGrains,
+		{
+			{OpCode: ConstOpCode, Value: -9223372036854775808},
+			{OpCode: ConstOpCode, Value: 9223372036854775807, Line: 1000000},
+			{OpCode: CallOpCode, Name: "f", PopN: 300, Line: 1000000},
+		},
+	} {
+		data := MarshalBytecode(gs)
+		assert.True(t, IsBytecode(data))
+
+		decoded, err := UnmarshalBytecode(data)
+		assert.Nil(t, err)
+		assert.Equal(t, len(gs), len(decoded))
+		if len(gs) > 0 {
+			assert.Equal(t, gs, decoded)
+		}
+	}
+}
+
+func TestBytecodeSharesConstantsAndStrings(t *testing.T) {
+	gs := Grains{
+		{OpCode: LoadOpCode, Name: "abcdefgh"},
+		{OpCode: LoadOpCode, Name: "abcdefgh"},
+		{OpCode: ConstOpCode, Value: 1 << 40},
+		{OpCode: ConstOpCode, Value: 1 << 40},
+	}
+	assert.True(t, len(MarshalBytecode(gs)) < len(MarshalBytecode(append(gs, gs...))))
+	assert.Equal(t, len(MarshalBytecode(gs[:1]))+2, len(MarshalBytecode(gs[:2])))
+}
+
+// withChecksum fixes the checksum of modified bytecode
+func withChecksum(data []byte) []byte {
+	binary.LittleEndian.PutUint32(data[6:], crc32.ChecksumIEEE(data[bytecodeHeaderSize:]))
+	return data
+}
+
+func assertInvalidBytecode(t *testing.T, data []byte, msg string) {
+	t.Helper()
+
+	_, err := UnmarshalBytecode(data)
+	if assert.NotNil(t, err, msg) {
+		assert.True(t, errors.Is(err, ErrInvalidBytecode), msg)
+	}
+}
+
+func TestBytecodeCorruptedFiles(t *testing.T) {
+	data := MarshalBytecode(sampleGrains)
+
+	// any modified byte is detected
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 0x10
+		assertInvalidBytecode(t, corrupted, "modified byte")
+	}
+
+	for n := 0; n < len(data); n++ {
+		assertInvalidBytecode(t, data[:n], "truncated")
+	}
+
+	assertInvalidBytecode(t, append(append([]byte(nil), data...), 0), "trailing byte")
+	assertInvalidBytecode(t, []byte("a = 1\n"), "source code")
+}
+
+func TestBytecodeInvalidContent(t *testing.T) {
+	// valid checksums but invalid content
+	for _, section := range [][]byte{
+		// unknown opcode
+		{3, 3, 0, 0, 0, 1, 0x7f, 0},
+		// out of range string
+		{3, 3, 0, 0, 0, 1, byte(LoadOpCode), 0},
+		// out of range constant
+		{3, 3, 0, 0, 0, 1, byte(ConstOpCode), 0},
+		// count larger than the section
+		{3, 2, 0, 0, 0, 100, byte(DiscardOpCode)},
+		// truncated grain
+		{3, 2, 0, 0, 0, 2, byte(DiscardOpCode)},
+	} {
+		data := []byte("\x7fQBC\x02\x00\x00\x00\x00\x00")
+		data = append(data, 1, 1, 0, 0, 0, 0) // no constants
+		data = append(data, 2, 1, 0, 0, 0, 0) // no strings
+		data = append(data, section...)
+		data = append(data, 4, 3, 0, 0, 0, 1, 1, 0) // one grain on line 0
+		assertInvalidBytecode(t, withChecksum(data), "invalid code")
+	}
+
+	valid := []byte("\x7fQBC\x02\x00\x00\x00\x00\x00")
+	valid = append(valid, 1, 1, 0, 0, 0, 0)
+	valid = append(valid, 2, 3, 0, 0, 0, 1, 1, '1') // "1" isn't a valid name
+	valid = append(valid, 3, 3, 0, 0, 0, 1, byte(LoadOpCode), 0)
+	valid = append(valid, 4, 3, 0, 0, 0, 1, 1, 0)
+	assertInvalidBytecode(t, withChecksum(valid), "invalid name")
+
+	// lines that don't cover the code
+	data := MarshalBytecode(Grains{{OpCode: DiscardOpCode}, {OpCode: DiscardOpCode}})
+	data[len(data)-2] = 1
+	assertInvalidBytecode(t, withChecksum(data), "lines")
+
+	// other version
+	data = MarshalBytecode(sampleGrains)
+	data[4] = 3
+	assertInvalidBytecode(t, data, "version")
+}
+
+func TestBytecodeOldVersion(t *testing.T) {
+	// the superinstructions are rejected by the loaders of version 1, so
+	// they must reject the version first
+	data := MarshalBytecode(superGrains)
+	assert.Equal(t, []byte{2, 0}, data[4:6])
+
+	data[4] = 1
+	_, err := UnmarshalBytecode(data)
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrInvalidBytecode))
+		assert.Equal(t, "Invalid bytecode: unsupported version 1, expected 2", err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package language
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Operand returns the textual representation of the grain's operand, or an
+// empty string if it has none.
+func (g Grain) Operand() string {
+	switch g.OpCode {
+	case StoreOpCode, LoadOpCode, StorePopOpCode:
+		return g.Name
+	case ConstOpCode, AddConstOpCode:
+		return fmt.Sprintf("%d", g.Value)
+	case IncLocalOpCode:
+		return fmt.Sprintf("%s %d", g.Name, g.Value)
+	case AddOpCode:
+		if g.Name != "+" {
+			return g.Name
+		}
+	case CallOpCode:
+		return fmt.Sprintf("%s/%d", g.Name, g.PopN)
+	}
+	return ""
+}
+
+// String returns the grain in the assembly format, e.g. "CALL   print/2".
+func (g Grain) String() string {
+	operand := g.Operand()
+	if operand == "" {
+		return g.OpCode.String()
+	}
+	return fmt.Sprintf("%-6s %s", g.OpCode, operand)
+}
+
+// Disassemble returns the grains in the assembly format, one per line and
+// prefixed by its address. Each group of grains that come from the same source
+// line is preceded by a "; <line>" comment, followed by the line itself if
+// source is not nil.
+func Disassemble(gs Grains, source []byte) string {
+	var b bytes.Buffer
+	var lines []string
+
+	if source != nil {
+		lines = strings.Split(string(source), "\n")
+	}
+
+	line := 0
+	for i, g := range gs {
+		if g.Line != line {
+			line = g.Line
+
+			fmt.Fprintf(&b, "; %d", line)
+			if line > 0 && line <= len(lines) {
+				if text := strings.TrimSpace(lines[line-1]); text != "" {
+					fmt.Fprintf(&b, ": %s", text)
+				}
+			}
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "%04d  %s\n", i, g)
+	}
+
+	return b.String()
+}
@@ -1,5 +1,7 @@
 package language
 
+import "fmt"
+
 type OpCode int8
 
 // load(name) -- push 1
@@ -8,6 +10,12 @@ type OpCode int8
 // store(name) -- peek 1
 // call(name, N) -- pop N, push 1
 // discard() -- pop 1
+//
+// Superinstructions, emitted by the peephole optimizer:
+//
+// storepop(name) -- pop 1: store(name) then discard()
+// addconst(value) -- pop 1, push 1: adds the value on the right of the top
+// inclocal(name, value) -- name = name + value
 
 const (
 	StoreOpCode OpCode = iota
@@ -16,18 +24,43 @@ const (
 	AddOpCode
 	CallOpCode
 	DiscardOpCode
+	StorePopOpCode
+	AddConstOpCode
+	IncLocalOpCode
 )
 
+var opCodeNames = [...]string{
+	StoreOpCode:   "STORE",
+	LoadOpCode:    "LOAD",
+	ConstOpCode:   "CONST",
+	AddOpCode:     "ADD",
+	CallOpCode:    "CALL",
+	DiscardOpCode: "DISCARD",
+
+	StorePopOpCode: "STOREPOP",
+	AddConstOpCode: "ADDCONST",
+	IncLocalOpCode: "INCLOCAL",
+}
+
+func (op OpCode) String() string {
+	if op < 0 || int(op) >= len(opCodeNames) {
+		return fmt.Sprintf("OPCODE(%d)", op)
+	}
+	return opCodeNames[op]
+}
+
 // A Grain represents an instruction in the intermediate representation
 type Grain struct {
 	OpCode OpCode
 	Name   string
 	Value  int64
 	PopN   int
+
+	// Line is the line of the source code the grain comes from, or 0 if it's
+	// unknown.
+	Line int
 }
 
 // Grains represents a sequence of instructions in the intermediate
 // representation.
 type Grains []Grain
-
-// TODO tests
@@ -0,0 +1,117 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sampleGrains = Grains{
+	{OpCode: ConstOpCode, Value: 1, Line: 1},
+	{OpCode: StoreOpCode, Name: "a", PopN: 1, Line: 1},
+	{OpCode: DiscardOpCode, PopN: 1, Line: 1},
+	{OpCode: ConstOpCode, Value: -2, Line: 3},
+	{OpCode: LoadOpCode, Name: "a", Line: 3},
+	{OpCode: AddOpCode, Name: "+", PopN: 2, Line: 3},
+	{OpCode: LoadOpCode, Name: "a", Line: 3},
+	{OpCode: CallOpCode, Name: "print", PopN: 2, Line: 3},
+	{OpCode: DiscardOpCode, PopN: 1, Line: 3},
+}
+
+const sampleSource = "a = 1\n\nprint(a, a + -2)\n"
+
+const sampleAssembly = `; 1: a = 1
+0000  CONST  1
+0001  STORE  a
+0002  DISCARD
+; 3: print(a, a + -2)
+0003  CONST  -2
+0004  LOAD   a
+0005  ADD
+0006  LOAD   a
+0007  CALL   print/2
+0008  DISCARD
+`
+
+// the superinstructions of the peephole optimizer
+var superGrains = Grains{
+	{OpCode: ConstOpCode, Value: 1, Line: 1},
+	{OpCode: StorePopOpCode, Name: "a", PopN: 1, Line: 1},
+	{OpCode: IncLocalOpCode, Name: "a", Value: -2, Line: 2},
+	{OpCode: LoadOpCode, Name: "a", Line: 3},
+	{OpCode: AddConstOpCode, Value: 3, PopN: 1, Line: 3},
+	{OpCode: StorePopOpCode, Name: "b", PopN: 1, Line: 3},
+}
+
+const superAssembly = `; 1
+0000  CONST  1
+0001  STOREPOP a
+; 2
+0002  INCLOCAL a -2
+; 3
+0003  LOAD   a
+0004  ADDCONST 3
+0005  STOREPOP b
+`
+
+func TestGrainString(t *testing.T) {
+	assert.Equal(t, "LOAD   a", Grain{OpCode: LoadOpCode, Name: "a"}.String())
+	assert.Equal(t, "CALL   print/2", Grain{OpCode: CallOpCode, Name: "print", PopN: 2}.String())
+	assert.Equal(t, "DISCARD", Grain{OpCode: DiscardOpCode, PopN: 1}.String())
+	assert.Equal(t, "OPCODE(42)", Grain{OpCode: 42}.String())
+}
+
+func TestDisassemble(t *testing.T) {
+	assert.Equal(t, sampleAssembly, Disassemble(sampleGrains, []byte(sampleSource)))
+}
+
+func TestAssemble(t *testing.T) {
+	gs, err := Assemble(sampleAssembly)
+	assert.Nil(t, err)
+	assert.Equal(t, sampleGrains, gs)
+
+	// without the source
+	gs, err = Assemble(Disassemble(sampleGrains, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, sampleGrains, gs)
+
+	assert.Equal(t, superAssembly, Disassemble(superGrains, nil))
+	gs, err = Assemble(superAssembly)
+	assert.Nil(t, err)
+	assert.Equal(t, superGrains, gs)
+
+	// addresses and annotations are optional
+	gs, err = Assemble("const 1 ; one\n  load x\n\ncall f/0")
+	assert.Nil(t, err)
+	assert.Equal(t, Grains{
+		{OpCode: ConstOpCode, Value: 1},
+		{OpCode: LoadOpCode, Name: "x"},
+		{OpCode: CallOpCode, Name: "f", PopN: 0},
+	}, gs)
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for _, code := range []string{
+		"FOO",
+		"0001",
+		"LOAD",
+		"LOAD a b",
+		"LOAD 1a",
+		"CONST a",
+		"CALL print",
+		"CALL print/x",
+		"CALL /1",
+		"DISCARD 1",
+		"STOREPOP",
+		"ADDCONST a",
+		"INCLOCAL a",
+		"INCLOCAL 1 1",
+		"INCLOCAL a b",
+	} {
+		_, err := Assemble("CONST 1\n" + code)
+		assert.NotNil(t, err, code)
+		if err != nil {
+			assert.Contains(t, err.Error(), "line 2: ")
+		}
+	}
+}
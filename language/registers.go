@@ -0,0 +1,180 @@
+package language
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// RegOpCode is the operation of an instruction of the register machine.
+type RegOpCode int8
+
+// dst = const(value)
+// dst = load(name)
+// store(name, arg0)
+// dst = add(arg0, arg1)
+// dst = addconst(arg0, value) -- adds the value on the right of arg0
+// dst = call(name, args...)
+
+const (
+	RegConstOpCode RegOpCode = iota
+	RegLoadOpCode
+	RegStoreOpCode
+	RegAddOpCode
+	RegAddConstOpCode
+	RegCallOpCode
+)
+
+var regOpCodeNames = [...]string{
+	RegConstOpCode:    "CONST",
+	RegLoadOpCode:     "LOAD",
+	RegStoreOpCode:    "STORE",
+	RegAddOpCode:      "ADD",
+	RegAddConstOpCode: "ADDCONST",
+	RegCallOpCode:     "CALL",
+}
+
+func (op RegOpCode) String() string {
+	if op < 0 || int(op) >= len(regOpCodeNames) {
+		return fmt.Sprintf("REGOPCODE(%d)", op)
+	}
+	return regOpCodeNames[op]
+}
+
+// A RegInstr is a three-address instruction of the register machine: it
+// reads its argument registers and writes its result in its destination
+// register.
+type RegInstr struct {
+	OpCode RegOpCode
+	Dst    int
+	Args   []int
+	Name   string
+	Value  int64
+
+	// Line is the line of the source code the instruction comes from, or 0
+	// if it's unknown.
+	Line int
+}
+
+// hasDst tests if the instruction writes a register.
+func (inst RegInstr) hasDst() bool { return inst.OpCode != RegStoreOpCode }
+
+func (inst RegInstr) String() string {
+	var b bytes.Buffer
+
+	if inst.hasDst() {
+		fmt.Fprintf(&b, "r%d = ", inst.Dst)
+	}
+	b.WriteString(inst.OpCode.String())
+
+	args := make([]string, len(inst.Args))
+	for i, r := range inst.Args {
+		args[i] = fmt.Sprintf("r%d", r)
+	}
+
+	switch inst.OpCode {
+	case RegConstOpCode:
+		fmt.Fprintf(&b, " %d", inst.Value)
+	case RegLoadOpCode:
+		fmt.Fprintf(&b, " %s", inst.Name)
+	case RegStoreOpCode:
+		fmt.Fprintf(&b, " %s", inst.Name)
+		for _, arg := range args {
+			fmt.Fprintf(&b, ", %s", arg)
+		}
+	case RegAddConstOpCode:
+		for _, arg := range args {
+			fmt.Fprintf(&b, " %s,", arg)
+		}
+		fmt.Fprintf(&b, " %d", inst.Value)
+	case RegCallOpCode:
+		fmt.Fprintf(&b, " %s(", inst.Name)
+		for i, arg := range args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(arg)
+		}
+		b.WriteByte(')')
+	default:
+		for i, arg := range args {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, " %s", arg)
+		}
+	}
+
+	return b.String()
+}
+
+// RegCode is the code of the register machine. Like grains, it has no jumps.
+type RegCode struct {
+	Instrs []RegInstr
+
+	// NumRegs is the number of registers used by the instructions.
+	NumRegs int
+}
+
+// String returns the instructions with their addresses, one per line.
+func (c *RegCode) String() string {
+	var b bytes.Buffer
+	for pc, inst := range c.Instrs {
+		fmt.Fprintf(&b, "%04d  %s\n", pc, inst)
+	}
+	return b.String()
+}
+
+// Verify checks that the instructions are well-formed, and only read
+// registers that were written before.
+func (c *RegCode) Verify() error {
+	written := make([]bool, c.NumRegs)
+
+	for pc, inst := range c.Instrs {
+		fail := func(format string, args ...interface{}) error {
+			msg := fmt.Sprintf("Invalid instruction at %04d (%s)", pc, inst)
+			if inst.Line > 0 {
+				msg += fmt.Sprintf(" on line %d", inst.Line)
+			}
+			return fmt.Errorf(msg+": "+format, args...)
+		}
+
+		var nargs int
+		switch inst.OpCode {
+		case RegConstOpCode, RegLoadOpCode:
+			nargs = 0
+		case RegStoreOpCode, RegAddConstOpCode:
+			nargs = 1
+		case RegAddOpCode:
+			nargs = 2
+		case RegCallOpCode:
+			nargs = len(inst.Args)
+		default:
+			return fail("unknown opcode %d", inst.OpCode)
+		}
+
+		if len(inst.Args) != nargs {
+			return fail("expected %d registers, got %d", nargs, len(inst.Args))
+		}
+		if (inst.OpCode == RegLoadOpCode || inst.OpCode == RegStoreOpCode || inst.OpCode == RegCallOpCode) && inst.Name == "" {
+			return fail("missing name")
+		}
+
+		for _, r := range inst.Args {
+			if r < 0 || r >= c.NumRegs {
+				return fail("register r%d is out of range", r)
+			}
+			if !written[r] {
+				return fail("register r%d is read before being written", r)
+			}
+		}
+
+		if inst.hasDst() {
+			if inst.Dst < 0 || inst.Dst >= c.NumRegs {
+				return fail("register r%d is out of range", inst.Dst)
+			}
+			written[inst.Dst] = true
+		}
+	}
+
+	return nil
+}
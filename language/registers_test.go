@@ -0,0 +1,62 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a = 1; b = a + x; print(b + 2, a)
+var sampleRegCode = &RegCode{
+	Instrs: []RegInstr{
+		{OpCode: RegConstOpCode, Dst: 0, Value: 1, Line: 1},
+		{OpCode: RegStoreOpCode, Name: "a", Args: []int{0}, Line: 1},
+		{OpCode: RegLoadOpCode, Dst: 1, Name: "x", Line: 2},
+		{OpCode: RegAddOpCode, Dst: 1, Args: []int{0, 1}, Line: 2},
+		{OpCode: RegStoreOpCode, Name: "b", Args: []int{1}, Line: 2},
+		{OpCode: RegAddConstOpCode, Dst: 1, Args: []int{1}, Value: 2, Line: 3},
+		{OpCode: RegCallOpCode, Dst: 0, Name: "print", Args: []int{1, 0}, Line: 3},
+	},
+	NumRegs: 2,
+}
+
+func TestRegCodeString(t *testing.T) {
+	assert.Equal(t, `0000  r0 = CONST 1
+0001  STORE a, r0
+0002  r1 = LOAD x
+0003  r1 = ADD r0, r1
+0004  STORE b, r1
+0005  r1 = ADDCONST r1, 2
+0006  r0 = CALL print(r1, r0)
+`, sampleRegCode.String())
+
+	assert.Equal(t, "REGOPCODE(42)", RegOpCode(42).String())
+}
+
+func TestRegCodeVerify(t *testing.T) {
+	assert.Nil(t, sampleRegCode.Verify())
+	assert.Nil(t, (&RegCode{}).Verify())
+
+	for _, tt := range []struct {
+		inst RegInstr
+		err  string
+	}{
+		{RegInstr{OpCode: RegAddOpCode, Dst: 0, Args: []int{0}},
+			"Invalid instruction at 0000 (r0 = ADD r0): expected 2 registers, got 1"},
+		{RegInstr{OpCode: RegStoreOpCode, Args: []int{0}, Line: 3},
+			"Invalid instruction at 0000 (STORE , r0) on line 3: missing name"},
+		{RegInstr{OpCode: RegStoreOpCode, Name: "a", Args: []int{0}},
+			"Invalid instruction at 0000 (STORE a, r0): register r0 is read before being written"},
+		{RegInstr{OpCode: RegCallOpCode, Dst: 0, Name: "f", Args: []int{2}},
+			"Invalid instruction at 0000 (r0 = CALL f(r2)): register r2 is out of range"},
+		{RegInstr{OpCode: RegConstOpCode, Dst: 1},
+			"Invalid instruction at 0000 (r1 = CONST 0): register r1 is out of range"},
+		{RegInstr{OpCode: 42},
+			"Invalid instruction at 0000 (r0 = REGOPCODE(42)): unknown opcode 42"},
+	} {
+		err := (&RegCode{Instrs: []RegInstr{tt.inst}, NumRegs: 1}).Verify()
+		if assert.NotNil(t, err, tt.err) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package language
+
+import (
+	"fmt"
+)
+
+// A VerifyError describes why grains were rejected by Verify.
+type VerifyError struct {
+	// Address of the invalid grain
+	PC    int
+	Grain Grain
+	Msg   string
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("Invalid grain at %04d (%s)", e.PC, e.Grain)
+	if e.Grain.Line > 0 {
+		msg += fmt.Sprintf(" on line %d", e.Grain.Line)
+	}
+	return msg + ": " + e.Msg
+}
+
+// A Verification is the result of the static analysis of grains.
+type Verification struct {
+	// Depths[i] is the depth of the stack before the execution of the i-th
+	// grain, and Depths[len(grains)] its depth at the end.
+	Depths []int
+
+	// MaxDepth is the maximum depth of the stack during the execution.
+	MaxDepth int
+}
+
+// Verify checks that grains are well-formed and can't underflow the stack.
+// It computes the depth of the stack at every grain, assuming it's empty at
+// the beginning. There are no jumps, so each grain has only one predecessor.
+func Verify(gs Grains) (*Verification, error) {
+	v := &Verification{
+		Depths: make([]int, len(gs)+1),
+	}
+
+	depth := 0
+
+	for pc, g := range gs {
+		fail := func(format string, args ...interface{}) error {
+			return &VerifyError{PC: pc, Grain: g, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		v.Depths[pc] = depth
+
+		var pops, pushes, popN int
+
+		switch g.OpCode {
+		case StoreOpCode:
+			// the value is only peeked
+			pops, pushes, popN = 1, 1, 1
+		case LoadOpCode:
+			pushes = 1
+		case ConstOpCode:
+			pushes = 1
+		case AddOpCode:
+			pops, pushes, popN = 2, 1, 2
+		case CallOpCode:
+			if g.PopN < 0 {
+				return nil, fail("negative number of arguments")
+			}
+			pops, pushes, popN = g.PopN, 1, g.PopN
+		case DiscardOpCode:
+			pops, popN = 1, 1
+		case StorePopOpCode:
+			pops, popN = 1, 1
+		case AddConstOpCode:
+			pops, pushes, popN = 1, 1, 1
+		case IncLocalOpCode:
+		default:
+			return nil, fail("unknown opcode %d", g.OpCode)
+		}
+
+		switch g.OpCode {
+		case StoreOpCode, LoadOpCode, CallOpCode, StorePopOpCode, IncLocalOpCode:
+			if !isName(g.Name) {
+				return nil, fail("invalid name %q", g.Name)
+			}
+		case AddOpCode:
+			if g.Name != "+" {
+				return nil, fail("unsupported operator %q", g.Name)
+			}
+		}
+
+		if g.PopN != popN {
+			return nil, fail("expected PopN to be %d, got %d", popN, g.PopN)
+		}
+
+		if depth < pops {
+			return nil, fail("stack underflow: pops %d values but the stack has %d", pops, depth)
+		}
+
+		depth += pushes - pops
+		if depth > v.MaxDepth {
+			v.MaxDepth = depth
+		}
+	}
+
+	v.Depths[len(gs)] = depth
+
+	return v, nil
+}
@@ -0,0 +1,63 @@
+package language
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	v, err := Verify(sampleGrains)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 1, 0, 1, 2, 1, 2, 1, 0}, v.Depths)
+	assert.Equal(t, 2, v.MaxDepth)
+
+	v, err = Verify(superGrains)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 0, 0, 1, 1, 0}, v.Depths)
+
+	v, err = Verify(Grains{})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0}, v.Depths)
+	assert.Equal(t, 0, v.MaxDepth)
+
+	// an expression leaves its value on the stack
+	v, err = Verify(Grains{{OpCode: ConstOpCode, Value: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1}, v.Depths)
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for _, tt := range []struct {
+		code string
+		err  string
+	}{
+		{"DISCARD", "Invalid grain at 0000 (DISCARD): stack underflow: pops 1 values but the stack has 0"},
+		{"; 3\nCONST 1\nADD", "Invalid grain at 0001 (ADD) on line 3: stack underflow: pops 2 values but the stack has 1"},
+		{"CONST 1\nCALL f/2", "Invalid grain at 0001 (CALL   f/2): stack underflow: pops 2 values but the stack has 1"},
+		{"STORE a", "Invalid grain at 0000 (STORE  a): stack underflow: pops 1 values but the stack has 0"},
+	} {
+		gs, err := Assemble(tt.code)
+		assert.Nil(t, err)
+
+		_, err = Verify(gs)
+		if assert.NotNil(t, err, tt.code) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+
+	for _, g := range []Grain{
+		{OpCode: 42},
+		{OpCode: LoadOpCode, Name: ""},
+		{OpCode: LoadOpCode, Name: "a b"},
+		{OpCode: LoadOpCode, Name: "a", PopN: 3},
+		{OpCode: AddOpCode, Name: "-", PopN: 2},
+		{OpCode: CallOpCode, Name: "f", PopN: -1},
+		{OpCode: DiscardOpCode, PopN: 2},
+	} {
+		_, err := Verify(Grains{{OpCode: ConstOpCode}, {OpCode: ConstOpCode}, g})
+		if assert.NotNil(t, err, g.String()) {
+			assert.Equal(t, 2, err.(*VerifyError).PC)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// types is a set of the types a value can have.
+type types uint8
+
+const (
+	typeInt types = 1 << iota
+	typeFloat
+	typeString
+	typeBool
+	typeList
+	typeMap
+
+	typeAny = typeInt | typeFloat | typeString | typeBool | typeList | typeMap
+)
+
+var typeNames = []string{"int", "float", "string", "bool", "list", "map"}
+
+func (t types) String() string {
+	if t == typeAny {
+		return "any"
+	}
+
+	var names []string
+	for i, name := range typeNames {
+		if t&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " | ")
+}
+
+// addTypes returns the types of a + b, like vm.add. It's 0 if the addition
+// always fails.
+func addTypes(a, b types) types {
+	var t types
+	if a&typeInt != 0 && b&typeInt != 0 {
+		t |= typeInt
+	}
+	if (a&(typeInt|typeFloat) != 0 && b&typeFloat != 0) || (a&typeFloat != 0 && b&typeInt != 0) {
+		t |= typeFloat
+	}
+	if a&typeString != 0 && b&typeString != 0 {
+		t |= typeString
+	}
+	return t
+}
+
+// A symbol is a name in the source code.
+type symbol struct {
+	name     string
+	function bool
+
+	pos, end ast.Pos
+	stmt     int // index of its statement
+
+	// for variables: set by an assignment, and the types of the variable
+	// after this occurrence
+	assign bool
+	types  types
+}
+
+func (s *symbol) contains(line, column int) bool {
+	return s.pos.Line == line && s.pos.Column <= column && column <= s.end.Column
+}
+
+// A problem is an error or a warning in the source code.
+type problem struct {
+	pos, end ast.Pos
+	severity int
+	msg      string
+}
+
+// An analysis is what the server knows about a program.
+type analysis struct {
+	root     *ast.Node
+	symbols  []*symbol // in source order
+	problems []problem
+}
+
+// analyze parses, compiles and checks a program. The root is nil if it can't
+// be parsed.
+func analyze(code string) *analysis {
+	a := &analysis{}
+
+	root, err := parser.Parse(code, false)
+	if err != nil {
+		pos, ok := parser.ErrorPos(err)
+		if !ok {
+			pos = ast.Pos{Line: 1, Column: 1}
+		}
+		a.problem(pos, ast.Pos{Line: pos.Line, Column: pos.Column + 1}, severityError, "%s", syntaxError(code, pos))
+		return a
+	}
+
+	a.root = root
+	a.check()
+
+	gs, err := compiler.CompileGrains(root)
+	if err == nil {
+		_, err = language.Verify(gs)
+	}
+	if err != nil {
+		pos := root.Pos()
+		var verr *language.VerifyError
+		if errors.As(err, &verr) && verr.Grain.Line > 0 {
+			pos = ast.Pos{Line: verr.Grain.Line, Column: 1}
+		}
+		a.problem(pos, ast.Pos{Line: pos.Line + 1, Column: 1}, severityError, "%s", err.Error())
+	}
+
+	sort.SliceStable(a.symbols, func(i, j int) bool {
+		return a.symbols[i].pos.Offset < a.symbols[j].pos.Offset
+	})
+
+	return a
+}
+
+// syntaxError describes what's at the position where the parsing failed.
+func syntaxError(code string, pos ast.Pos) string {
+	runes := []rune(code)
+	if pos.Offset >= len(runes) {
+		return "Syntax error: unexpected end of file"
+	}
+
+	switch r := runes[pos.Offset]; r {
+	case '\n', '\r':
+		return "Syntax error: unexpected newline"
+	default:
+		return fmt.Sprintf("Syntax error: unexpected %q", r)
+	}
+}
+
+func (a *analysis) problem(pos, end ast.Pos, severity int, format string, args ...interface{}) {
+	a.problems = append(a.problems, problem{pos, end, severity, fmt.Sprintf(format, args...)})
+}
+
+// check finds the symbols of the program and infers the types of its
+// variables. Programs have no branches, so the types are the ones of the
+// last assignments.
+func (a *analysis) check() {
+	vars := make(map[string]types)
+
+	for i, stmt := range a.root.Children() {
+		switch stmt.Type() {
+		case ast.AssignNodeType:
+			t := a.expr(stmt.SecondChild(), i, vars)
+			v := stmt.Child()
+			vars[v.Name()] = t
+			a.symbols = append(a.symbols, &symbol{
+				name: v.Name(), pos: v.Pos(), end: v.End(), stmt: i, assign: true, types: t,
+			})
+		default:
+			a.expr(stmt, i, vars)
+		}
+	}
+}
+
+// expr returns the types of an expression.
+func (a *analysis) expr(n *ast.Node, stmt int, vars map[string]types) types {
+	switch n.Type() {
+	case ast.LitteralNodeType:
+		return typeInt
+
+	case ast.VariableNodeType:
+		t, ok := vars[n.Name()]
+		if !ok {
+			// variables that aren't set are 0
+			t = typeInt
+		}
+		a.symbols = append(a.symbols, &symbol{name: n.Name(), pos: n.Pos(), end: n.End(), stmt: stmt, types: t})
+		return t
+
+	case ast.UnopNodeType:
+		return a.expr(n.Child(), stmt, vars)
+
+	case ast.BinopNodeType:
+		left := a.expr(n.Child(), stmt, vars)
+		right := a.expr(n.SecondChild(), stmt, vars)
+		t := addTypes(left, right)
+		if t == 0 {
+			a.problem(n.Pos(), n.End(), severityError, "Cannot add %s and %s", left, right)
+			return typeAny
+		}
+		return t
+
+	case ast.FuncCallNodeType:
+		for _, arg := range n.Children() {
+			a.expr(arg, stmt, vars)
+		}
+		return a.call(n, stmt)
+	}
+
+	return typeAny
+}
+
+// call checks a function call and returns the types of its result.
+func (a *analysis) call(n *ast.Node, stmt int) types {
+	name := n.Name()
+	end := n.Pos()
+	end.Offset += len(name)
+	end.Column += len(name)
+
+	a.symbols = append(a.symbols, &symbol{name: name, function: true, pos: n.Pos(), end: end, stmt: stmt})
+
+	b := vm.LookupBuiltin(name)
+	if b == nil {
+		a.problem(n.Pos(), end, severityError, "Unknown function '%s'", name)
+		return typeAny
+	}
+
+	if arity, nargs := b.Arity(), len(n.Children()); arity >= 0 && nargs != arity {
+		a.problem(n.Pos(), n.End(), severityError, "%s() takes %s, got %d", name, plural(arity, "argument"), nargs)
+	}
+
+	return resultTypes(name)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// symbolAt returns the symbol at a position, or nil.
+func (a *analysis) symbolAt(line, column int) *symbol {
+	for _, s := range a.symbols {
+		if s.contains(line, column) {
+			return s
+		}
+	}
+	return nil
+}
+
+// definition returns the assignment that set the value of a variable, or
+// nil. Variables read before any assignment are defined by the first one.
+func (a *analysis) definition(s *symbol) *symbol {
+	if s.function {
+		// builtins are defined in Go
+		return nil
+	}
+	if s.assign {
+		return s
+	}
+
+	var first, last *symbol
+	for _, d := range a.symbols {
+		if !d.assign || d.name != s.name {
+			continue
+		}
+		if first == nil {
+			first = d
+		}
+		if d.stmt < s.stmt {
+			last = d
+		}
+	}
+
+	if last != nil {
+		return last
+	}
+	return first
+}
+
+// references returns the symbols with the same name and kind as s.
+func (a *analysis) references(s *symbol, includeAssignments bool) []*symbol {
+	var refs []*symbol
+	for _, r := range a.symbols {
+		if r.name == s.name && r.function == s.function && (includeAssignments || !r.assign) {
+			refs = append(refs, r)
+		}
+	}
+	return refs
+}
+
+// variables returns the first assignment of each variable set before a line.
+func (a *analysis) variables(before int) []*symbol {
+	var vars []*symbol
+	seen := make(map[string]bool)
+
+	for _, s := range a.symbols {
+		if s.assign && !seen[s.name] && s.pos.Line < before {
+			seen[s.name] = true
+			vars = append(vars, s)
+		}
+	}
+	return vars
+}
+
+// finalTypes returns the types of a variable at the end of the program.
+func (a *analysis) finalTypes(name string) types {
+	var t types
+	for _, s := range a.symbols {
+		if s.assign && s.name == name {
+			t = s.types
+		}
+	}
+	return t
+}
@@ -0,0 +1,60 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// documentation of a builtin
+type builtinDoc struct {
+	params string
+	result types
+	doc    string
+}
+
+// documentation of the builtins of the vm package; other builtins are
+// described by their arity
+var builtinDocs = map[string]builtinDoc{
+	"print":      {"args...", typeInt, "Prints its arguments separated by spaces."},
+	"eprint":     {"args...", typeInt, "Prints its arguments separated by spaces on the standard error."},
+	"input":      {"[prompt]", typeString, "Prints the prompt, then reads a line. Fails at the end of the input."},
+	"read_line":  {"", typeString, "Reads a line, or returns \"\" at the end of the input."},
+	"argc":       {"", typeInt, "Returns the number of command-line arguments."},
+	"arg":        {"i", typeInt | typeString, "Returns the i-th command-line argument, as an int if it's one."},
+	"read_file":  {"path", typeString, "Returns the content of a file. Needs fs:read."},
+	"write_file": {"path, content", typeInt, "Writes the content to a file, replacing it if it exists. Needs fs:write."},
+	"getenv":     {"name", typeString, "Returns the value of an environment variable, or \"\" if it isn't set. Needs env."},
+	"now":        {"", typeFloat, "Returns the current time in seconds since the Unix epoch. Needs clock."},
+	"exec":       {"command, args...", typeString, "Runs a command and returns its standard output. Needs exec."},
+}
+
+// signature returns the signature of a builtin, e.g. "arg(i) -> int | string".
+func signature(name string, b vm.Builtin) string {
+	d, ok := builtinDocs[name]
+	if !ok {
+		d = builtinDoc{params: arityParams(b.Arity()), result: typeAny}
+	}
+	return fmt.Sprintf("%s(%s) -> %s", name, d.params, d.result)
+}
+
+func arityParams(arity int) string {
+	if arity < 0 {
+		return "args..."
+	}
+
+	params := make([]string, arity)
+	for i := range params {
+		params[i] = fmt.Sprintf("arg%d", i+1)
+	}
+	return strings.Join(params, ", ")
+}
+
+// resultTypes returns the types a builtin can return.
+func resultTypes(name string) types {
+	if d, ok := builtinDocs[name]; ok {
+		return d.result
+	}
+	return typeAny
+}
@@ -0,0 +1,442 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/format"
+	"github.com/bfontaine/quinoa/internal/framing"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// ErrNoShutdown is returned by Serve when the client exits without asking the
+// server to shut down first.
+var ErrNoShutdown = errors.New("Exit without shutdown")
+
+// A requestError is an error with a JSON-RPC code.
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+// A document is a program opened in the client.
+type document struct {
+	uri     string
+	version int
+	text    string
+	lines   []string
+
+	analysis *analysis
+	// last analysis of a program that could be parsed, used for completion
+	parsed *analysis
+}
+
+func newDocument(uri string, version int, text string, previous *document) *document {
+	d := &document{
+		uri:      uri,
+		version:  version,
+		text:     text,
+		lines:    splitLines(text),
+		analysis: analyze(text),
+	}
+
+	d.parsed = d.analysis
+	if d.analysis.root == nil && previous != nil {
+		d.parsed = previous.parsed
+	}
+	return d
+}
+
+// splitLines splits a text into lines like the parser does.
+func splitLines(text string) []string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+	return strings.Split(text, "\n")
+}
+
+// position converts a position of the parser into a position of the
+// protocol.
+func (d *document) position(pos ast.Pos) position {
+	line := pos.Line - 1
+	if line < 0 {
+		return position{}
+	}
+	if line >= len(d.lines) {
+		return position{Line: line}
+	}
+
+	runes := []rune(d.lines[line])
+	n := pos.Column - 1
+	if n > len(runes) {
+		n = len(runes)
+	}
+	return position{Line: line, Character: len(utf16.Encode(runes[:n]))}
+}
+
+// column converts a position of the protocol into a line and a column of the
+// parser.
+func (d *document) column(p position) (int, int) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return p.Line + 1, 0
+	}
+
+	units := 0
+	for i, r := range []rune(d.lines[p.Line]) {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return p.Line + 1, len([]rune(d.lines[p.Line])) + 1
+}
+
+func (d *document) span(pos, end ast.Pos) span {
+	return span{Start: d.position(pos), End: d.position(end)}
+}
+
+func (d *document) location(s *symbol) location {
+	return location{URI: d.uri, Range: d.span(s.pos, s.end)}
+}
+
+// A Server is a language server that reads requests and writes responses and
+// notifications in the format of the Language Server Protocol. Documents are
+// synchronized in full.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	initialized bool
+	shutdown    bool
+
+	documents map[string]*document
+}
+
+// NewServer returns a server that reads requests from in and writes to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve handles requests until the client sends the exit notification or
+// closes the input.
+func (s *Server) Serve() error {
+	for {
+		content, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			s.respond(nil, nil, &requestError{codeParseError, fmt.Sprintf("Invalid message: %s", err)})
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+
+		result, err := s.handle(&msg)
+		if msg.ID != nil {
+			s.respond(msg.ID, result, err)
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch {
+	case msg.Method == "initialize":
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // full
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"hoverProvider":              true,
+				"completionProvider":         map[string]interface{}{},
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "quinoa"},
+		}, nil
+	case !s.initialized:
+		return nil, &requestError{codeServerNotInitialized, "The server isn't initialized"}
+	case s.shutdown:
+		return nil, &requestError{codeInvalidRequest, "The server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		s.update(newDocument(item.URI, item.Version, item.Text, nil))
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		uri := params.TextDocument.URI
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.update(newDocument(uri, params.TextDocument.Version, text, s.documents[uri]))
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		// clear the diagnostics of the document
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []diagnostic{},
+		})
+		return nil, nil
+
+	case "textDocument/definition":
+		return s.withSymbol(msg, func(d *document, sym *symbol) (interface{}, error) {
+			if def := d.analysis.definition(sym); def != nil {
+				return d.location(def), nil
+			}
+			return nil, nil
+		})
+
+	case "textDocument/references":
+		var params referenceParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.withSymbol(msg, func(d *document, sym *symbol) (interface{}, error) {
+			locations := []location{}
+			for _, r := range d.analysis.references(sym, params.Context.IncludeDeclaration) {
+				locations = append(locations, d.location(r))
+			}
+			return locations, nil
+		})
+
+	case "textDocument/hover":
+		return s.withSymbol(msg, s.hover)
+
+	case "textDocument/completion":
+		return s.completion(msg)
+
+	case "textDocument/documentSymbol":
+		return s.withDocument(msg, s.documentSymbols)
+
+	case "textDocument/formatting":
+		return s.withDocument(msg, s.formatting)
+	}
+
+	// notifications are ignored since they have no response
+	return nil, &requestError{codeMethodNotFound, fmt.Sprintf("Unknown method '%s'", msg.Method)}
+}
+
+func unmarshalParams(msg *message, params interface{}) error {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &requestError{codeInvalidParams, fmt.Sprintf("Invalid params: %s", err)}
+	}
+	return nil
+}
+
+// update replaces a document and publishes its diagnostics.
+func (s *Server) update(d *document) {
+	s.documents[d.uri] = d
+
+	diagnostics := []diagnostic{}
+	for _, p := range d.analysis.problems {
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    d.span(p.pos, p.end),
+			Severity: p.severity,
+			Source:   "quinoa",
+			Message:  p.msg,
+		})
+	}
+
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// withDocument calls f with the document of a request. It fails if the
+// document isn't open.
+func (s *Server) withDocument(msg *message, f func(*document) (interface{}, error)) (interface{}, error) {
+	var params documentParams
+	if err := unmarshalParams(msg, &params); err != nil {
+		return nil, err
+	}
+
+	d, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, &requestError{codeInvalidParams, fmt.Sprintf("Unknown document '%s'", params.TextDocument.URI)}
+	}
+	return f(d)
+}
+
+// withSymbol calls f with the symbol at the position of a request. The
+// result is null if there's none.
+func (s *Server) withSymbol(msg *message, f func(*document, *symbol) (interface{}, error)) (interface{}, error) {
+	var params textDocumentPositionParams
+	if err := unmarshalParams(msg, &params); err != nil {
+		return nil, err
+	}
+
+	return s.withDocument(msg, func(d *document) (interface{}, error) {
+		sym := d.analysis.symbolAt(d.column(params.Position))
+		if sym == nil {
+			return nil, nil
+		}
+		return f(d, sym)
+	})
+}
+
+func (s *Server) hover(d *document, sym *symbol) (interface{}, error) {
+	var text string
+
+	if sym.function {
+		b := vm.LookupBuiltin(sym.name)
+		if b == nil {
+			return nil, nil
+		}
+		text = "```quinoa\n" + signature(sym.name, b) + "\n```"
+		if doc, ok := builtinDocs[sym.name]; ok {
+			text += "\n\n" + doc.doc
+		}
+	} else {
+		text = fmt.Sprintf("```quinoa\n%s: %s\n```", sym.name, sym.types)
+	}
+
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: text},
+		Range:    d.span(sym.pos, sym.end),
+	}, nil
+}
+
+func (s *Server) completion(msg *message) (interface{}, error) {
+	var params textDocumentPositionParams
+	if err := unmarshalParams(msg, &params); err != nil {
+		return nil, err
+	}
+
+	return s.withDocument(msg, func(d *document) (interface{}, error) {
+		items := []completionItem{}
+
+		if d.parsed != nil {
+			for _, v := range d.parsed.variables(params.Position.Line + 1) {
+				items = append(items, completionItem{
+					Label:  v.name,
+					Kind:   completionVariable,
+					Detail: d.parsed.finalTypes(v.name).String(),
+				})
+			}
+		}
+
+		for _, name := range vm.Builtins() {
+			items = append(items, completionItem{
+				Label:  name,
+				Kind:   completionFunction,
+				Detail: signature(name, vm.LookupBuiltin(name)),
+			})
+		}
+
+		return items, nil
+	})
+}
+
+func (s *Server) documentSymbols(d *document) (interface{}, error) {
+	symbols := []documentSymbol{}
+	if d.analysis.root == nil {
+		return symbols, nil
+	}
+
+	stmts := d.analysis.root.Children()
+	for _, v := range d.analysis.variables(len(d.lines) + 1) {
+		stmt := stmts[v.stmt]
+		symbols = append(symbols, documentSymbol{
+			Name:           v.name,
+			Detail:         d.analysis.finalTypes(v.name).String(),
+			Kind:           symbolVariable,
+			Range:          d.span(stmt.Pos(), stmt.End()),
+			SelectionRange: d.span(v.pos, v.end),
+		})
+	}
+	return symbols, nil
+}
+
+// formatting replaces the whole document by its formatted source.
+func (s *Server) formatting(d *document) (interface{}, error) {
+	formatted, err := format.Source([]byte(d.text))
+	if err != nil {
+		return nil, &requestError{codeRequestFailed, "The program has syntax errors"}
+	}
+
+	edits := []textEdit{}
+	if string(formatted) != d.text {
+		last := len(d.lines) - 1
+		end := position{Line: last, Character: len(utf16.Encode([]rune(d.lines[last])))}
+		edits = append(edits, textEdit{
+			Range:   span{Start: position{}, End: end},
+			NewText: string(formatted),
+		})
+	}
+	return edits, nil
+}
+
+// Messages
+
+func (s *Server) respond(id json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	if err == nil {
+		framing.Write(s.out, response{JSONRPC: "2.0", ID: id, Result: result})
+		return
+	}
+
+	rerr, ok := err.(*requestError)
+	if !ok {
+		rerr = &requestError{codeRequestFailed, err.Error()}
+	}
+	framing.Write(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   responseError{Code: rerr.code, Message: rerr.msg},
+	})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	framing.Write(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
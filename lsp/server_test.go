@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bfontaine/quinoa/internal/framing"
+	"github.com/stretchr/testify/assert"
+)
+
+// normalize returns a JSON message with sorted keys and no spaces.
+func normalize(t *testing.T, msg []byte) string {
+	var v interface{}
+	if !assert.Nil(t, json.Unmarshal(msg, &v), string(msg)) {
+		t.FailNow()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// TestSessions replays the sessions of testdata: lines starting with "->" are
+// sent to the server, and lines starting with "<-" are the messages it must
+// send back.
+func TestSessions(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.txt")
+	assert.Nil(t, err)
+	assert.True(t, len(files) > 0)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			session, err := ioutil.ReadFile(file)
+			if !assert.Nil(t, err) {
+				t.FailNow()
+			}
+
+			inR, inW := io.Pipe()
+			outR, outW := io.Pipe()
+			out := bufio.NewReader(outR)
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- NewServer(inR, outW).Serve()
+				outW.Close()
+			}()
+
+			for _, line := range strings.Split(string(session), "\n") {
+				switch {
+				case strings.HasPrefix(line, "-> "):
+					assert.Nil(t, framing.Write(inW, json.RawMessage(line[3:])))
+				case strings.HasPrefix(line, "<- "):
+					msg, err := framing.Read(out)
+					if !assert.Nil(t, err) {
+						t.FailNow()
+					}
+					assert.Equal(t, normalize(t, []byte(line[3:])), normalize(t, msg))
+				}
+			}
+
+			inW.Close()
+			assert.Nil(t, <-errs)
+		})
+	}
+}
+
+func TestTypes(t *testing.T) {
+	for _, tc := range []struct {
+		code, name, types string
+	}{
+		{"a = 1", "a", "int"},
+		{"a = arg(0)", "a", "int | string"},
+		{"a = arg(0) + 1", "a", "int"},
+		{"a = now() + 1", "a", "float"},
+		{"a = arg(0) + arg(1)", "a", "int | string"},
+		{"a = arg(0) + now()", "a", "float"},
+		{"a = f()", "a", "any"},
+		{"a = read_line()\na = 2", "a", "int"},
+		{"a = b", "a", "int"},
+	} {
+		a := analyze(tc.code)
+		assert.NotNil(t, a.root, tc.code)
+		assert.Equal(t, tc.types, a.finalTypes(tc.name).String(), tc.code)
+	}
+}
+
+func TestProblems(t *testing.T) {
+	for _, tc := range []struct {
+		code, msg string
+	}{
+		{"a = %", "Syntax error: unexpected '%'"},
+		{"a = 1 +", "Syntax error: unexpected end of file"},
+		{"a = 1\nb = (", "Syntax error: unexpected '('"},
+	} {
+		a := analyze(tc.code)
+		if assert.Equal(t, 1, len(a.problems), tc.code) {
+			assert.Equal(t, tc.msg, a.problems[0].msg, tc.code)
+		}
+	}
+}
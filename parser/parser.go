@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"errors"
 	"log"
+	"sort"
 
 	"github.com/bfontaine/quinoa/ast"
 )
@@ -10,6 +12,7 @@ func NewParser(code string) *Parser {
 	p := &Parser{
 		root:   ast.NewNode(ast.RootNodeType, ""),
 		stack:  newNodeStack(),
+		lines:  lineOffsets(code),
 		Buffer: code,
 	}
 
@@ -17,15 +20,57 @@ func NewParser(code string) *Parser {
 	return p
 }
 
+// lineOffsets returns the rune offset of the beginning of each line of code.
+func lineOffsets(code string) []int {
+	lines := []int{0}
+	runes := []rune(code)
+
+	for i, r := range runes {
+		if r == '\n' || (r == '\r' && (i+1 == len(runes) || runes[i+1] != '\n')) {
+			lines = append(lines, i+1)
+		}
+	}
+
+	return lines
+}
+
+// position converts a rune offset in the code into an ast.Pos
+func (p *Parser) position(offset int) ast.Pos {
+	// index of the first line that starts after offset
+	line := sort.Search(len(p.lines), func(i int) bool { return p.lines[i] > offset })
+
+	return ast.Pos{
+		Offset: offset,
+		Line:   line,
+		Column: offset - p.lines[line-1] + 1,
+	}
+}
+
+// span returns the positions of the beginning and the end of a text that
+// starts at the given rune offset.
+func (p *Parser) span(text string, begin int) (ast.Pos, ast.Pos) {
+	return p.position(begin), p.position(begin + len([]rune(text)))
+}
+
 func (p *Parser) AST() *ast.Node {
 	return p.root
 }
 
 func Parse(code string, debug bool) (*ast.Node, error) {
+	return parse(code, debug, ruleProgram)
+}
+
+// ParseExpression parses code that consists of a single expression. The
+// returned root node has this expression as its only child.
+func ParseExpression(code string, debug bool) (*ast.Node, error) {
+	return parse(code, debug, ruleExpressionProgram)
+}
+
+func parse(code string, debug bool, rule pegRule) (*ast.Node, error) {
 	p := NewParser(code)
 	p.Debug = debug
 
-	if err := p.Parse(); err != nil {
+	if err := p.Parse(int(rule)); err != nil {
 		return nil, err
 	}
 
@@ -34,6 +79,17 @@ func Parse(code string, debug bool) (*ast.Node, error) {
 	return p.AST(), nil
 }
 
+// ErrorPos returns the position where the parsing failed, if err is an
+// error returned by Parse or ParseExpression.
+func ErrorPos(err error) (ast.Pos, bool) {
+	var perr *parseError
+	if !errors.As(err, &perr) {
+		return ast.Pos{}, false
+	}
+	// the error is right after the longest text that could be parsed
+	return perr.p.position(int(perr.max.end)), true
+}
+
 func (p *Parser) push(n *ast.Node) {
 	if p.Debug {
 		log.Printf("parser: %v <- %+v", p.stack, n)
@@ -52,8 +108,10 @@ func (p *Parser) last() *ast.Node {
 	return p.stack.Peek()
 }
 
-func (p *Parser) newNode(nodeType ast.NodeType, name string) {
-	p.push(ast.NewNode(nodeType, name))
+func (p *Parser) newNode(nodeType ast.NodeType, name string, begin int) {
+	n := ast.NewNode(nodeType, name)
+	n.SetPos(p.span(name, begin))
+	p.push(n)
 }
 
 func (p *Parser) AddStatement() {
@@ -69,12 +127,18 @@ func (p *Parser) AddAssign() {
 	n := ast.NewNode(ast.AssignNodeType, "")
 	n.AddChild(variable)
 	n.AddChild(value)
+	n.SetPos(variable.Pos(), value.End())
 	p.push(n)
 }
 
-func (p *Parser) AddFuncCall(name string) {
+func (p *Parser) AddFuncCall(name string, begin int) {
 	// |... -> |... funcCall(name)
-	p.newNode(ast.FuncCallNodeType, name)
+	p.newNode(ast.FuncCallNodeType, name, begin)
+}
+
+func (p *Parser) EndFuncCall(begin, end int) {
+	// |... funcCall(name, args...) -> |... funcCall(name, args...)
+	p.last().SetPos(p.position(begin), p.position(end))
 }
 
 func (p *Parser) AddFuncCallArg() {
@@ -82,19 +146,19 @@ func (p *Parser) AddFuncCallArg() {
 	p.last().AddChild(arg)
 }
 
-func (p *Parser) AddLitteral(name string) {
+func (p *Parser) AddLitteral(name string, begin int) {
 	// |... -> |... litteral
-	p.newNode(ast.LitteralNodeType, name)
+	p.newNode(ast.LitteralNodeType, name, begin)
 }
 
-func (p *Parser) AddVariable(name string) {
+func (p *Parser) AddVariable(name string, begin int) {
 	// |... -> |... variable
-	p.newNode(ast.VariableNodeType, name)
+	p.newNode(ast.VariableNodeType, name, begin)
 }
 
-func (p *Parser) StartUnop(name string) {
+func (p *Parser) StartUnop(name string, begin int) {
 	// |... -> |... unop
-	p.push(ast.NewNode(ast.UnopNodeType, name))
+	p.newNode(ast.UnopNodeType, name, begin)
 }
 
 func (p *Parser) EndUnop() {
@@ -102,6 +166,7 @@ func (p *Parser) EndUnop() {
 	expr := p.pop()
 	unop := p.last()
 	unop.AddChild(expr)
+	unop.SetPos(unop.Pos(), expr.End())
 }
 
 func (p *Parser) AddBinopName(name string) {
@@ -117,4 +182,11 @@ func (p *Parser) EndBinop() {
 	expr2 := p.pop()
 	binop := p.last()
 	binop.AddChild(expr2)
+	binop.SetPos(binop.Child().Pos(), expr2.End())
+}
+
+func (p *Parser) AddComment(text string, begin int) {
+	// begin is the offset of the text, right after the '#'
+	_, end := p.span(text, begin)
+	p.root.AddComment(ast.Comment{Text: text, Pos: p.position(begin - 1), End: end})
 }
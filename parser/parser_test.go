@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 
@@ -132,3 +133,80 @@ func TestParseASTFuncCall2(t *testing.T) {
 		}},
 	}}, actualAST)
 }
+
+func TestParsePositions(t *testing.T) {
+	actualAST, err := Parse("a = 1\nprint(a,\n  b + 42)", testing.Verbose())
+	assert.Nil(t, err)
+
+	stmts := actualAST.Children()
+	assert.Len(t, stmts, 2)
+
+	assert.Equal(t, ast.Pos{Offset: 0, Line: 1, Column: 1}, stmts[0].Pos())
+	assert.Equal(t, ast.Pos{Offset: 5, Line: 1, Column: 6}, stmts[0].End())
+
+	call := stmts[1]
+	assert.Equal(t, ast.Pos{Offset: 6, Line: 2, Column: 1}, call.Pos())
+	assert.Equal(t, ast.Pos{Offset: 24, Line: 3, Column: 10}, call.End())
+
+	binop := call.SecondChild()
+	assert.Equal(t, ast.Pos{Offset: 17, Line: 3, Column: 3}, binop.Pos())
+	assert.Equal(t, ast.Pos{Offset: 23, Line: 3, Column: 9}, binop.End())
+}
+
+func TestErrorPos(t *testing.T) {
+	for _, tc := range []struct {
+		code string
+		pos  ast.Pos
+	}{
+		{"a = ", ast.Pos{Offset: 4, Line: 1, Column: 5}},
+		{"a = 1\nprint(a,, b)\n", ast.Pos{Offset: 14, Line: 2, Column: 9}},
+		{"a b", ast.Pos{Offset: 2, Line: 1, Column: 3}},
+	} {
+		_, err := Parse(tc.code, testing.Verbose())
+		pos, ok := ErrorPos(err)
+		assert.True(t, ok, tc.code)
+		assert.Equal(t, tc.pos, pos, tc.code)
+	}
+
+	_, ok := ErrorPos(errors.New("not a parse error"))
+	assert.False(t, ok)
+}
+
+func TestParseComments(t *testing.T) {
+	actualAST, err := Parse("# hello\na = 1 #world\r\nprint(a, # x\n a)\n#\n", testing.Verbose())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []ast.Comment{
+		{Text: " hello", Pos: ast.Pos{Offset: 0, Line: 1, Column: 1}, End: ast.Pos{Offset: 7, Line: 1, Column: 8}},
+		{Text: "world", Pos: ast.Pos{Offset: 14, Line: 2, Column: 7}, End: ast.Pos{Offset: 20, Line: 2, Column: 13}},
+		{Text: " x", Pos: ast.Pos{Offset: 31, Line: 3, Column: 10}, End: ast.Pos{Offset: 34, Line: 3, Column: 13}},
+		{Text: "", Pos: ast.Pos{Offset: 39, Line: 5, Column: 1}, End: ast.Pos{Offset: 40, Line: 5, Column: 2}},
+	}, actualAST.Comments())
+}
+
+func TestParseExpression(t *testing.T) {
+	for _, code := range []string{
+		"a",
+		"42",
+		" a + 1 ",
+		"+(1 + 2)\n",
+		"print(a, 1)",
+		"f(\n\t1, # one\n)",
+	} {
+		t.Log(strconv.Quote(code))
+		root, err := ParseExpression(code, testing.Verbose())
+		assert.Nil(t, err)
+		assert.Len(t, root.Children(), 1)
+	}
+
+	for _, code := range []string{
+		"",
+		"a = 1",
+		"a b",
+		"f(1)\nf(2)",
+	} {
+		t.Log(strconv.Quote(code))
+		_, err := ParseExpression(code, testing.Verbose())
+		assert.NotNil(t, err)
+	}
+}
@@ -42,6 +42,7 @@ const (
 	ruleSimpleSpaces
 	ruleSimpleSpace
 	ruleNewline
+	ruleExpressionProgram
 	ruleAction0
 	ruleAction1
 	ruleAction2
@@ -52,6 +53,9 @@ const (
 	ruleAction7
 	ruleAction8
 	ruleAction9
+	ruleAction10
+	ruleAction11
+	ruleAction12
 	rulePegText
 )
 
@@ -84,6 +88,7 @@ var rul3s = [...]string{
 	"SimpleSpaces",
 	"SimpleSpace",
 	"Newline",
+	"ExpressionProgram",
 	"Action0",
 	"Action1",
 	"Action2",
@@ -94,6 +99,9 @@ var rul3s = [...]string{
 	"Action7",
 	"Action8",
 	"Action9",
+	"Action10",
+	"Action11",
+	"Action12",
 	"PegText",
 }
 
@@ -209,12 +217,13 @@ func (t *tokens32) Tokens() []token32 {
 type Parser struct {
 	root  *ast.Node
 	stack *nodeStack
+	lines []int
 
 	Debug bool
 
 	Buffer string
 	buffer []rune
-	rules  [39]func() bool
+	rules  [43]func() bool
 	parse  func(rule ...int) error
 	reset  func()
 	Pretty bool
@@ -311,21 +320,27 @@ func (p *Parser) Execute() {
 		case ruleAction1:
 			p.AddAssign()
 		case ruleAction2:
-			p.AddFuncCall(text)
+			p.AddFuncCall(text, begin)
 		case ruleAction3:
-			p.AddFuncCallArg()
+			p.EndFuncCall(begin, end)
 		case ruleAction4:
-			p.AddLitteral(text)
+			p.AddFuncCallArg()
 		case ruleAction5:
-			p.AddVariable(text)
+			p.AddLitteral(text, begin)
 		case ruleAction6:
-			p.AddBinopName(text)
+			p.AddVariable(text, begin)
 		case ruleAction7:
-			p.EndBinop()
+			p.AddBinopName(text)
 		case ruleAction8:
-			p.StartUnop(text)
+			p.EndBinop()
 		case ruleAction9:
+			p.StartUnop(text, begin)
+		case ruleAction10:
 			p.EndUnop()
+		case ruleAction11:
+			p.AddComment(text, begin)
+		case ruleAction12:
+			p.AddStatement()
 
 		}
 	}
@@ -582,37 +597,44 @@ func (p *Parser) Init() {
 			position, tokenIndex = position21, tokenIndex21
 			return false
 		},
-		/* 5 FuncCall <- <(Name SimpleSpaces '(' Action2 Spaces FuncArgs Spaces ')')> */
+		/* 5 FuncCall <- <(<(Name SimpleSpaces '(' Action2 Spaces FuncArgs Spaces ')')> Action3)> */
 		func() bool {
 			position23, tokenIndex23 := position, tokenIndex
 			{
 				position24 := position
-				if !_rules[ruleName]() {
-					goto l23
-				}
-				if !_rules[ruleSimpleSpaces]() {
-					goto l23
-				}
-				if buffer[position] != rune('(') {
-					goto l23
-				}
-				position++
-				if !_rules[ruleAction2]() {
-					goto l23
-				}
-				if !_rules[ruleSpaces]() {
-					goto l23
-				}
-				if !_rules[ruleFuncArgs]() {
-					goto l23
-				}
-				if !_rules[ruleSpaces]() {
-					goto l23
+				{
+					position106 := position
+					if !_rules[ruleName]() {
+						goto l23
+					}
+					if !_rules[ruleSimpleSpaces]() {
+						goto l23
+					}
+					if buffer[position] != rune('(') {
+						goto l23
+					}
+					position++
+					if !_rules[ruleAction2]() {
+						goto l23
+					}
+					if !_rules[ruleSpaces]() {
+						goto l23
+					}
+					if !_rules[ruleFuncArgs]() {
+						goto l23
+					}
+					if !_rules[ruleSpaces]() {
+						goto l23
+					}
+					if buffer[position] != rune(')') {
+						goto l23
+					}
+					position++
+					add(rulePegText, position106)
 				}
-				if buffer[position] != rune(')') {
+				if !_rules[ruleAction3]() {
 					goto l23
 				}
-				position++
 				add(ruleFuncCall, position24)
 			}
 			return true
@@ -658,7 +680,7 @@ func (p *Parser) Init() {
 			}
 			return true
 		},
-		/* 7 FuncArg <- <(Expression Action3)> */
+		/* 7 FuncArg <- <(Expression Action4)> */
 		func() bool {
 			position31, tokenIndex31 := position, tokenIndex
 			{
@@ -666,7 +688,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleExpression]() {
 					goto l31
 				}
-				if !_rules[ruleAction3]() {
+				if !_rules[ruleAction4]() {
 					goto l31
 				}
 				add(ruleFuncArg, position32)
@@ -777,7 +799,7 @@ func (p *Parser) Init() {
 			position, tokenIndex = position41, tokenIndex41
 			return false
 		},
-		/* 11 Litteral <- <(Number Action4)> */
+		/* 11 Litteral <- <(Number Action5)> */
 		func() bool {
 			position47, tokenIndex47 := position, tokenIndex
 			{
@@ -785,7 +807,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleNumber]() {
 					goto l47
 				}
-				if !_rules[ruleAction4]() {
+				if !_rules[ruleAction5]() {
 					goto l47
 				}
 				add(ruleLitteral, position48)
@@ -795,7 +817,7 @@ func (p *Parser) Init() {
 			position, tokenIndex = position47, tokenIndex47
 			return false
 		},
-		/* 12 Variable <- <(Name Action5)> */
+		/* 12 Variable <- <(Name Action6)> */
 		func() bool {
 			position49, tokenIndex49 := position, tokenIndex
 			{
@@ -803,7 +825,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleName]() {
 					goto l49
 				}
-				if !_rules[ruleAction5]() {
+				if !_rules[ruleAction6]() {
 					goto l49
 				}
 				add(ruleVariable, position50)
@@ -813,7 +835,7 @@ func (p *Parser) Init() {
 			position, tokenIndex = position49, tokenIndex49
 			return false
 		},
-		/* 13 Binop <- <(NoBinopExpression SimpleSpaces Op Action6 Spaces Expression Action7)> */
+		/* 13 Binop <- <(NoBinopExpression SimpleSpaces Op Action7 Spaces Expression Action8)> */
 		func() bool {
 			position51, tokenIndex51 := position, tokenIndex
 			{
@@ -827,7 +849,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleOp]() {
 					goto l51
 				}
-				if !_rules[ruleAction6]() {
+				if !_rules[ruleAction7]() {
 					goto l51
 				}
 				if !_rules[ruleSpaces]() {
@@ -836,7 +858,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleExpression]() {
 					goto l51
 				}
-				if !_rules[ruleAction7]() {
+				if !_rules[ruleAction8]() {
 					goto l51
 				}
 				add(ruleBinop, position52)
@@ -846,7 +868,7 @@ func (p *Parser) Init() {
 			position, tokenIndex = position51, tokenIndex51
 			return false
 		},
-		/* 14 Unop <- <(Op Action8 Spaces NoOpExpression Action9)> */
+		/* 14 Unop <- <(Op Action9 Spaces NoOpExpression Action10)> */
 		func() bool {
 			position53, tokenIndex53 := position, tokenIndex
 			{
@@ -854,7 +876,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleOp]() {
 					goto l53
 				}
-				if !_rules[ruleAction8]() {
+				if !_rules[ruleAction9]() {
 					goto l53
 				}
 				if !_rules[ruleSpaces]() {
@@ -863,7 +885,7 @@ func (p *Parser) Init() {
 				if !_rules[ruleNoOpExpression]() {
 					goto l53
 				}
-				if !_rules[ruleAction9]() {
+				if !_rules[ruleAction10]() {
 					goto l53
 				}
 				add(ruleUnop, position54)
@@ -1026,7 +1048,7 @@ func (p *Parser) Init() {
 			position, tokenIndex = position75, tokenIndex75
 			return false
 		},
-		/* 21 Comment <- <('#' (!Newline .)* Newline)> */
+		/* 21 Comment <- <('#' <(!Newline .)*> Newline Action11)> */
 		func() bool {
 			position79, tokenIndex79 := position, tokenIndex
 			{
@@ -1035,28 +1057,35 @@ func (p *Parser) Init() {
 					goto l79
 				}
 				position++
-			l81:
 				{
-					position82, tokenIndex82 := position, tokenIndex
+					position107 := position
+				l81:
 					{
-						position83, tokenIndex83 := position, tokenIndex
-						if !_rules[ruleNewline]() {
-							goto l83
+						position82, tokenIndex82 := position, tokenIndex
+						{
+							position83, tokenIndex83 := position, tokenIndex
+							if !_rules[ruleNewline]() {
+								goto l83
+							}
+							goto l82
+						l83:
+							position, tokenIndex = position83, tokenIndex83
 						}
-						goto l82
-					l83:
-						position, tokenIndex = position83, tokenIndex83
-					}
-					if !matchDot() {
-						goto l82
+						if !matchDot() {
+							goto l82
+						}
+						goto l81
+					l82:
+						position, tokenIndex = position82, tokenIndex82
 					}
-					goto l81
-				l82:
-					position, tokenIndex = position82, tokenIndex82
+					add(rulePegText, position107)
 				}
 				if !_rules[ruleNewline]() {
 					goto l79
 				}
+				if !_rules[ruleAction11]() {
+					goto l79
+				}
 				add(ruleComment, position80)
 			}
 			return true
@@ -1196,76 +1225,130 @@ func (p *Parser) Init() {
 			position, tokenIndex = position101, tokenIndex101
 			return false
 		},
-		/* 28 Action0 <- <{ p.AddStatement() }> */
+		/* 27 ExpressionProgram <- <(Spaces Expression Spaces !. Action12)> */
+		func() bool {
+			position108, tokenIndex108 := position, tokenIndex
+			{
+				position109 := position
+				if !_rules[ruleSpaces]() {
+					goto l108
+				}
+				if !_rules[ruleExpression]() {
+					goto l108
+				}
+				if !_rules[ruleSpaces]() {
+					goto l108
+				}
+				{
+					position110, tokenIndex110 := position, tokenIndex
+					if !matchDot() {
+						goto l110
+					}
+					goto l108
+				l110:
+					position, tokenIndex = position110, tokenIndex110
+				}
+				if !_rules[ruleAction12]() {
+					goto l108
+				}
+				add(ruleExpressionProgram, position109)
+			}
+			return true
+		l108:
+			position, tokenIndex = position108, tokenIndex108
+			return false
+		},
+		/* 29 Action0 <- <{ p.AddStatement() }> */
 		func() bool {
 			{
 				add(ruleAction0, position)
 			}
 			return true
 		},
-		/* 29 Action1 <- <{ p.AddAssign() }> */
+		/* 30 Action1 <- <{ p.AddAssign() }> */
 		func() bool {
 			{
 				add(ruleAction1, position)
 			}
 			return true
 		},
-		/* 30 Action2 <- <{ p.AddFuncCall(text) }> */
+		/* 31 Action2 <- <{ p.AddFuncCall(text, begin) }> */
 		func() bool {
 			{
 				add(ruleAction2, position)
 			}
 			return true
 		},
-		/* 31 Action3 <- <{ p.AddFuncCallArg() }> */
+		/* 32 Action3 <- <{ p.EndFuncCall(begin, end) }> */
 		func() bool {
 			{
 				add(ruleAction3, position)
 			}
 			return true
 		},
-		/* 32 Action4 <- <{ p.AddLitteral(text) }> */
+		/* 33 Action4 <- <{ p.AddFuncCallArg() }> */
 		func() bool {
 			{
 				add(ruleAction4, position)
 			}
 			return true
 		},
-		/* 33 Action5 <- <{ p.AddVariable(text) }> */
+		/* 34 Action5 <- <{ p.AddLitteral(text, begin) }> */
 		func() bool {
 			{
 				add(ruleAction5, position)
 			}
 			return true
 		},
-		/* 34 Action6 <- <{ p.AddBinopName(text) }> */
+		/* 35 Action6 <- <{ p.AddVariable(text, begin) }> */
 		func() bool {
 			{
 				add(ruleAction6, position)
 			}
 			return true
 		},
-		/* 35 Action7 <- <{ p.EndBinop() }> */
+		/* 36 Action7 <- <{ p.AddBinopName(text) }> */
 		func() bool {
 			{
 				add(ruleAction7, position)
 			}
 			return true
 		},
-		/* 36 Action8 <- <{ p.StartUnop(text) }> */
+		/* 37 Action8 <- <{ p.EndBinop() }> */
 		func() bool {
 			{
 				add(ruleAction8, position)
 			}
 			return true
 		},
-		/* 37 Action9 <- <{ p.EndUnop() }> */
+		/* 38 Action9 <- <{ p.StartUnop(text, begin) }> */
 		func() bool {
 			{
 				add(ruleAction9, position)
 			}
 			return true
 		},
+		/* 39 Action10 <- <{ p.EndUnop() }> */
+		func() bool {
+			{
+				add(ruleAction10, position)
+			}
+			return true
+		},
+		/* 40 Action11 <- <{ p.AddComment(text, begin) }> */
+		func() bool {
+			{
+				add(ruleAction11, position)
+			}
+			return true
+		},
+		/* 41 Action12 <- <{ p.AddStatement() }> */
+		func() bool {
+			{
+				add(ruleAction12, position)
+			}
+			return true
+		},
 		nil,
 	}
 	p.rules = _rules
@@ -0,0 +1,232 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// WritePprof writes the profile in the format of pprof, so that it can be
+// loaded with 'go tool pprof'. filename is the name of the source file of the
+// program.
+//
+// Every executed grain is a location of the main function, at its source line
+// and with its address. The locations of calls have the called builtin on top
+// of them.
+//
+// See https://github.com/google/pprof/blob/main/proto/profile.proto
+func (p *Profiler) WritePprof(w io.Writer, filename string) error {
+	b := &pprofBuilder{strings: map[string]int64{"": 0}, stringTable: []string{""}}
+
+	// a single mapping, for the program
+	var mapping protobuf
+	mapping.uint64(1, 1)
+	mapping.uint64(3, uint64(len(p.code)))
+	mapping.int64(5, b.str(filename))
+	for field := 7; field <= 9; field++ {
+		// has_functions, has_filenames, has_line_numbers
+		mapping.uint64(field, 1)
+	}
+
+	// functions: main, then the called builtins
+	mainID := b.function(mainFunction, filename)
+	builtinIDs := make(map[string]uint64)
+	for _, name := range p.calledBuiltins() {
+		builtinIDs[name] = b.function(name, "")
+	}
+
+	// locations: the grains, then the builtins
+	builtinLocations := make(map[string]uint64)
+	for pc, g := range p.code {
+		b.location(uint64(pc+1), uint64(pc), mainID, int64(g.Line))
+	}
+	for _, name := range p.calledBuiltins() {
+		id := uint64(len(p.code) + len(builtinLocations) + 1)
+		b.location(id, 0, builtinIDs[name], 0)
+		builtinLocations[name] = id
+	}
+
+	for pc, g := range p.code {
+		if p.counts[pc] == 0 {
+			continue
+		}
+
+		// the leaf first
+		stack := []uint64{uint64(pc + 1)}
+		if g.OpCode == language.CallOpCode {
+			stack = []uint64{builtinLocations[g.Name], uint64(pc + 1)}
+		}
+
+		b.sample(stack, p.counts[pc], int64(p.times[pc]))
+	}
+
+	var out protobuf
+
+	// sample_type
+	for _, t := range [][2]string{{"instructions", "count"}, {"time", "nanoseconds"}} {
+		out.message(1, b.valueType(t[0], t[1]))
+	}
+	// sample, mapping, location, function
+	for _, s := range b.samples {
+		out.message(2, s)
+	}
+	out.message(3, &mapping)
+	for _, l := range b.locations {
+		out.message(4, l)
+	}
+	for _, f := range b.functions {
+		out.message(5, f)
+	}
+	// string_table; it must be written after all the strings are added
+	periodType := b.valueType("instructions", "count")
+	for _, s := range b.stringTable {
+		out.string(6, s)
+	}
+	// time_nanos, duration_nanos, period_type, period
+	out.int64(9, p.start.UnixNano())
+	out.int64(10, int64(p.end.Sub(p.start)))
+	out.message(11, periodType)
+	out.int64(12, 1)
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(out.buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// calledBuiltins returns the sorted names of the builtins that were called.
+func (p *Profiler) calledBuiltins() []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	for pc, g := range p.code {
+		if g.OpCode == language.CallOpCode && p.counts[pc] > 0 && !seen[g.Name] {
+			seen[g.Name] = true
+			names = append(names, g.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// pprofBuilder builds the messages of a profile.
+type pprofBuilder struct {
+	strings     map[string]int64
+	stringTable []string
+
+	samples, locations, functions []*protobuf
+}
+
+// str returns the index of a string in the string table.
+func (b *pprofBuilder) str(s string) int64 {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+	i := int64(len(b.stringTable))
+	b.strings[s] = i
+	b.stringTable = append(b.stringTable, s)
+	return i
+}
+
+func (b *pprofBuilder) valueType(typ, unit string) *protobuf {
+	var m protobuf
+	m.int64(1, b.str(typ))
+	m.int64(2, b.str(unit))
+	return &m
+}
+
+func (b *pprofBuilder) function(name, filename string) uint64 {
+	id := uint64(len(b.functions) + 1)
+
+	var m protobuf
+	m.uint64(1, id)
+	m.int64(2, b.str(name))
+	m.int64(3, b.str(name))
+	m.int64(4, b.str(filename))
+	b.functions = append(b.functions, &m)
+
+	return id
+}
+
+func (b *pprofBuilder) location(id, address, function uint64, line int64) {
+	var l protobuf
+	l.uint64(1, function)
+	l.int64(2, line)
+
+	var m protobuf
+	m.uint64(1, id)
+	m.uint64(2, 1)
+	m.uint64(3, address)
+	m.message(4, &l)
+	b.locations = append(b.locations, &m)
+}
+
+func (b *pprofBuilder) sample(stack []uint64, count, nanoseconds int64) {
+	var m protobuf
+	m.packed(1, stack)
+	m.packed(2, []uint64{uint64(count), uint64(nanoseconds)})
+	b.samples = append(b.samples, &m)
+}
+
+// protobuf encodes the fields of a Protocol Buffers message. Fields with zero
+// values are omitted, like proto3 does.
+type protobuf struct {
+	buf []byte
+}
+
+// wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (m *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		m.buf = append(m.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	m.buf = append(m.buf, byte(x))
+}
+
+func (m *protobuf) key(field int, wire int) {
+	m.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (m *protobuf) uint64(field int, x uint64) {
+	if x != 0 {
+		m.key(field, wireVarint)
+		m.varint(x)
+	}
+}
+
+func (m *protobuf) int64(field int, x int64) {
+	m.uint64(field, uint64(x))
+}
+
+func (m *protobuf) bytes(field int, b []byte) {
+	m.key(field, wireBytes)
+	m.varint(uint64(len(b)))
+	m.buf = append(m.buf, b...)
+}
+
+// string always writes the string, so that the empty string can be the first
+// of the string table.
+func (m *protobuf) string(field int, s string) {
+	m.bytes(field, []byte(s))
+}
+
+func (m *protobuf) message(field int, msg *protobuf) {
+	m.bytes(field, msg.buf)
+}
+
+func (m *protobuf) packed(field int, xs []uint64) {
+	var p protobuf
+	for _, x := range xs {
+		p.varint(x)
+	}
+	m.bytes(field, p.buf)
+}
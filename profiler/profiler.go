@@ -0,0 +1,270 @@
+// Package profiler measures where programs spend their time. A Profiler is a
+// vm.Hook that counts the executions of every grain and measures their wall
+// time; it reports them per grain, per source line and per function.
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// name of the function of the grains that aren't calls
+const mainFunction = "main"
+
+// A Profiler profiles the execution of some code.
+type Profiler struct {
+	code   language.Grains
+	source []string
+
+	counts []int64
+	times  []time.Duration
+
+	// grain being executed, or -1, and when it started
+	current      int
+	currentStart time.Time
+
+	start, end time.Time
+
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// New returns a profiler for code. source is the source code of the program,
+// if any, used to show its lines in the report.
+func New(code language.Grains, source []byte) *Profiler {
+	p := &Profiler{
+		code:    code,
+		counts:  make([]int64, len(code)),
+		times:   make([]time.Duration, len(code)),
+		current: -1,
+		now:     time.Now,
+	}
+
+	if source != nil {
+		p.source = strings.Split(strings.TrimSuffix(string(source), "\n"), "\n")
+	}
+	return p
+}
+
+// Step implements vm.Hook. Other code, such as the expressions evaluated by
+// a debugger, isn't profiled.
+func (p *Profiler) Step(machine *vm.VM, code language.Grains, pc int) error {
+	if !p.profiles(code) {
+		return nil
+	}
+
+	now := p.now()
+	if p.current >= 0 {
+		p.times[p.current] += now.Sub(p.currentStart)
+	} else if p.start.IsZero() {
+		p.start = now
+	}
+
+	p.counts[pc]++
+	p.current, p.currentStart = pc, now
+	return nil
+}
+
+// End implements vm.EndHook: it stops the profile before the output of the
+// run is flushed, so that the last grain isn't charged for it.
+func (p *Profiler) End(machine *vm.VM, code language.Grains) {
+	if p.profiles(code) {
+		p.Stop()
+	}
+}
+
+// profiles tests if code is the code of the profiler, and not other code run
+// by the VM.
+func (p *Profiler) profiles(code language.Grains) bool {
+	return len(code) == len(p.code) && len(code) > 0 && &code[0] == &p.code[0]
+}
+
+// Stop ends the measure of the last grain. It must be called when the run
+// returns, in case it didn't end, e.g. because the code couldn't be
+// verified.
+func (p *Profiler) Stop() {
+	switch {
+	case p.current >= 0:
+		now := p.now()
+		p.times[p.current] += now.Sub(p.currentStart)
+		p.current = -1
+		p.end = now
+	case p.start.IsZero():
+		// nothing ran
+		p.start = p.now()
+		p.end = p.start
+	}
+}
+
+// A Stat is the number of grains executed for something, and their total
+// wall time.
+type Stat struct {
+	Instructions int64
+	Time         time.Duration
+}
+
+func (s *Stat) add(count int64, d time.Duration) {
+	s.Instructions += count
+	s.Time += d
+}
+
+// Total returns the number of grains executed, and their total wall time.
+func (p *Profiler) Total() Stat {
+	var total Stat
+	for pc := range p.code {
+		total.add(p.counts[pc], p.times[pc])
+	}
+	return total
+}
+
+// Grain returns the statistics of the grain at address pc.
+func (p *Profiler) Grain(pc int) Stat {
+	return Stat{Instructions: p.counts[pc], Time: p.times[pc]}
+}
+
+// Lines returns the statistics of the source lines, by line. Grains whose
+// line is unknown are on line 0.
+func (p *Profiler) Lines() map[int]Stat {
+	lines := make(map[int]Stat)
+	for pc, g := range p.code {
+		if p.counts[pc] > 0 {
+			s := lines[g.Line]
+			s.add(p.counts[pc], p.times[pc])
+			lines[g.Line] = s
+		}
+	}
+	return lines
+}
+
+// Functions returns the statistics of the functions, by name. The time of a
+// call is the time of the builtin it calls; the other grains are in the
+// "main" function.
+func (p *Profiler) Functions() map[string]Stat {
+	functions := make(map[string]Stat)
+	for pc := range p.code {
+		if p.counts[pc] > 0 {
+			name := p.function(pc)
+			s := functions[name]
+			s.add(p.counts[pc], p.times[pc])
+			functions[name] = s
+		}
+	}
+	return functions
+}
+
+func (p *Profiler) function(pc int) string {
+	if g := p.code[pc]; g.OpCode == language.CallOpCode {
+		return g.Name
+	}
+	return mainFunction
+}
+
+// maximum number of grains in the report
+const reportGrains = 10
+
+// WriteReport writes a report of the profile for humans.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	total := p.Total()
+	percent := func(d time.Duration) float64 {
+		if total.Time == 0 {
+			return 0
+		}
+		return 100 * float64(d) / float64(total.Time)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Executed %d instructions in %s.\n", total.Instructions, total.Time)
+
+	b.WriteString("\nBy line:\n")
+	fmt.Fprintf(&b, "%12s  %12s  %6s  %s\n", "instructions", "time", "%", "line")
+	lines := p.Lines()
+	for _, n := range sortedLines(lines) {
+		s := lines[n]
+		fmt.Fprintf(&b, "%12d  %12s  %5.1f%%  %4s  %s\n", s.Instructions, s.Time, percent(s.Time), lineNumber(n), p.sourceLine(n))
+	}
+
+	b.WriteString("\nBy function:\n")
+	fmt.Fprintf(&b, "%12s  %12s  %6s  %s\n", "instructions", "time", "%", "function")
+	functions := p.Functions()
+	for _, name := range sortedFunctions(functions) {
+		s := functions[name]
+		fmt.Fprintf(&b, "%12d  %12s  %5.1f%%  %s\n", s.Instructions, s.Time, percent(s.Time), name)
+	}
+
+	b.WriteString("\nHottest grains:\n")
+	fmt.Fprintf(&b, "%12s  %12s  %6s  %4s  %s\n", "instructions", "time", "%", "line", "grain")
+	for _, pc := range p.hottestGrains(reportGrains) {
+		g := p.code[pc]
+		fmt.Fprintf(&b, "%12d  %12s  %5.1f%%  %4s  %04d  %s\n",
+			p.counts[pc], p.times[pc], percent(p.times[pc]), lineNumber(g.Line), pc, g)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sourceLine returns the n-th line of the source code, or "" if it's unknown.
+func (p *Profiler) sourceLine(n int) string {
+	if n < 1 || n > len(p.source) {
+		return ""
+	}
+	return strings.TrimSpace(p.source[n-1])
+}
+
+func lineNumber(n int) string {
+	if n == 0 {
+		return "?"
+	}
+	return fmt.Sprint(n)
+}
+
+func sortedLines(lines map[int]Stat) []int {
+	ns := make([]int, 0, len(lines))
+	for n := range lines {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	return ns
+}
+
+// sortedFunctions returns the names of the functions, the slowest first.
+func sortedFunctions(functions map[string]Stat) []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := functions[names[i]], functions[names[j]]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// hottestGrains returns the addresses of the n slowest grains that were
+// executed, the slowest first.
+func (p *Profiler) hottestGrains(n int) []int {
+	var pcs []int
+	for pc := range p.code {
+		if p.counts[pc] > 0 {
+			pcs = append(pcs, pc)
+		}
+	}
+
+	sort.SliceStable(pcs, func(i, j int) bool {
+		return p.times[pcs[i]] > p.times[pcs[j]]
+	})
+
+	if len(pcs) > n {
+		pcs = pcs[:n]
+	}
+	return pcs
+}
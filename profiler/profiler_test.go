@@ -0,0 +1,224 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/bfontaine/quinoa/internal/testutil"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// a hot line, and a line with two statements and nested calls
+const source = "n = 1\nn = n + n + n + n\nprint(n)\nprint(n + 1, print()); n = n + 1\n"
+
+// the number of times the source is run, like the body of a loop
+const runs = 3
+
+// profile runs code several times with a clock that advances by 1µs at every
+// grain, except for calls that take 10µs.
+func profile(t *testing.T, code language.Grains) *Profiler {
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &bytes.Buffer{}
+
+	h := &clockHook{Profiler: New(code, []byte(source)), pc: -1}
+	clock := time.Unix(1000, 0)
+	h.now = func() time.Time {
+		if h.pc >= 0 && code[h.pc].OpCode == language.CallOpCode {
+			clock = clock.Add(10 * time.Microsecond)
+		} else if h.pc >= 0 {
+			clock = clock.Add(time.Microsecond)
+		}
+		return clock
+	}
+	machine.Hook = h
+
+	for i := 0; i < runs; i++ {
+		assert.Nil(t, machine.Run(code))
+	}
+	h.Stop()
+	return h.Profiler
+}
+
+// clockHook is a profiler that remembers the grain being executed, whose
+// duration is the one of the clock.
+type clockHook struct {
+	*Profiler
+	pc int
+}
+
+func (h *clockHook) Step(machine *vm.VM, code language.Grains, pc int) error {
+	err := h.Profiler.Step(machine, code, pc)
+	h.pc = pc
+	return err
+}
+
+func (h *clockHook) End(machine *vm.VM, code language.Grains) {
+	h.Profiler.End(machine, code)
+	h.pc = -1
+}
+
+func TestProfile(t *testing.T) {
+	p := profile(t, testutil.Compile(t, source))
+
+	// 26 grains, including 3 calls, per run
+	assert.Equal(t, Stat{Instructions: 78, Time: 159 * time.Microsecond}, p.Total())
+	assert.Equal(t, map[int]Stat{
+		1: {9, 9 * time.Microsecond},
+		2: {27, 27 * time.Microsecond},
+		3: {9, 36 * time.Microsecond},
+		4: {33, 87 * time.Microsecond},
+	}, p.Lines())
+	assert.Equal(t, map[string]Stat{
+		"main":  {69, 69 * time.Microsecond},
+		"print": {9, 90 * time.Microsecond},
+	}, p.Functions())
+	assert.Equal(t, Stat{Instructions: 3, Time: 30 * time.Microsecond}, p.Grain(19))
+}
+
+// slowWriter is an output that takes a second per write on a clock.
+type slowWriter struct{ clock *time.Time }
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	*w.clock = w.clock.Add(time.Second)
+	return len(b), nil
+}
+
+func TestProfileWithoutOutput(t *testing.T) {
+	code := testutil.Compile(t, "print(1)\nprint(2)\n")
+	p := New(code, nil)
+
+	// only the output takes time
+	clock := time.Unix(1000, 0)
+	p.now = func() time.Time { return clock }
+
+	machine := vm.NewVM(testing.Verbose())
+	machine.Stdout = &slowWriter{&clock}
+	machine.Hook = p
+
+	assert.Nil(t, machine.Run(code))
+	p.Stop()
+
+	assert.Equal(t, Stat{Instructions: 6}, p.Total())
+	assert.Equal(t, Stat{Instructions: 1}, p.Grain(len(code)-1))
+	assert.Equal(t, time.Duration(0), p.end.Sub(p.start))
+}
+
+func TestWriteReport(t *testing.T) {
+	p := profile(t, testutil.Compile(t, source))
+
+	var b bytes.Buffer
+	assert.Nil(t, p.WriteReport(&b))
+	assert.Equal(t, `Executed 78 instructions in 159µs.
+
+By line:
+instructions          time       %  line
+           9           9µs    5.7%     1  n = 1
+          27          27µs   17.0%     2  n = n + n + n + n
+           9          36µs   22.6%     3  print(n)
+          33          87µs   54.7%     4  print(n + 1, print()); n = n + 1
+
+By function:
+instructions          time       %  function
+           9          90µs   56.6%  print
+          69          69µs   43.4%  main
+
+Hottest grains:
+instructions          time       %  line  grain
+           3          30µs   18.9%     3  0013  CALL   print/1
+           3          30µs   18.9%     4  0015  CALL   print/0
+           3          30µs   18.9%     4  0019  CALL   print/2
+           3           3µs    1.9%     1  0000  CONST  1
+           3           3µs    1.9%     1  0001  STORE  n
+           3           3µs    1.9%     1  0002  DISCARD
+           3           3µs    1.9%     2  0003  LOAD   n
+           3           3µs    1.9%     2  0004  LOAD   n
+           3           3µs    1.9%     2  0005  ADD
+           3           3µs    1.9%     2  0006  LOAD   n
+`, b.String())
+}
+
+func TestWritePprof(t *testing.T) {
+	p := profile(t, testutil.Compile(t, source))
+
+	var b bytes.Buffer
+	assert.Nil(t, p.WritePprof(&b, "count.qi"))
+
+	r, err := gzip.NewReader(&b)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+
+	fields := decode(t, data)
+	assert.Equal(t, []string{"", "count.qi", "main", "print", "instructions", "count", "time", "nanoseconds"}, stringFields(fields[6]))
+	// a sample per grain
+	assert.Len(t, fields[2], 26)
+	// a location per grain, and one for print
+	assert.Len(t, fields[4], 27)
+	assert.Len(t, fields[5], 2)
+	assert.Equal(t, []uint64{uint64(time.Unix(1000, 0).UnixNano())}, varints(fields[9]))
+	assert.Equal(t, []uint64{uint64(159 * time.Microsecond)}, varints(fields[10]))
+}
+
+// a field of a Protocol Buffers message: a varint or bytes
+type field struct {
+	varint uint64
+	bytes  []byte
+}
+
+// decode returns the fields of a message by number.
+func decode(t *testing.T, data []byte) map[int][]field {
+	fields := make(map[int][]field)
+
+	varint := func() uint64 {
+		var x uint64
+		for shift := uint(0); ; shift += 7 {
+			if !assert.True(t, len(data) > 0, "truncated varint") {
+				t.FailNow()
+			}
+			b := data[0]
+			data = data[1:]
+			x |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return x
+			}
+		}
+	}
+
+	for len(data) > 0 {
+		key := varint()
+		switch key & 7 {
+		case 0:
+			fields[int(key>>3)] = append(fields[int(key>>3)], field{varint: varint()})
+		case 2:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], field{bytes: data[:n]})
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func stringFields(fields []field) []string {
+	var s []string
+	for _, f := range fields {
+		s = append(s, string(f.bytes))
+	}
+	return s
+}
+
+func varints(fields []field) []uint64 {
+	var xs []uint64
+	for _, f := range fields {
+		xs = append(xs, f.varint)
+	}
+	return xs
+}
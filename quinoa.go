@@ -0,0 +1,129 @@
+// Package quinoa embeds the language in Go programs. Programs are compiled
+// once and can then be run any number of times:
+//
+//	p, err := quinoa.Compile("total = price + shipping")
+//	...
+//	total, err := p.Run(ctx, map[string]interface{}{"price": 30, "shipping": 5})
+//
+// Go functions can be exposed to programs with vm.RegisterFunc and
+// vm.RegisterGoFunc.
+package quinoa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// A Program is a compiled program. It's immutable, so it can be run by
+// several goroutines at the same time.
+type Program struct {
+	// the grains leave the value of the last statement on the stack
+	grains language.Grains
+}
+
+// Compile parses, compiles and verifies source code.
+func Compile(src string) (*Program, error) {
+	root, err := parser.Parse(src, false)
+	if err != nil {
+		return nil, err
+	}
+
+	gs, err := compiler.CompileGrains(root)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Program{grains: gs}
+
+	// keep the value of the last statement as the result of the program
+	if n := len(gs); n > 0 && gs[n-1].OpCode == language.DiscardOpCode {
+		p.grains = gs[:n-1]
+	}
+
+	if _, err := language.Verify(p.grains); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// RunOptions configure the VM of a run. The zero value runs programs like
+// vm.NewVM, with the streams of the process and no capabilities.
+type RunOptions struct {
+	// Standard streams of the program. Nil streams are the ones of the
+	// process.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Limits of the run, as in vm.VM. Zero means the default.
+	MaxStackSize    int
+	MaxInstructions int64
+	MaxDuration     time.Duration
+	MaxHeapSize     int64
+
+	// Allow are the capabilities allowed to the program, with the resources
+	// they're restricted to, if any; see vm.VM.Allow.
+	Allow map[vm.Capability][]string
+}
+
+// Run runs the program in a new VM. globals are the initial values of
+// variables; they can be of any type supported by vm.ToValue. It returns the
+// value of the last statement converted by vm.FromValue. The program is
+// stopped when the context is done.
+func (p *Program) Run(ctx context.Context, globals map[string]interface{}) (interface{}, error) {
+	return p.RunWith(ctx, globals, RunOptions{})
+}
+
+// RunWith is like Run, in a VM configured by opts, e.g. to run untrusted
+// programs with limits and without access to the standard streams.
+func (p *Program) RunWith(ctx context.Context, globals map[string]interface{}, opts RunOptions) (interface{}, error) {
+	machine := vm.NewVM(false)
+	if opts.Stdin != nil {
+		machine.Stdin = opts.Stdin
+	}
+	if opts.Stdout != nil {
+		machine.Stdout = opts.Stdout
+	}
+	if opts.Stderr != nil {
+		machine.Stderr = opts.Stderr
+	}
+	if opts.MaxStackSize > 0 {
+		machine.MaxStackSize = opts.MaxStackSize
+	}
+	machine.MaxInstructions = opts.MaxInstructions
+	machine.MaxDuration = opts.MaxDuration
+	machine.MaxHeapSize = opts.MaxHeapSize
+	for c, resources := range opts.Allow {
+		machine.Allow(c, resources...)
+	}
+
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v, err := vm.ToValue(globals[name])
+		if err != nil {
+			return nil, fmt.Errorf("Global '%s': %s", name, err)
+		}
+		machine.Set(name, v)
+	}
+
+	v, err := machine.EvalContext(ctx, p.grains)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.FromValue(v), nil
+}
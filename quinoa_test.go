@@ -0,0 +1,150 @@
+package quinoa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	for _, src := range []string{"a = 1 +", ""} {
+		_, err := Compile(src)
+		assert.NotNil(t, err, src)
+	}
+}
+
+func TestRun(t *testing.T) {
+	p, err := Compile("total = price + shipping\ntotal = total + 1\n")
+	assert.Nil(t, err)
+
+	v, err := p.Run(context.Background(), map[string]interface{}{"price": 30, "shipping": uint8(5)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(36), v)
+
+	// the globals of a run don't leak into the next ones
+	v, err = p.Run(context.Background(), map[string]interface{}{"price": 1.5})
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, v)
+
+	_, err = p.Run(context.Background(), map[string]interface{}{"price": "a", "shipping": "b"})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 2: Cannot add string and int", err.Error())
+	}
+}
+
+func TestRunConvertsValues(t *testing.T) {
+	p, err := Compile("x = x")
+	assert.Nil(t, err)
+
+	for _, tc := range []struct {
+		global, expected interface{}
+	}{
+		{true, true},
+		{"abc", "abc"},
+		{[]int{1, 2}, []interface{}{int64(1), int64(2)}},
+		{map[string][]string{"a": {"b"}}, map[string]interface{}{"a": []interface{}{"b"}}},
+	} {
+		v, err := p.Run(context.Background(), map[string]interface{}{"x": tc.global})
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expected, v)
+	}
+
+	_, err = p.Run(context.Background(), map[string]interface{}{"x": struct{}{}})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Global 'x': Cannot use a Go struct {} as a value", err.Error())
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	p, err := Compile("a = 1\nb = a + c\nnope(b)\n")
+	assert.Nil(t, err)
+
+	_, err = p.Run(context.Background(), nil)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 3: Unknown function 'nope'", err.Error())
+		_, ok := err.(*vm.RuntimeError)
+		assert.True(t, ok)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Run(ctx, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestRunWith(t *testing.T) {
+	p, err := Compile("print(x)\neprint(read_line())\ny = getenv(name)\n")
+	assert.Nil(t, err)
+
+	os.Setenv("QUINOA_TEST", "ok")
+	defer os.Unsetenv("QUINOA_TEST")
+
+	var stdout, stderr bytes.Buffer
+	opts := RunOptions{
+		Stdin:  strings.NewReader("in\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Allow:  map[vm.Capability][]string{vm.CapEnv: {"QUINOA_TEST"}},
+	}
+	v, err := p.RunWith(context.Background(), map[string]interface{}{"x": 42, "name": "QUINOA_TEST"}, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", v)
+	assert.Equal(t, "42\n", stdout.String())
+	assert.Equal(t, "in\n", stderr.String())
+
+	// no capabilities by default
+	globals := map[string]interface{}{"x": 1, "name": "QUINOA_TEST"}
+	_, err = p.RunWith(context.Background(), globals, RunOptions{Stdin: strings.NewReader(""), Stdout: ioutil.Discard, Stderr: ioutil.Discard})
+	assert.True(t, errors.Is(err, vm.ErrPermissionDenied))
+}
+
+func TestRunWithLimits(t *testing.T) {
+	p, err := Compile("a = x + x\nb = a + a\nc = b + b\n")
+	assert.Nil(t, err)
+	globals := map[string]interface{}{"x": "abcdefgh"}
+
+	_, err = p.RunWith(context.Background(), globals, RunOptions{MaxInstructions: 5})
+	assert.True(t, errors.Is(err, vm.ErrBudgetExceeded))
+
+	_, err = p.RunWith(context.Background(), globals, RunOptions{MaxHeapSize: 40})
+	assert.True(t, errors.Is(err, vm.ErrOutOfMemory))
+
+	_, err = p.RunWith(context.Background(), globals, RunOptions{MaxStackSize: 1})
+	assert.True(t, errors.Is(err, vm.ErrStackOverflow))
+
+	v, err := p.RunWith(context.Background(), globals, RunOptions{MaxInstructions: 100, MaxHeapSize: 1000})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("abcdefgh", 8), v)
+}
+
+func TestRunConcurrently(t *testing.T) {
+	p, err := Compile("y = x + x\ny = y + 1")
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 100)
+	errs := make([]error, len(results))
+
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = p.Run(context.Background(), map[string]interface{}{"x": i})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, v := range results {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, int64(2*i+1), v, fmt.Sprint(i))
+	}
+}
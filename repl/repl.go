@@ -0,0 +1,251 @@
+// Package repl implements an interactive Read-Eval-Print Loop.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bfontaine/quinoa/ast"
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+const help = `Enter statements or expressions. The value of expressions is printed.
+Commands:
+  :ast [code]     show the AST of the code, or of the last entry
+  :grains [code]  show the grains of the code, or of the last entry
+  :reset          forget all variables
+  :help           show this help
+`
+
+// A REPL reads entries from its input and evaluates them in the same VM, so
+// variables persist between entries.
+type REPL struct {
+	in  *bufio.Reader
+	out io.Writer
+	vm  *vm.VM
+
+	// error that ended the input, other than io.EOF
+	err error
+
+	// last evaluated entry
+	last string
+
+	Debug bool
+}
+
+func NewREPL(in io.Reader, out io.Writer, debug bool) *REPL {
+	r := &REPL{
+		in:    bufio.NewReader(in),
+		out:   out,
+		vm:    vm.NewVM(debug),
+		Debug: debug,
+	}
+
+	// programs share the input and the output of the REPL
+	r.vm.Stdin = r.in
+	r.vm.Stdout = out
+
+	return r
+}
+
+// Run reads and evaluates entries until the end of the input.
+func (r *REPL) Run() error {
+	for {
+		entry, ok := r.read()
+		if !ok {
+			fmt.Fprintln(r.out)
+			return r.err
+		}
+
+		if err := r.Eval(entry); err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", strings.TrimSpace(err.Error()))
+		}
+	}
+}
+
+// read reads an entry. It spans multiple lines if they have unclosed
+// parentheses.
+func (r *REPL) read() (string, bool) {
+	var lines []string
+
+	fmt.Fprint(r.out, prompt)
+
+	for {
+		line, ok := r.readLine()
+		if !ok {
+			break
+		}
+		lines = append(lines, line)
+
+		// comments must end with a newline
+		entry := strings.Join(lines, "\n") + "\n"
+		if openParens(entry) <= 0 {
+			return entry, true
+		}
+
+		fmt.Fprint(r.out, continuationPrompt)
+	}
+
+	if len(lines) > 0 {
+		return strings.Join(lines, "\n") + "\n", true
+	}
+	return "", false
+}
+
+// readLine reads a line of the input, without its line ending.
+func (r *REPL) readLine() (string, bool) {
+	line, err := r.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err != io.EOF {
+			r.err = err
+		}
+		return "", false
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true
+}
+
+// openParens returns the number of parentheses that are not closed in the
+// code.
+func openParens(code string) int {
+	n := 0
+	comment := false
+
+	for _, c := range code {
+		switch {
+		case comment:
+			comment = c != '\n'
+		case c == '#':
+			comment = true
+		case c == '(':
+			n++
+		case c == ')':
+			n--
+		}
+	}
+
+	return n
+}
+
+// Eval evaluates an entry, which is either a command, an expression or a
+// sequence of statements.
+func (r *REPL) Eval(entry string) error {
+	trimmed := strings.TrimSpace(entry)
+
+	if trimmed == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(trimmed, ":") {
+		return r.command(trimmed)
+	}
+
+	r.last = entry
+
+	if root, err := parser.ParseExpression(entry, r.Debug); err == nil {
+		return r.evalExpression(root.Child())
+	}
+
+	root, err := parser.Parse(entry, r.Debug)
+	if err != nil {
+		return err
+	}
+
+	gs, err := compiler.CompileGrains(root)
+	if err != nil {
+		return err
+	}
+
+	return r.vm.Run(gs)
+}
+
+// evalExpression evaluates an expression and prints its value.
+func (r *REPL) evalExpression(expr *ast.Node) error {
+	gs, err := compiler.CompileGrains(expr)
+	if err != nil {
+		return err
+	}
+
+	v, err := r.vm.Eval(gs)
+	if err != nil {
+		return err
+	}
+
+	// print doesn't return anything meaningful
+	if expr.Type() != ast.FuncCallNodeType || expr.Name() != "print" {
+		fmt.Fprintln(r.out, vm.Repr(v))
+	}
+
+	return nil
+}
+
+func (r *REPL) command(line string) error {
+	name := line
+	code := ""
+
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name = line[:i]
+		code = strings.TrimSpace(line[i:])
+	}
+
+	switch name {
+	case ":help":
+		fmt.Fprint(r.out, help)
+		return nil
+
+	case ":reset":
+		r.vm.Reset()
+		r.last = ""
+		return nil
+
+	case ":ast", ":grains":
+		if code == "" {
+			code = r.last
+		}
+		if code == "" {
+			return fmt.Errorf("Usage: %s <code>", name)
+		}
+
+		root, err := r.parse(code)
+		if err != nil {
+			return err
+		}
+
+		if name == ":ast" {
+			fmt.Fprintln(r.out, root)
+			return nil
+		}
+
+		gs, err := compiler.CompileGrains(root)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(r.out, language.Disassemble(gs, []byte(code)))
+		return nil
+	}
+
+	return fmt.Errorf("Unknown command '%s'; see :help", name)
+}
+
+// parse parses code as an expression if possible, and as a program
+// otherwise. It returns the expression node in the former case.
+func (r *REPL) parse(code string) (*ast.Node, error) {
+	// comments must end with a newline
+	code += "\n"
+
+	if root, err := parser.ParseExpression(code, r.Debug); err == nil {
+		return root.Child(), nil
+	}
+	return parser.Parse(code, r.Debug)
+}
@@ -0,0 +1,57 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runREPL(t *testing.T, input string) string {
+	var out bytes.Buffer
+
+	r := NewREPL(strings.NewReader(input), &out, testing.Verbose())
+	assert.Nil(t, r.Run())
+
+	return out.String()
+}
+
+func TestREPLExpressions(t *testing.T) {
+	assert.Equal(t, "> 3\n> \n", runREPL(t, "1 + 2\n"))
+	assert.Equal(t, "> 42\n> \n", runREPL(t, "  +42  # answer\n"))
+}
+
+func TestREPLPersistentMemory(t *testing.T) {
+	assert.Equal(t, "> > > 3\n> \n", runREPL(t, "a = 1\nb = a + 1\na + b\n"))
+}
+
+func TestREPLMultiLineEntries(t *testing.T) {
+	assert.Equal(t, "> ... ... 3\n> \n", runREPL(t, "(1 + # (\n2\n)\n"))
+}
+
+func TestREPLInputOutput(t *testing.T) {
+	// programs read the lines that follow their entry
+	assert.Equal(t, "> 1 2\n> > \"Alice\"\n> \n", runREPL(t, "print(1, 2)\nname = input()\nAlice\nname\n"))
+}
+
+func TestREPLErrors(t *testing.T) {
+	out := runREPL(t, "a = \nfoo(1)\n1\n")
+
+	assert.True(t, strings.HasPrefix(out, "> error: parse error"))
+	assert.True(t, strings.HasSuffix(out, "> error: line 1: Unknown function 'foo'\n> 1\n> \n"))
+}
+
+func TestREPLReset(t *testing.T) {
+	assert.Equal(t, "> > > 0\n> \n", runREPL(t, "a = 2\n:reset\na\n"))
+}
+
+func TestREPLCommands(t *testing.T) {
+	assert.Equal(t, "> root(assignment(var(a), litteral(1)))\n> \n", runREPL(t, ":ast a = 1\n"))
+	assert.Equal(t, "> 1\n> binop(+, var(a), litteral(1))\n> \n", runREPL(t, "a + 1\n:ast\n"))
+
+	out := runREPL(t, ":grains a = 1 + 2\n")
+	assert.Equal(t, "> ; 1: a = 1 + 2\n0000  CONST  2\n0001  CONST  1\n0002  ADD\n0003  STORE  a\n0004  DISCARD\n> \n", out)
+
+	assert.Contains(t, runREPL(t, ":foo\n"), "error: Unknown command ':foo'")
+}
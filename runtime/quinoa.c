@@ -0,0 +1,42 @@
+/*
+ * Runtime of the programs compiled to LLVM IR by 'quinoa build -emit=llvm':
+ *
+ *     $ quinoa build -emit=llvm foo.qi
+ *     $ llc foo.ll -o foo.s
+ *     $ cc foo.s runtime/quinoa.c -o foo
+ *
+ * The builtins take the number of their arguments, then the arguments, which
+ * are ints, and return 0.
+ */
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdio.h>
+
+static void print_args(FILE *f, int64_t n, va_list ap) {
+    for (int64_t i = 0; i < n; i++) {
+        if (i > 0) {
+            fputc(' ', f);
+        }
+        fprintf(f, "%lld", (long long)va_arg(ap, int64_t));
+    }
+    fputc('\n', f);
+}
+
+/* print(args...) prints its arguments separated by spaces. */
+int64_t quinoa_print(int64_t n, ...) {
+    va_list ap;
+    va_start(ap, n);
+    print_args(stdout, n, ap);
+    va_end(ap);
+    return 0;
+}
+
+/* eprint(args...) is like print(), on the standard error. */
+int64_t quinoa_eprint(int64_t n, ...) {
+    va_list ap;
+    va_start(ap, n);
+    fflush(stdout);
+    print_args(stderr, n, ap);
+    va_end(ap);
+    return 0;
+}
@@ -0,0 +1,27 @@
+; 2: a = 1 + 2 + 3
+0000  CONST  6
+0001  STOREPOP a
+; 3: b = a + +4
+0002  CONST  10
+0003  STOREPOP b
+; 4: c = (a + b) + (1 + (2 + 3))
+0004  CONST  22
+0005  STOREPOP c
+; 5: print(a, b, c)
+0006  CONST  22
+0007  CONST  10
+0008  CONST  6
+0009  CALL   print/3
+0010  DISCARD
+; 6: print(a + 0, 0 + a)
+0011  CONST  6
+0012  CONST  6
+0013  CALL   print/2
+0014  DISCARD
+; 7: d = b + 0
+0015  CONST  10
+0016  STOREPOP d
+; 8: print(d + 0 + 0)
+0017  CONST  10
+0018  CALL   print/1
+0019  DISCARD
@@ -0,0 +1,32 @@
+; ModuleID = "arithmetic.qi"
+source_filename = "arithmetic.qi"
+
+declare i64 @quinoa_print(i64, ...)
+declare i64 @quinoa_eprint(i64, ...)
+
+define i32 @main() {
+entry:
+  ; line 2
+  %0 = add i64 2, 3
+  %a = add i64 1, %0
+  ; line 3
+  %b = add i64 %a, 4
+  ; line 4
+  %1 = add i64 2, 3
+  %2 = add i64 1, %1
+  %3 = add i64 %a, %b
+  %c = add i64 %3, %2
+  ; line 5
+  %4 = call i64 (i64, ...) @quinoa_print(i64 3, i64 %a, i64 %b, i64 %c)
+  ; line 6
+  %5 = add i64 0, %a
+  %6 = add i64 %a, 0
+  %7 = call i64 (i64, ...) @quinoa_print(i64 2, i64 %6, i64 %5)
+  ; line 7
+  %d = add i64 %b, 0
+  ; line 8
+  %8 = add i64 0, 0
+  %9 = add i64 %d, %8
+  %10 = call i64 (i64, ...) @quinoa_print(i64 1, i64 %9)
+  ret i32 0
+}
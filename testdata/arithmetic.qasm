@@ -0,0 +1,55 @@
+; 2: a = 1 + 2 + 3
+0000  CONST  3
+0001  CONST  2
+0002  ADD
+0003  CONST  1
+0004  ADD
+0005  STORE  a
+0006  DISCARD
+; 3: b = a + +4
+0007  CONST  4
+0008  LOAD   a
+0009  ADD
+0010  STORE  b
+0011  DISCARD
+; 4: c = (a + b) + (1 + (2 + 3))
+0012  CONST  3
+0013  CONST  2
+0014  ADD
+0015  CONST  1
+0016  ADD
+0017  LOAD   b
+0018  LOAD   a
+0019  ADD
+0020  ADD
+0021  STORE  c
+0022  DISCARD
+; 5: print(a, b, c)
+0023  LOAD   c
+0024  LOAD   b
+0025  LOAD   a
+0026  CALL   print/3
+0027  DISCARD
+; 6: print(a + 0, 0 + a)
+0028  LOAD   a
+0029  CONST  0
+0030  ADD
+0031  CONST  0
+0032  LOAD   a
+0033  ADD
+0034  CALL   print/2
+0035  DISCARD
+; 7: d = b + 0
+0036  CONST  0
+0037  LOAD   b
+0038  ADD
+0039  STORE  d
+0040  DISCARD
+; 8: print(d + 0 + 0)
+0041  CONST  0
+0042  CONST  0
+0043  ADD
+0044  LOAD   d
+0045  ADD
+0046  CALL   print/1
+0047  DISCARD
@@ -0,0 +1,4 @@
+; 1: print(arg())
+0000  CALL   arg/0
+0001  CALL   print/1
+0002  DISCARD
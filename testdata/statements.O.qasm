@@ -0,0 +1,15 @@
+; 1: a = 1; b = 2  # several statements on a line
+0000  CONST  1
+0001  STOREPOP a
+0002  CONST  2
+0003  STOREPOP b
+; 5: a + b
+0004  CONST  3
+; 2: print(
+0005  CONST  2
+0006  CONST  1
+0007  CALL   print/3
+0008  DISCARD
+; 7: print()
+0009  CALL   print/0
+0010  DISCARD
@@ -0,0 +1,16 @@
+; ModuleID = "statements.qi"
+source_filename = "statements.qi"
+
+declare i64 @quinoa_print(i64, ...)
+declare i64 @quinoa_eprint(i64, ...)
+
+define i32 @main() {
+entry:
+  ; line 5
+  %0 = add i64 1, 2
+  ; line 2
+  %1 = call i64 (i64, ...) @quinoa_print(i64 3, i64 1, i64 2, i64 %0)
+  ; line 7
+  %2 = call i64 (i64, ...) @quinoa_print(i64 0)
+  ret i32 0
+}
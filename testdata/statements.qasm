@@ -0,0 +1,21 @@
+; 1: a = 1; b = 2  # several statements on a line
+0000  CONST  1
+0001  STORE  a
+0002  DISCARD
+0003  CONST  2
+0004  STORE  b
+0005  DISCARD
+; 5: a + b
+0006  LOAD   b
+0007  LOAD   a
+0008  ADD
+; 4: b,
+0009  LOAD   b
+; 3: a,
+0010  LOAD   a
+; 2: print(
+0011  CALL   print/3
+0012  DISCARD
+; 7: print()
+0013  CALL   print/0
+0014  DISCARD
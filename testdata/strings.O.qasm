@@ -0,0 +1,10 @@
+; 2: s = read_line()
+0000  CALL   read_line/0
+0001  STOREPOP s
+; 3: print(s + s, argc())
+0002  CALL   argc/0
+0003  LOAD   s
+0004  LOAD   s
+0005  ADD
+0006  CALL   print/2
+0007  DISCARD
@@ -0,0 +1,11 @@
+; 2: s = read_line()
+0000  CALL   read_line/0
+0001  STORE  s
+0002  DISCARD
+; 3: print(s + s, argc())
+0003  CALL   argc/0
+0004  LOAD   s
+0005  LOAD   s
+0006  ADD
+0007  CALL   print/2
+0008  DISCARD
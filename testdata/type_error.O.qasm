@@ -0,0 +1,15 @@
+; 1: s = read_line()
+0000  CALL   read_line/0
+0001  STOREPOP s
+; 2: print(1)
+0002  CONST  1
+0003  CALL   print/1
+0004  DISCARD
+; 3: t = s + 1
+0005  LOAD   s
+0006  ADDCONST 1
+0007  STOREPOP t
+; 4: print(2)
+0008  CONST  2
+0009  CALL   print/1
+0010  DISCARD
@@ -0,0 +1,18 @@
+; 1: s = read_line()
+0000  CALL   read_line/0
+0001  STORE  s
+0002  DISCARD
+; 2: print(1)
+0003  CONST  1
+0004  CALL   print/1
+0005  DISCARD
+; 3: t = s + 1
+0006  CONST  1
+0007  LOAD   s
+0008  ADD
+0009  STORE  t
+0010  DISCARD
+; 4: print(2)
+0011  CONST  2
+0012  CALL   print/1
+0013  DISCARD
@@ -0,0 +1,8 @@
+; 1: print(1)
+0000  CONST  1
+0001  CALL   print/1
+0002  DISCARD
+; 2: nope(2)
+0003  CONST  2
+0004  CALL   nope/1
+0005  DISCARD
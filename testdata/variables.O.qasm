@@ -0,0 +1,15 @@
+; 2: print(x)
+0000  LOAD   x
+0001  CALL   print/1
+0002  DISCARD
+; 3: x = x + 1
+0003  INCLOCAL x 1
+; 4: y = x + 1
+0004  LOAD   x
+0005  ADDCONST 1
+0006  STOREPOP y
+; 5: print(x, y)
+0007  LOAD   y
+0008  LOAD   x
+0009  CALL   print/2
+0010  DISCARD
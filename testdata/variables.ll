@@ -0,0 +1,18 @@
+; ModuleID = "variables.qi"
+source_filename = "variables.qi"
+
+declare i64 @quinoa_print(i64, ...)
+declare i64 @quinoa_eprint(i64, ...)
+
+define i32 @main() {
+entry:
+  ; line 2
+  %0 = call i64 (i64, ...) @quinoa_print(i64 1, i64 0)
+  ; line 3
+  %x = add i64 0, 1
+  ; line 4
+  %y = add i64 %x, 1
+  ; line 5
+  %1 = call i64 (i64, ...) @quinoa_print(i64 2, i64 %x, i64 %y)
+  ret i32 0
+}
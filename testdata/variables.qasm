@@ -0,0 +1,21 @@
+; 2: print(x)
+0000  LOAD   x
+0001  CALL   print/1
+0002  DISCARD
+; 3: x = x + 1
+0003  CONST  1
+0004  LOAD   x
+0005  ADD
+0006  STORE  x
+0007  DISCARD
+; 4: y = x + 1
+0008  CONST  1
+0009  LOAD   x
+0010  ADD
+0011  STORE  y
+0012  DISCARD
+; 5: print(x, y)
+0013  LOAD   y
+0014  LOAD   x
+0015  CALL   print/2
+0016  DISCARD
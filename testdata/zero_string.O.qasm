@@ -0,0 +1,11 @@
+; 2: s = read_line()
+0000  CALL   read_line/0
+0001  STOREPOP s
+; 3: print(1)
+0002  CONST  1
+0003  CALL   print/1
+0004  DISCARD
+; 4: t = s + 0
+0005  LOAD   s
+0006  ADDCONST 0
+0007  STOREPOP t
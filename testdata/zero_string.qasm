@@ -0,0 +1,14 @@
+; 2: s = read_line()
+0000  CALL   read_line/0
+0001  STORE  s
+0002  DISCARD
+; 3: print(1)
+0003  CONST  1
+0004  CALL   print/1
+0005  DISCARD
+; 4: t = s + 0
+0006  CONST  0
+0007  LOAD   s
+0008  ADD
+0009  STORE  t
+0010  DISCARD
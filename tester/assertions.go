@@ -0,0 +1,127 @@
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bfontaine/quinoa/format"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+const assertThrows = "assert_throws"
+
+// An AssertionError is the failure of an assertion.
+type AssertionError struct {
+	Msg string
+}
+
+func (e *AssertionError) Error() string {
+	return e.Msg
+}
+
+// registerAssertions registers the assertion builtins in a VM. thunks are the
+// arguments of the calls of assert_throws; see delayThrows.
+func registerAssertions(machine *vm.VM, thunks []language.Grains) {
+	machine.Register("assert", builtin{-1, assertTrue})
+	machine.Register("assert_eq", builtin{2, assertEq})
+	machine.Register(assertThrows, builtin{1, func(machine *vm.VM, args []vm.Value) (vm.Value, error) {
+		return throws(machine, thunks, args)
+	}})
+}
+
+type builtin struct {
+	arity int
+	fn    func(machine *vm.VM, args []vm.Value) (vm.Value, error)
+}
+
+func (b builtin) Arity() int { return b.arity }
+
+func (b builtin) Call(machine *vm.VM, args []vm.Value) (vm.Value, error) {
+	return b.fn(machine, args)
+}
+
+// assert(value[, message]) fails if the value is false, zero or empty.
+func assertTrue(_ *vm.VM, args []vm.Value) (vm.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("assert() takes 1 or 2 arguments, got %d", len(args))
+	}
+
+	if truthy(args[0]) {
+		return nil, nil
+	}
+	if len(args) == 2 {
+		return nil, &AssertionError{fmt.Sprintf("Assertion failed: %s", vm.Format(args[1]))}
+	}
+	return nil, &AssertionError{fmt.Sprintf("Assertion failed: %s is falsy", vm.Repr(args[0]))}
+}
+
+func truthy(v vm.Value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []vm.Value:
+		return len(v) > 0
+	case map[string]vm.Value:
+		return len(v) > 0
+	}
+	return false
+}
+
+// assert_eq(expected, actual) fails if the values are different.
+func assertEq(_ *vm.VM, args []vm.Value) (vm.Value, error) {
+	expected, actual := args[0], args[1]
+	if reflect.DeepEqual(expected, actual) {
+		return nil, nil
+	}
+	return nil, &AssertionError{diff(expected, actual)}
+}
+
+// diff describes the difference between two values. Values that look the
+// same show their types, and multiline strings show their differences.
+func diff(expected, actual vm.Value) string {
+	e, a := vm.Repr(expected), vm.Repr(actual)
+	if e == a {
+		e += " (" + vm.TypeName(expected) + ")"
+		a += " (" + vm.TypeName(actual) + ")"
+	}
+
+	msg := fmt.Sprintf("Values aren't equal\nexpected: %s\n  actual: %s", e, a)
+
+	es, eok := expected.(string)
+	as, aok := actual.(string)
+	if eok && aok && (strings.Contains(es, "\n") || strings.Contains(as, "\n")) {
+		d := format.Diff("expected", "actual", []byte(es), []byte(as))
+		msg += "\n" + strings.TrimSuffix(string(d), "\n")
+	}
+	return msg
+}
+
+// assert_throws(expression) fails if the expression doesn't fail, and
+// returns its error message otherwise. The argument is the index of the
+// grains of the expression.
+func throws(machine *vm.VM, thunks []language.Grains, args []vm.Value) (vm.Value, error) {
+	i, ok := args[0].(int64)
+	if !ok || i < 0 || i >= int64(len(thunks)) {
+		return nil, errors.New("assert_throws() must be called with an expression")
+	}
+
+	v, err := machine.EvalContext(machine.Context(), thunks[i])
+	if err == nil {
+		return nil, &AssertionError{fmt.Sprintf("Expected an error, got %s", vm.Repr(v))}
+	}
+
+	var rerr *vm.RuntimeError
+	if errors.As(err, &rerr) {
+		err = rerr.Err
+	}
+	return err.Error(), nil
+}
@@ -0,0 +1,135 @@
+// Package tester runs the tests written in quinoa. A test file has top-level
+// statements, its setup, and test functions:
+//
+//	x = 1
+//
+//	fn test_add() {
+//	    assert_eq(3, x + 2)
+//	}
+//
+// The language has no functions, so the test functions are only understood
+// by the tester: the "fn test_...() {" and "}" lines must be on their own.
+// Each test runs the setup then its body in a new VM, where the assert,
+// assert_eq and assert_throws builtins are available. A file without test
+// functions is a single test.
+package tester
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	funcStart = regexp.MustCompile(`^\s*fn\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(\s*\)\s*\{\s*(#.*)?$`)
+	funcEnd   = regexp.MustCompile(`^\s*\}\s*(#.*)?$`)
+)
+
+// prefix of the names of the test functions
+const testPrefix = "test_"
+
+// A FileError is an invalid test function.
+type FileError struct {
+	Line int
+	Msg  string
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// A Test is a test function of a file.
+type Test struct {
+	Name string
+	// Line of its "fn" line
+	Line int
+
+	// lines of its body, starting at 1
+	first, last int
+}
+
+// A File is a parsed test file.
+type File struct {
+	Name   string
+	Source []byte
+	Tests  []*Test
+
+	lines []string
+	// setup[i] is true if the i-th line, starting at 0, is part of the setup
+	setup []bool
+}
+
+// ParseFile finds the test functions of a file.
+func ParseFile(filename string, source []byte) (*File, error) {
+	text := strings.Replace(string(source), "\r\n", "\n", -1)
+	f := &File{
+		Name:   filename,
+		Source: source,
+		lines:  strings.Split(text, "\n"),
+	}
+	f.setup = make([]bool, len(f.lines))
+
+	names := make(map[string]bool)
+	var current *Test
+
+	for i, line := range f.lines {
+		n := i + 1
+
+		if m := funcStart.FindStringSubmatch(line); m != nil {
+			if current != nil {
+				return nil, &FileError{n, "Functions can't be nested"}
+			}
+			name := m[1]
+			if !strings.HasPrefix(name, testPrefix) {
+				return nil, &FileError{n, fmt.Sprintf("Function '%s' isn't a test; only %s* functions are supported", name, testPrefix)}
+			}
+			if names[name] {
+				return nil, &FileError{n, fmt.Sprintf("Test '%s' is already defined", name)}
+			}
+			names[name] = true
+			current = &Test{Name: name, Line: n, first: n + 1}
+			continue
+		}
+
+		if current != nil && funcEnd.MatchString(line) {
+			current.last = n - 1
+			f.Tests = append(f.Tests, current)
+			current = nil
+			continue
+		}
+
+		f.setup[i] = current == nil
+	}
+
+	if current != nil {
+		return nil, &FileError{current.Line, fmt.Sprintf("Test '%s' isn't closed", current.Name)}
+	}
+
+	return f, nil
+}
+
+// program returns the source code of a test: the setup and its body. The
+// other lines are blank, so that the lines of the program are the ones of
+// the file. Without test, it's the setup.
+func (f *File) program(t *Test) string {
+	lines := make([]string, len(f.lines))
+	for i, line := range f.lines {
+		n := i + 1
+		if f.setup[i] || (t != nil && t.first <= n && n <= t.last) {
+			lines[i] = line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasCode tests if a program has statements, since an empty program isn't
+// valid.
+func hasCode(program string) bool {
+	for _, line := range strings.Split(program, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return true
+		}
+	}
+	return false
+}
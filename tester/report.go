@@ -0,0 +1,202 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// FullName returns the name of the test of a result, e.g. "foo_test.qi:
+// test_add", or the name of its file.
+func (r *Result) FullName() string {
+	if r.Name == "" {
+		return r.File
+	}
+	return r.File + ": " + r.Name
+}
+
+// Summary counts the passed and failed tests.
+func Summary(results []*Result) (passed, failed int) {
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// WriteText writes the results for humans: the failures with their output,
+// then a line per file and a summary. verbose also lists the tests that
+// passed, with their output.
+func WriteText(w io.Writer, results []*Result, verbose bool) error {
+	var b strings.Builder
+
+	for _, file := range byFile(results) {
+		var duration time.Duration
+		failed := false
+
+		for _, r := range file {
+			duration += r.Duration
+			if r.Passed() && !verbose {
+				continue
+			}
+
+			status := "PASS"
+			if !r.Passed() {
+				status = "FAIL"
+				failed = true
+			}
+			fmt.Fprintf(&b, "--- %s: %s (%s)\n", status, r.FullName(), seconds(r.Duration))
+			if !r.Passed() {
+				fmt.Fprintf(&b, "%s\n", indent(r.Location()+": "+r.Message(), "    "))
+			}
+			if r.Output != "" {
+				fmt.Fprintf(&b, "    output:\n%s\n", indent(strings.TrimSuffix(r.Output, "\n"), "        "))
+			}
+		}
+
+		status := "ok  "
+		if failed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", status, file[0].File, seconds(duration))
+	}
+
+	passed, failed := Summary(results)
+	fmt.Fprintf(&b, "\n%d passed, %d failed\n", passed, failed)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTAP writes the results in the Test Anything Protocol, version 13. The
+// failures have a YAML block with their message, location and output.
+func WriteTAP(w io.Writer, results []*Result) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(results))
+	for i, r := range results {
+		if r.Passed() {
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, r.FullName())
+			continue
+		}
+
+		fmt.Fprintf(&b, "not ok %d - %s\n", i+1, r.FullName())
+		b.WriteString("  ---\n")
+		fmt.Fprintf(&b, "  message: |\n%s\n", indent(r.Message(), "    "))
+		fmt.Fprintf(&b, "  at: %q\n", r.Location())
+		if r.Output != "" {
+			fmt.Fprintf(&b, "  output: |\n%s\n", indent(strings.TrimSuffix(r.Output, "\n"), "    "))
+		}
+		b.WriteString("  ...\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results in the JUnit XML format, with a test suite
+// per file.
+func WriteJUnit(w io.Writer, results []*Result) error {
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", d.Seconds())
+	}
+
+	suites := junitSuites{Tests: len(results)}
+	var total time.Duration
+
+	for _, file := range byFile(results) {
+		suite := junitSuite{Name: file[0].File, Tests: len(file)}
+		var duration time.Duration
+
+		for _, r := range file {
+			name := r.Name
+			if name == "" {
+				name = r.File
+			}
+			c := junitCase{Name: name, ClassName: r.File, Time: seconds(r.Duration), SystemOut: r.Output}
+			if !r.Passed() {
+				c.Failure = &junitFailure{
+					Message: firstLine(r.Message()),
+					Text:    r.Location() + ": " + r.Message(),
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, c)
+			duration += r.Duration
+		}
+
+		suite.Time = seconds(duration)
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+		total += duration
+	}
+	suites.Time = seconds(total)
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+// byFile groups consecutive results by file.
+func byFile(results []*Result) [][]*Result {
+	var files [][]*Result
+	for i, r := range results {
+		if i == 0 || r.File != results[i-1].File {
+			files = append(files, nil)
+		}
+		files[len(files)-1] = append(files[len(files)-1], r)
+	}
+	return files
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.Replace(text, "\n", "\n"+prefix, -1)
+}
+
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
@@ -0,0 +1,194 @@
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bfontaine/quinoa/compiler"
+	"github.com/bfontaine/quinoa/coverage"
+	"github.com/bfontaine/quinoa/language"
+	"github.com/bfontaine/quinoa/parser"
+	"github.com/bfontaine/quinoa/vm"
+)
+
+// A Result is the result of a test.
+type Result struct {
+	File string
+	// Name of the test function, or "" for a file without test functions
+	Name string
+	// Line of the test function, or 0
+	Line int
+
+	// Err is nil if the test passed
+	Err error
+	// Output is what the test printed on its standard output and error
+	Output   string
+	Duration time.Duration
+}
+
+// Passed tests if the test passed.
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Location returns where the test failed, e.g. "foo_test.qi:3", or the name
+// of its file if the line is unknown.
+func (r *Result) Location() string {
+	var rerr *vm.RuntimeError
+	var ferr *FileError
+	switch {
+	case errors.As(r.Err, &rerr) && rerr.Line > 0:
+		return fmt.Sprintf("%s:%d", r.File, rerr.Line)
+	case errors.As(r.Err, &ferr):
+		return fmt.Sprintf("%s:%d", r.File, ferr.Line)
+	}
+	return r.File
+}
+
+// Message returns why the test failed, without its location if Location
+// has it.
+func (r *Result) Message() string {
+	var rerr *vm.RuntimeError
+	var ferr *FileError
+	switch {
+	case r.Err == nil:
+		return ""
+	case errors.As(r.Err, &rerr) && rerr.Line > 0:
+		return rerr.Err.Error()
+	case errors.As(r.Err, &ferr):
+		return ferr.Msg
+	}
+	return strings.TrimSpace(r.Err.Error())
+}
+
+// A Runner runs tests.
+type Runner struct {
+	// Configure, if not nil, is called with the VM of each test before it
+	// runs, e.g. to allow capabilities.
+	Configure func(machine *vm.VM)
+
+	// Coverage, if not nil, records the coverage of the tests.
+	Coverage *coverage.Profile
+}
+
+// RunFile runs the tests of a file, in order. If the file can't be parsed,
+// the result is a single failure.
+func (r *Runner) RunFile(filename string, source []byte) []*Result {
+	f, err := ParseFile(filename, source)
+	if err != nil {
+		return []*Result{{File: filename, Err: err}}
+	}
+
+	if len(f.Tests) == 0 {
+		return []*Result{r.run(f, nil)}
+	}
+
+	results := make([]*Result, len(f.Tests))
+	for i, t := range f.Tests {
+		results[i] = r.run(f, t)
+	}
+	return results
+}
+
+// run runs a test, or the setup of a file without tests, in a new VM.
+func (r *Runner) run(f *File, t *Test) *Result {
+	res := &Result{File: f.Name}
+	if t != nil {
+		res.Name, res.Line = t.Name, t.Line
+	}
+
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	program := f.program(t)
+	if !hasCode(program) {
+		return res
+	}
+
+	root, err := parser.Parse(program, false)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	code, err := compiler.CompileGrains(root)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	var thunks []language.Grains
+	code, err = delayThrows(code, &thunks)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	var output bytes.Buffer
+	machine := vm.NewVM(false)
+	machine.Stdin = &bytes.Buffer{}
+	machine.Stdout = &output
+	machine.Stderr = &output
+	registerAssertions(machine, thunks)
+	if r.Configure != nil {
+		r.Configure(machine)
+	}
+
+	var counter *coverage.Counter
+	if r.Coverage != nil {
+		counter = coverage.NewCounter(code)
+		machine.Hook = counter
+	}
+
+	res.Err = machine.Run(code)
+	res.Output = output.String()
+
+	if counter != nil {
+		// failed tests count too
+		r.Coverage.Add(f.Name, f.Source, counter)
+	}
+	return res
+}
+
+// delayThrows replaces the argument of every call of assert_throws by a
+// constant, the index of its grains in thunks, so that assert_throws can
+// evaluate it and catch its error. The arguments of calls are pushed right
+// before them, and leave one value on the stack.
+func delayThrows(code language.Grains, thunks *[]language.Grains) (language.Grains, error) {
+	v, err := language.Verify(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// from the end, so that the calls in arguments are replaced with them
+	for pc := len(code) - 1; pc >= 0; pc-- {
+		g := code[pc]
+		if g.OpCode != language.CallOpCode || g.Name != assertThrows || g.PopN != 1 {
+			continue
+		}
+
+		// the argument starts at the last grain with the depth before it
+		start := pc - 1
+		for v.Depths[start] != v.Depths[pc]-1 {
+			start--
+		}
+
+		thunk, err := delayThrows(code[start:pc], thunks)
+		if err != nil {
+			return nil, err
+		}
+		index := int64(len(*thunks))
+		*thunks = append(*thunks, thunk)
+
+		delayed := make(language.Grains, 0, len(code)-(pc-start)+1)
+		delayed = append(delayed, code[:start]...)
+		delayed = append(delayed, language.Grain{OpCode: language.ConstOpCode, Value: index, Line: g.Line})
+		delayed = append(delayed, code[pc:]...)
+		code = delayed
+		pc = start
+	}
+
+	return code, nil
+}
@@ -0,0 +1,200 @@
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/bfontaine/quinoa/coverage"
+	"github.com/bfontaine/quinoa/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func runFile(t *testing.T, r *Runner, filename string) []*Result {
+	source, err := ioutil.ReadFile(filename)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	return r.RunFile(filename, source)
+}
+
+func TestRunFile(t *testing.T) {
+	profile := coverage.NewProfile()
+	r := &Runner{Coverage: profile}
+	results := runFile(t, r, "testdata/math_test.qi")
+
+	type summary struct {
+		name, location, message, output string
+	}
+	var summaries []summary
+	for _, res := range results {
+		summaries = append(summaries, summary{res.Name, res.Location(), res.Message(), res.Output})
+	}
+
+	assert.Equal(t, []summary{
+		{"test_add", "testdata/math_test.qi", "", ""},
+		{"test_fails", "testdata/math_test.qi:13", "Values aren't equal\nexpected: 5\n  actual: 2", "2\n"},
+		{"test_throws", "testdata/math_test.qi", "", ""},
+		{"test_no_throw", "testdata/math_test.qi:22", "Expected an error, got 3", ""},
+		{"test_assert", "testdata/math_test.qi:26", "Assertion failed: 42", ""},
+		{"test_empty", "testdata/math_test.qi", "", ""},
+	}, summaries)
+
+	assert.Equal(t, 5, results[0].Line)
+	var aerr *AssertionError
+	assert.True(t, errors.As(results[1].Err, &aerr))
+
+	passed, failed := Summary(results)
+	assert.Equal(t, 3, passed)
+	assert.Equal(t, 3, failed)
+
+	// the setup runs for every test but the empty one
+	lines := profile.Files()[0].Lines
+	assert.Equal(t, int64(6), lines[2])
+	assert.Equal(t, int64(1), lines[12])
+	assert.Equal(t, int64(1), lines[13])
+	assert.Equal(t, int64(1), lines[18])
+	_, ok := lines[30]
+	assert.False(t, ok)
+}
+
+func TestRunFileConfigure(t *testing.T) {
+	r := &Runner{Configure: func(machine *vm.VM) {
+		machine.RegisterFunc("nope", 1, func(args []vm.Value) (vm.Value, error) { return args[0], nil })
+	}}
+	results := r.RunFile("a_test.qi", []byte("fn test_nope() {\n    assert_eq(1, nope(1))\n}\n"))
+	assert.Equal(t, 1, len(results))
+	assert.Nil(t, results[0].Err)
+}
+
+func TestRunFileWithoutTests(t *testing.T) {
+	r := &Runner{}
+
+	results := r.RunFile("a_test.qi", []byte("a = 1\nassert_eq(2, a)\n"))
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "", results[0].Name)
+	assert.Equal(t, "a_test.qi:2", results[0].Location())
+
+	results = r.RunFile("b_test.qi", []byte("# nothing\n"))
+	assert.Nil(t, results[0].Err)
+}
+
+func TestParseFileErrors(t *testing.T) {
+	for source, msg := range map[string]string{
+		"fn test_a() {\n":                                  "line 1: Test 'test_a' isn't closed",
+		"fn test_a() {\nfn test_b() {\n}\n":                "line 2: Functions can't be nested",
+		"fn helper() {\n}\n":                               "line 1: Function 'helper' isn't a test; only test_* functions are supported",
+		"fn test_a() {\n}\nfn test_a() {\n}\n":             "line 3: Test 'test_a' is already defined",
+		"a = 1\nfn test_a() {  # comment\n}  # comment\n}": "",
+	} {
+		_, err := ParseFile("a_test.qi", []byte(source))
+		if msg == "" {
+			assert.Nil(t, err, source)
+			continue
+		}
+		if assert.NotNil(t, err, source) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+
+	r := &Runner{}
+	results := r.RunFile("a_test.qi", []byte("fn test_a() {\n"))
+	assert.Equal(t, "a_test.qi:1", results[0].Location())
+	assert.Equal(t, "Test 'test_a' isn't closed", results[0].Message())
+}
+
+func TestProgram(t *testing.T) {
+	f, err := ParseFile("a_test.qi", []byte("a = 1\nfn test_a() {\n  b = 2\n}\nc = 3\nfn test_b() {\n  d = 4\n}\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(f.Tests))
+	assert.Equal(t, "a = 1\n\n  b = 2\n\nc = 3\n\n\n\n", f.program(f.Tests[0]))
+	assert.Equal(t, "a = 1\n\n\n\nc = 3\n\n  d = 4\n\n", f.program(f.Tests[1]))
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "Values aren't equal\nexpected: 1 (int)\n  actual: 1 (float)", diff(int64(1), float64(1)))
+	assert.Equal(t, `Values aren't equal
+expected: "a\nb\nc"
+  actual: "a\nB\nc"
+--- expected
++++ actual
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+\ No newline at end of file`, diff("a\nb\nc", "a\nB\nc"))
+}
+
+func testResults() []*Result {
+	return []*Result{
+		{File: "a_test.qi", Name: "test_ok", Line: 1, Duration: time.Millisecond, Output: "hello\n"},
+		{File: "a_test.qi", Name: "test_ko", Line: 5, Duration: 2 * time.Millisecond,
+			Err: &vm.RuntimeError{Err: &AssertionError{"Values aren't equal\nexpected: 1\n  actual: 2"}, Line: 6}},
+		{File: "b_test.qi", Duration: time.Millisecond},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, WriteText(&b, testResults(), false))
+	assert.Equal(t, `--- FAIL: a_test.qi: test_ko (0.002s)
+    a_test.qi:6: Values aren't equal
+    expected: 1
+      actual: 2
+FAIL	a_test.qi	0.003s
+ok  	b_test.qi	0.001s
+
+2 passed, 1 failed
+`, b.String())
+
+	b.Reset()
+	assert.Nil(t, WriteText(&b, testResults()[:1], true))
+	assert.Equal(t, `--- PASS: a_test.qi: test_ok (0.001s)
+    output:
+        hello
+ok  	a_test.qi	0.001s
+
+1 passed, 0 failed
+`, b.String())
+}
+
+func TestWriteTAP(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, WriteTAP(&b, testResults()))
+	assert.Equal(t, `TAP version 13
+1..3
+ok 1 - a_test.qi: test_ok
+not ok 2 - a_test.qi: test_ko
+  ---
+  message: |
+    Values aren't equal
+    expected: 1
+      actual: 2
+  at: "a_test.qi:6"
+  ...
+ok 3 - b_test.qi
+`, b.String())
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, WriteJUnit(&b, testResults()))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" time="0.004">
+  <testsuite name="a_test.qi" tests="2" failures="1" time="0.003">
+    <testcase name="test_ok" classname="a_test.qi" time="0.001">
+      <system-out>hello&#xA;</system-out>
+    </testcase>
+    <testcase name="test_ko" classname="a_test.qi" time="0.002">
+      <failure message="Values aren&#39;t equal">a_test.qi:6: Values aren&#39;t equal&#xA;expected: 1&#xA;  actual: 2</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.qi" tests="1" failures="0" time="0.001">
+    <testcase name="b_test.qi" classname="b_test.qi" time="0.001"></testcase>
+  </testsuite>
+</testsuites>
+`, b.String())
+}
@@ -0,0 +1,282 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Builtin is a function implemented in Go that programs can call.
+type Builtin interface {
+	// Arity returns the number of arguments of the function, or -1 if it
+	// takes any number of arguments.
+	Arity() int
+
+	// Call calls the function with the arguments in the order of the call.
+	// A nil result is the value 0. A returned error stops the program with
+	// a RuntimeError that wraps it.
+	Call(vm *VM, args []Value) (Value, error)
+}
+
+// A Func is a function that can be registered with RegisterFunc.
+type Func func(args []Value) (Value, error)
+
+// NewBuiltin returns a Builtin that calls fn with arity arguments, or any
+// number of arguments if arity is -1.
+func NewBuiltin(arity int, fn Func) Builtin {
+	return &funcBuiltin{arity: arity, fn: fn}
+}
+
+type funcBuiltin struct {
+	arity int
+	fn    Func
+}
+
+func (b *funcBuiltin) Arity() int { return b.arity }
+
+func (b *funcBuiltin) Call(_ *VM, args []Value) (Value, error) {
+	return b.fn(args)
+}
+
+// vmBuiltin is a builtin that needs the VM that calls it.
+type vmBuiltin struct {
+	arity int
+	fn    func(vm *VM, args []Value) (Value, error)
+}
+
+func (b *vmBuiltin) Arity() int { return b.arity }
+
+func (b *vmBuiltin) Call(vm *VM, args []Value) (Value, error) {
+	return b.fn(vm, args)
+}
+
+// builtins available to all VMs
+var (
+	builtinsLock sync.RWMutex
+	builtins     = make(map[string]Builtin)
+)
+
+// Register makes a builtin available to the programs of all VMs. It replaces
+// any builtin registered under the same name.
+func Register(name string, b Builtin) {
+	if b == nil {
+		panic("vm: Register of a nil builtin")
+	}
+
+	builtinsLock.Lock()
+	defer builtinsLock.Unlock()
+	builtins[name] = b
+}
+
+// RegisterFunc makes fn available to the programs of all VMs as a function
+// with arity arguments, or any number of arguments if arity is -1.
+func RegisterFunc(name string, arity int, fn Func) {
+	Register(name, NewBuiltin(arity, fn))
+}
+
+// RegisterGoFunc makes an ordinary Go function available to the programs of
+// all VMs. See WrapFunc for the supported functions.
+func RegisterGoFunc(name string, fn interface{}) error {
+	b, err := WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	Register(name, b)
+	return nil
+}
+
+// Builtins returns the sorted names of the builtins available to all VMs.
+func Builtins() []string {
+	builtinsLock.RLock()
+	defer builtinsLock.RUnlock()
+
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBuiltin returns the builtin available to all VMs under a name, or
+// nil.
+func LookupBuiltin(name string) Builtin {
+	builtinsLock.RLock()
+	defer builtinsLock.RUnlock()
+	return builtins[name]
+}
+
+// Register makes a builtin available to the programs of this VM only. It
+// takes precedence over the builtins available to all VMs.
+func (vm *VM) Register(name string, b Builtin) {
+	if b == nil {
+		panic("vm: Register of a nil builtin")
+	}
+
+	if vm.builtins == nil {
+		vm.builtins = make(map[string]Builtin)
+	}
+	vm.builtins[name] = b
+}
+
+// RegisterFunc is like the RegisterFunc function, for this VM only.
+func (vm *VM) RegisterFunc(name string, arity int, fn Func) {
+	vm.Register(name, NewBuiltin(arity, fn))
+}
+
+// RegisterGoFunc is like the RegisterGoFunc function, for this VM only.
+func (vm *VM) RegisterGoFunc(name string, fn interface{}) error {
+	b, err := WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	vm.Register(name, b)
+	return nil
+}
+
+// builtin returns the builtin registered under a name, or nil.
+func (vm *VM) builtin(name string) Builtin {
+	if b, ok := vm.builtins[name]; ok {
+		return b
+	}
+
+	builtinsLock.RLock()
+	defer builtinsLock.RUnlock()
+	return builtins[name]
+}
+
+// call calls a builtin. Panics are turned into errors so that a buggy
+// builtin can't crash its host.
+func (vm *VM) call(name string, args []Value) (ret Value, err error) {
+	b := vm.builtin(name)
+	if b == nil {
+		return nil, fmt.Errorf("Unknown function '%s'", name)
+	}
+
+	if arity := b.Arity(); arity >= 0 && len(args) != arity {
+		return nil, fmt.Errorf("%s() takes %s, got %d", name, plural(arity, "argument"), len(args))
+	}
+
+	if err := vm.checkCapabilities(name, b); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ret, err = nil, fmt.Errorf("%s() panicked: %v", name, r)
+		}
+	}()
+
+	ret, err = b.Call(vm, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret == nil {
+		return int64(0), nil
+	}
+	if !isValue(ret) {
+		return nil, fmt.Errorf("%s() returned an unsupported value of type %T", name, ret)
+	}
+
+	return ret, nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func init() {
+	Register("print", &vmBuiltin{-1, builtinPrint})
+	Register("eprint", &vmBuiltin{-1, builtinEprint})
+	Register("input", &vmBuiltin{-1, builtinInput})
+	Register("read_line", &vmBuiltin{0, builtinReadLine})
+	Register("argc", &vmBuiltin{0, builtinArgc})
+	Register("arg", &vmBuiltin{1, builtinArg})
+}
+
+// formatArgs formats the arguments of print() and eprint().
+func formatArgs(args []Value) string {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = Format(arg)
+	}
+	return strings.Join(s, " ")
+}
+
+// print(args...) prints its arguments separated by spaces.
+func builtinPrint(vm *VM, args []Value) (Value, error) {
+	_, err := fmt.Fprintln(vm.Output(), formatArgs(args))
+	return nil, err
+}
+
+// eprint(args...) is like print(), on the standard error.
+func builtinEprint(vm *VM, args []Value) (Value, error) {
+	// keep the order of the outputs if both streams go to the same place
+	if err := vm.Flush(); err != nil {
+		return nil, err
+	}
+
+	if vm.Stderr == nil {
+		return nil, nil
+	}
+	_, err := fmt.Fprintln(vm.Stderr, formatArgs(args))
+	return nil, err
+}
+
+// input([prompt]) prints the prompt, then reads a line. It fails at the end
+// of the input.
+func builtinInput(vm *VM, args []Value) (Value, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("input() takes at most 1 argument, got %d", len(args))
+	}
+	if len(args) == 1 {
+		if _, err := fmt.Fprint(vm.Output(), Format(args[0])); err != nil {
+			return nil, err
+		}
+	}
+
+	line, err := vm.readLine()
+	if err == io.EOF {
+		return nil, errors.New("End of input")
+	}
+	return line, err
+}
+
+// read_line() reads a line, or returns "" at the end of the input.
+func builtinReadLine(vm *VM, args []Value) (Value, error) {
+	line, err := vm.readLine()
+	if err == io.EOF {
+		return "", nil
+	}
+	return line, err
+}
+
+// argc() returns the number of command-line arguments of the program.
+func builtinArgc(vm *VM, args []Value) (Value, error) {
+	return int64(len(vm.Args)), nil
+}
+
+// arg(i) returns the i-th command-line argument of the program, as an
+// integer if it's one.
+func builtinArg(vm *VM, args []Value) (Value, error) {
+	i, ok := args[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("arg() takes an int, got %s", TypeName(args[0]))
+	}
+	if i < 0 || i >= int64(len(vm.Args)) {
+		return nil, fmt.Errorf("No argument %d; there are %d arguments", i, len(vm.Args))
+	}
+
+	if v, err := strconv.ParseInt(vm.Args[i], 10, 64); err == nil {
+		return v, nil
+	}
+	return vm.Args[i], nil
+}
@@ -0,0 +1,325 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.RegisterFunc("double", 1, func(args []Value) (Value, error) {
+		return args[0].(int64) * 2, nil
+	})
+
+	v, err := vm.Eval(assemble(t, "CONST 21\nCALL double/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), v)
+
+	err = vm.Run(assemble(t, "; 3\nCONST 1\nCONST 2\nCALL double/2\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 3: double() takes 1 argument, got 2", err.Error())
+	}
+
+	// per-VM builtins aren't visible from other VMs
+	_, err = NewVM(false).Eval(assemble(t, "CONST 21\nCALL double/1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Unknown function 'double'", err.Error())
+	}
+}
+
+func TestRegisterFuncGlobal(t *testing.T) {
+	RegisterFunc("test_answer", 0, func(args []Value) (Value, error) {
+		return int64(42), nil
+	})
+
+	v, err := NewVM(false).Eval(assemble(t, "CALL test_answer/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), v)
+
+	// builtins of a VM take precedence
+	vm := NewVM(false)
+	vm.RegisterFunc("test_answer", 0, func(args []Value) (Value, error) {
+		return int64(1), nil
+	})
+	v, err = vm.Eval(assemble(t, "CALL test_answer/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), v)
+
+	assert.Contains(t, Builtins(), "test_answer")
+	if b := LookupBuiltin("test_answer"); assert.NotNil(t, b) {
+		assert.Equal(t, 0, b.Arity())
+	}
+	assert.Nil(t, LookupBuiltin("test_question"))
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	errBoom := errors.New("Boom")
+
+	vm := NewVM(testing.Verbose())
+	vm.RegisterFunc("fail", 0, func(args []Value) (Value, error) {
+		return nil, errBoom
+	})
+	vm.RegisterFunc("crash", 0, func(args []Value) (Value, error) {
+		panic("oops")
+	})
+	vm.RegisterFunc("nothing", 0, func(args []Value) (Value, error) {
+		return nil, nil
+	})
+	vm.RegisterFunc("invalid", 0, func(args []Value) (Value, error) {
+		return struct{}{}, nil
+	})
+
+	err := vm.Run(assemble(t, "; 2\nCALL fail/0\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, errBoom))
+		assert.Equal(t, "line 2: Boom", err.Error())
+		assert.Equal(t, 0, err.(*RuntimeError).PC)
+	}
+
+	_, err = vm.Eval(assemble(t, "CALL crash/0"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "crash() panicked: oops", err.Error())
+	}
+
+	v, err := vm.Eval(assemble(t, "CALL nothing/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), v)
+
+	_, err = vm.Eval(assemble(t, "CALL invalid/0"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "invalid() returned an unsupported value of type struct {}", err.Error())
+	}
+}
+
+func TestRegisterGoFunc(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	for name, fn := range map[string]interface{}{
+		"half":  func(x float64) float64 { return x / 2 },
+		"upper": strings.ToUpper,
+		"not":   func(b bool) bool { return !b },
+		"sum": func(xs ...int) int {
+			s := 0
+			for _, x := range xs {
+				s += x
+			}
+			return s
+		},
+		"chars": func(n uint8) []string {
+			s := make([]string, n)
+			for i := range s {
+				s[i] = string(rune('a' + i))
+			}
+			return s
+		},
+		"counts": func(s []string) map[string]int {
+			m := make(map[string]int)
+			for _, k := range s {
+				m[k]++
+			}
+			return m
+		},
+		"check": func(x int64) error {
+			if x < 0 {
+				return fmt.Errorf("%d is negative", x)
+			}
+			return nil
+		},
+		"div": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("Division by zero")
+			}
+			return a / b, nil
+		},
+		"id": func(v interface{}) Value { return v },
+	} {
+		assert.Nil(t, vm.RegisterGoFunc(name, fn), name)
+	}
+
+	for _, tc := range []struct {
+		code     string
+		expected Value
+	}{
+		{"CONST 3\nCALL half/1", 1.5},
+		{"CONST 1\nCONST 2\nCONST 3\nCALL sum/3", int64(6)},
+		{"CALL sum/0", int64(0)},
+		{"CONST 3\nCALL chars/1", []Value{"a", "b", "c"}},
+		{"CONST 2\nCALL check/1", int64(0)},
+		{"CONST 2\nCONST 7\nCALL div/2", int64(3)},
+		{"CONST 7\nCALL id/1", int64(7)},
+	} {
+		v, err := vm.Eval(assemble(t, tc.code))
+		if assert.Nil(t, err, tc.code) {
+			assert.Equal(t, tc.expected, v, tc.code)
+		}
+	}
+
+	for _, tc := range []struct {
+		code     string
+		expected string
+	}{
+		{"CONST 1\nCALL upper/1", "Argument 1: Cannot use 1 as string"},
+		{"CONST 256\nCALL chars/1", "Argument 1: Cannot use 256 as uint8"},
+		{"CONST -1\nCALL chars/1", "Argument 1: Cannot use -1 as uint8"},
+		{"CONST 2\nCALL chars/1\nCALL not/1", "Argument 1: Cannot use a list as bool"},
+		{"CONST -1\nCALL check/1", "-1 is negative"},
+		{"CONST 0\nCONST 7\nCALL div/2", "Division by zero"},
+		{"CONST 1\nCALL chars/1\nCALL counts/1\nCALL half/1", "Argument 1: Cannot use a map as float64"},
+	} {
+		_, err := vm.Eval(assemble(t, tc.code))
+		if assert.NotNil(t, err, tc.code) {
+			assert.Equal(t, tc.expected, err.Error(), tc.code)
+		}
+	}
+
+	v, err := vm.Eval(assemble(t, "CONST 2\nCALL chars/1\nCALL counts/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]Value{"a": int64(1), "b": int64(1)}, v)
+}
+
+func TestWrapFuncRejectsUnsupportedFunctions(t *testing.T) {
+	for _, fn := range []interface{}{
+		42,
+		(func())(nil),
+		func(ch chan int) {},
+		func(m map[int]string) {},
+		func() *int { return nil },
+		func() (int, int) { return 0, 0 },
+		func() (error, int) { return nil, 0 },
+	} {
+		_, err := WrapFunc(fn)
+		assert.NotNil(t, err, "%T", fn)
+	}
+}
+
+func TestAddTypes(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	assert.Nil(t, vm.RegisterGoFunc("str", func(s string) string { return s + "!" }))
+	assert.Nil(t, vm.RegisterGoFunc("hi", func() string { return "hi" }))
+	assert.Nil(t, vm.RegisterGoFunc("float", func(f float64) float64 { return f }))
+	assert.Nil(t, vm.RegisterGoFunc("yes", func() bool { return true }))
+
+	v, err := vm.Eval(assemble(t, "CONST 1\nCALL float/1\nCONST 2\nADD"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, v)
+
+	v, err = vm.Eval(assemble(t, "CALL hi/0\nCALL hi/0\nCALL str/1\nADD"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hi!hi", v)
+
+	_, err = vm.Eval(assemble(t, "; 4\nCALL yes/0\nCONST 2\nADD"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 4: Cannot add int and bool", err.Error())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		v         Value
+		formatted string
+		repr      string
+	}{
+		{int64(-3), "-3", "-3"},
+		{1.5, "1.5", "1.5"},
+		{"a\"b", "a\"b", `"a\"b"`},
+		{true, "true", "true"},
+		{[]Value{int64(1), "x"}, `[1, "x"]`, `[1, "x"]`},
+		{map[string]Value{"b": []Value{}, "a": false}, `{"a": false, "b": []}`, `{"a": false, "b": []}`},
+	} {
+		assert.Equal(t, tc.formatted, Format(tc.v))
+		assert.Equal(t, tc.repr, Repr(tc.v))
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	vm := NewVM(testing.Verbose())
+	vm.Stdout = &out
+	vm.Stderr = &errOut
+	vm.RegisterFunc("check", 0, func(args []Value) (Value, error) {
+		// the output is buffered during the run
+		assert.Equal(t, "", out.String())
+		return nil, nil
+	})
+
+	assert.Nil(t, vm.Run(assemble(t, "CONST 2\nCONST 1\nCALL print/2\nCALL check/0\nCALL print/0\nDISCARD\nDISCARD\nDISCARD")))
+	assert.Equal(t, "1 2\n\n", out.String())
+
+	// the output is flushed before failures and writes to the standard error
+	out.Reset()
+	err := vm.Run(assemble(t, "CONST 1\nCALL print/1\nDISCARD\nCONST 2\nCALL eprint/1\nDISCARD\nCALL out/0\nDISCARD"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "1\n", out.String())
+	assert.Equal(t, "2\n", errOut.String())
+
+	// streams can be changed between runs
+	var out2 bytes.Buffer
+	vm.Stdout = &out2
+	assert.Nil(t, vm.Run(assemble(t, "CONST 3\nCALL print/1\nDISCARD")))
+	assert.Equal(t, "1\n", out.String())
+	assert.Equal(t, "3\n", out2.String())
+}
+
+func TestInput(t *testing.T) {
+	var out bytes.Buffer
+
+	vm := NewVM(testing.Verbose())
+	vm.Stdin = strings.NewReader("Alice\nBob\r\nCarol")
+	vm.Stdout = &out
+
+	v, err := vm.Eval(assemble(t, "CONST 1\nCALL print/1\nDISCARD\nCALL name/0\nCALL input/1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Unknown function 'name'", err.Error())
+	}
+
+	assert.Nil(t, vm.RegisterGoFunc("name", func() string { return "Name? " }))
+
+	v, err = vm.Eval(assemble(t, "CALL name/0\nCALL input/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice", v)
+	assert.Equal(t, "1\nName? ", out.String())
+
+	for _, expected := range []string{"Bob", "Carol", "", ""} {
+		v, err = vm.Eval(assemble(t, "CALL read_line/0"))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, v)
+	}
+
+	_, err = vm.Eval(assemble(t, "; 1\nCALL input/0"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 1: End of input", err.Error())
+	}
+
+	vm.Stdin = nil
+	v, err = vm.Eval(assemble(t, "CALL read_line/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", v)
+}
+
+func TestArg(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.Args = []string{"42", "a.txt"}
+
+	v, err := vm.Eval(assemble(t, "CALL argc/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), v)
+
+	v, err = vm.Eval(assemble(t, "CONST 0\nCALL arg/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), v)
+
+	v, err = vm.Eval(assemble(t, "CONST 1\nCALL arg/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a.txt", v)
+
+	_, err = vm.Eval(assemble(t, "CONST 2\nCALL arg/1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "No argument 2; there are 2 arguments", err.Error())
+	}
+}
@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A Capability is a permission to access the world outside of the VM.
+// Builtins that need capabilities fail with ErrPermissionDenied unless the VM
+// allows them.
+type Capability string
+
+const (
+	CapFSRead  Capability = "fs:read"
+	CapFSWrite Capability = "fs:write"
+	CapEnv     Capability = "env"
+	CapClock   Capability = "clock"
+	CapExec    Capability = "exec"
+)
+
+// A CapabilityBuiltin is a Builtin that needs capabilities. The VM checks that
+// they're allowed before calling it.
+type CapabilityBuiltin interface {
+	Builtin
+	Capabilities() []Capability
+}
+
+// WithCapabilities returns a builtin that calls b and needs caps.
+func WithCapabilities(b Builtin, caps ...Capability) CapabilityBuiltin {
+	return &capBuiltin{Builtin: b, caps: caps}
+}
+
+type capBuiltin struct {
+	Builtin
+	caps []Capability
+}
+
+func (b *capBuiltin) Capabilities() []Capability { return b.caps }
+
+// grant is an allowed capability, possibly restricted to some resources
+type grant struct {
+	all       bool
+	resources []string
+}
+
+// Allow allows a capability. If resources are given, it's restricted to them:
+// directories for CapFSRead and CapFSWrite, names of variables for CapEnv and
+// names of commands for CapExec. Otherwise it's allowed for everything.
+func (vm *VM) Allow(c Capability, resources ...string) {
+	if vm.caps == nil {
+		vm.caps = make(map[Capability]*grant)
+	}
+
+	g := vm.caps[c]
+	if g == nil {
+		g = &grant{}
+		vm.caps[c] = g
+	}
+
+	if len(resources) == 0 {
+		g.all = true
+	}
+	g.resources = append(g.resources, resources...)
+}
+
+// Deny denies a capability, which is the default.
+func (vm *VM) Deny(c Capability) {
+	delete(vm.caps, c)
+}
+
+// Allowed tests if a capability is allowed for a resource. An empty resource
+// tests if it's allowed for any resource.
+func (vm *VM) Allowed(c Capability, resource string) bool {
+	g := vm.caps[c]
+	if g == nil {
+		return false
+	}
+	if g.all || resource == "" {
+		return true
+	}
+
+	for _, r := range g.resources {
+		switch c {
+		case CapFSRead, CapFSWrite:
+			if isInDir(resource, r) {
+				return true
+			}
+		default:
+			if resource == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns an error wrapping ErrPermissionDenied if a capability isn't
+// allowed for a resource. Builtins call it before they access a resource.
+func (vm *VM) Check(c Capability, resource string) error {
+	if vm.Allowed(c, resource) {
+		return nil
+	}
+	if resource == "" {
+		return fmt.Errorf("%w: needs %s", ErrPermissionDenied, c)
+	}
+	return fmt.Errorf("%w: needs %s for %q", ErrPermissionDenied, c, resource)
+}
+
+// checkCapabilities checks that a builtin is allowed to run.
+func (vm *VM) checkCapabilities(name string, b Builtin) error {
+	cb, ok := b.(CapabilityBuiltin)
+	if !ok {
+		return nil
+	}
+
+	for _, c := range cb.Capabilities() {
+		if !vm.Allowed(c, "") {
+			return fmt.Errorf("%w: %s() needs %s", ErrPermissionDenied, name, c)
+		}
+	}
+	return nil
+}
+
+// isInDir tests if a path is dir or inside it, after resolving symbolic links
+// so that they can't be used to escape from dir.
+func isInDir(path, dir string) bool {
+	path, err := resolvePath(path)
+	if err != nil {
+		return false
+	}
+	dir, err = resolvePath(dir)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path of a file without symbolic links. The
+// file doesn't have to exist, but its directory does.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, filepath.Base(path)), nil
+	}
+	return resolved, err
+}
@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilitiesAreDeniedByDefault(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	for _, code := range []string{
+		"CALL path/0\nCALL read_file/1",
+		"CALL path/0\nCALL path/0\nCALL write_file/2",
+		"CALL path/0\nCALL getenv/1",
+		"CALL now/0",
+		"CALL path/0\nCALL exec/1",
+	} {
+		vm.RegisterGoFunc("path", func() string { return "x" })
+
+		_, err := vm.Eval(assemble(t, code))
+		if assert.NotNil(t, err, code) {
+			assert.True(t, errors.Is(err, ErrPermissionDenied), code)
+		}
+	}
+
+	_, err := vm.Eval(assemble(t, "CALL now/0"))
+	assert.Equal(t, "Permission denied: now() needs clock", err.Error())
+
+	vm.Allow(CapClock)
+	v, err := vm.Eval(assemble(t, "CALL now/0"))
+	assert.Nil(t, err)
+	_, ok := v.(float64)
+	assert.True(t, ok)
+
+	vm.Deny(CapClock)
+	_, err = vm.Eval(assemble(t, "CALL now/0"))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
+
+func TestCapabilityBuiltins(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.Register("secret", WithCapabilities(NewBuiltin(0, func(args []Value) (Value, error) {
+		return int64(42), nil
+	}), CapEnv))
+
+	_, err := vm.Eval(assemble(t, "; 1\nCALL secret/0"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 1: Permission denied: secret() needs env", err.Error())
+	}
+
+	vm.Allow(CapEnv, "HOME")
+	v, err := vm.Eval(assemble(t, "CALL secret/0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), v)
+}
+
+func TestFileCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quinoa")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	assert.Nil(t, os.Mkdir(data, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(data, "in.txt"), []byte("hello"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644))
+	// a link can't be used to escape from the allowed directory
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(data, "link.txt")))
+
+	vm := NewVM(testing.Verbose())
+	vm.Allow(CapFSRead, data)
+	vm.Allow(CapFSWrite, filepath.Join(data, "out"))
+	assert.Nil(t, os.Mkdir(filepath.Join(data, "out"), 0755))
+
+	var path string
+	vm.RegisterGoFunc("path", func() string { return path })
+
+	path = filepath.Join(data, "in.txt")
+	v, err := vm.Eval(assemble(t, "CALL path/0\nCALL read_file/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", v)
+
+	for _, p := range []string{
+		filepath.Join(dir, "secret.txt"),
+		filepath.Join(data, "..", "secret.txt"),
+		filepath.Join(data, "link.txt"),
+	} {
+		path = p
+		_, err = vm.Eval(assemble(t, "CALL path/0\nCALL read_file/1"))
+		if assert.NotNil(t, err, p) {
+			assert.True(t, errors.Is(err, ErrPermissionDenied), p)
+		}
+	}
+
+	path = filepath.Join(data, "out", "new.txt")
+	_, err = vm.Eval(assemble(t, "CONST 42\nCALL path/0\nCALL write_file/2"))
+	assert.Nil(t, err)
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "42", string(content))
+
+	// reading the output directory is allowed because it's in data
+	v, err = vm.Eval(assemble(t, "CALL path/0\nCALL read_file/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "42", v)
+
+	path = filepath.Join(data, "in.txt")
+	_, err = vm.Eval(assemble(t, "CONST 1\nCALL path/0\nCALL write_file/2"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Permission denied: needs fs:write for \""+path+"\"", err.Error())
+	}
+
+	// files larger than the free heap aren't read entirely
+	vm.MaxHeapSize = 20
+	_, err = vm.Eval(assemble(t, "CALL path/0\nCALL read_file/1"))
+	assert.True(t, errors.Is(err, ErrOutOfMemory))
+}
+
+func TestEnvAndExecCapabilities(t *testing.T) {
+	os.Setenv("QUINOA_TEST", "yes")
+	defer os.Unsetenv("QUINOA_TEST")
+
+	vm := NewVM(testing.Verbose())
+	vm.Allow(CapEnv, "QUINOA_TEST")
+	vm.Allow(CapExec, "echo")
+
+	var name string
+	vm.RegisterGoFunc("name", func() string { return name })
+
+	name = "QUINOA_TEST"
+	v, err := vm.Eval(assemble(t, "CALL name/0\nCALL getenv/1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "yes", v)
+
+	name = "HOME"
+	_, err = vm.Eval(assemble(t, "CALL name/0\nCALL getenv/1"))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	name = "echo"
+	v, err = vm.Eval(assemble(t, "CONST 2\nCONST 1\nCALL name/0\nCALL exec/3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1 2\n", v)
+
+	name = "sh"
+	_, err = vm.Eval(assemble(t, "CALL name/0\nCALL exec/1"))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
+
+func TestExecOutputLimit(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.Allow(CapExec, "yes", "echo")
+	vm.MaxHeapSize = 1000
+	vm.MaxDuration = time.Minute
+	vm.RegisterGoFunc("yes", func() string { return "yes" })
+	vm.RegisterGoFunc("echo", func() string { return "echo" })
+
+	// the command never ends, it's stopped once its output is too large
+	start := time.Now()
+	_, err := vm.Eval(assemble(t, "CALL yes/0\nCALL exec/1"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrOutOfMemory))
+		assert.Equal(t, "Out of memory: the output of yes exceeds the 1000 bytes left in the heap", err.(*RuntimeError).Err.Error())
+	}
+	assert.True(t, time.Since(start) < 10*time.Second)
+
+	v, err := vm.Eval(assemble(t, "CONST 1\nCALL echo/0\nCALL exec/2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n", v)
+}
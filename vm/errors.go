@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// ErrStackOverflow is the cause of a RuntimeError when the code needs a stack
+// larger than VM.MaxStackSize.
+var ErrStackOverflow = errors.New("Stack overflow")
+
+// ErrBudgetExceeded is the cause of a RuntimeError when a run exceeds
+// VM.MaxInstructions or VM.MaxDuration.
+var ErrBudgetExceeded = errors.New("Budget exceeded")
+
+// ErrOutOfMemory is the cause of a RuntimeError when the code needs more
+// memory than VM.MaxHeapSize.
+var ErrOutOfMemory = errors.New("Out of memory")
+
+// ErrPermissionDenied is the cause of a RuntimeError when a builtin needs a
+// capability that the VM doesn't allow.
+var ErrPermissionDenied = errors.New("Permission denied")
+
+// A RuntimeError is an error that stopped the execution of the code. It
+// wraps the error that caused it.
+type RuntimeError struct {
+	Err error
+
+	// address and source line of the grain where the error occurred
+	PC   int
+	Line int
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func runtimeError(code language.Grains, pc int, err error) *RuntimeError {
+	return &RuntimeError{Err: err, PC: pc, Line: code[pc].Line}
+}
@@ -0,0 +1,317 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var (
+	valueType = reflect.TypeOf((*Value)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// WrapFunc returns a Builtin that calls an ordinary Go function. Its
+// arguments and result can be integers, floats, strings, bools, slices of
+// them, maps of them with string keys, Value and interface{}; ints are
+// converted to floats if needed. It can also return an error, as its only
+// result or after the other one; errors stop the program. A variadic
+// function takes any number of arguments.
+func WrapFunc(fn interface{}) (Builtin, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return nil, fmt.Errorf("Expected a function, got %T", fn)
+	}
+
+	t := f.Type()
+
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isConvertible(in) {
+			return nil, fmt.Errorf("Unsupported type %s for argument %d of %s", in, i+1, t)
+		}
+	}
+
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if out := t.Out(0); out != errorType && !isConvertible(out) {
+			return nil, fmt.Errorf("Unsupported result type %s of %s", out, t)
+		}
+	case 2:
+		if !isConvertible(t.Out(0)) || t.Out(1) != errorType {
+			return nil, fmt.Errorf("Unsupported result types of %s; expected a value and an error", t)
+		}
+	default:
+		return nil, fmt.Errorf("Too many results for %s", t)
+	}
+
+	return &goBuiltin{fn: f}, nil
+}
+
+// goBuiltin is a builtin that calls a Go function through reflection.
+type goBuiltin struct {
+	fn reflect.Value
+}
+
+func (b *goBuiltin) Arity() int {
+	t := b.fn.Type()
+	if t.IsVariadic() {
+		return -1
+	}
+	return t.NumIn()
+}
+
+func (b *goBuiltin) Call(_ *VM, args []Value) (Value, error) {
+	t := b.fn.Type()
+
+	if t.IsVariadic() && len(args) < t.NumIn()-1 {
+		return nil, fmt.Errorf("Expected at least %s, got %d", plural(t.NumIn()-1, "argument"), len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			argType = t.In(t.NumIn() - 1).Elem()
+		} else {
+			argType = t.In(i)
+		}
+
+		v, err := fromValue(arg, argType)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %d: %s", i+1, err)
+		}
+		in[i] = v
+	}
+
+	out := b.fn.Call(in)
+
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if err := out[n-1].Interface(); err != nil {
+			return nil, err.(error)
+		}
+		out = out[:n-1]
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	// a nil interface is the value 0, like a nil result of a Builtin
+	if out[0].Kind() == reflect.Interface && out[0].IsNil() {
+		return nil, nil
+	}
+
+	return toValue(out[0])
+}
+
+// isConvertible tests if Go values of type t can be converted from and to
+// values.
+func isConvertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return isConvertible(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && isConvertible(t.Elem())
+	case reflect.Interface:
+		return t == valueType || t.NumMethod() == 0
+	}
+	return false
+}
+
+// fromValue converts a value to a Go value of type t.
+func fromValue(v Value, t reflect.Type) (reflect.Value, error) {
+	rv := reflect.New(t).Elem()
+
+	mismatch := func() (reflect.Value, error) {
+		return rv, fmt.Errorf("Cannot use %s as %s", describe(v), t)
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := v.(int64)
+		if !ok || rv.OverflowInt(i) {
+			return mismatch()
+		}
+		rv.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := v.(int64)
+		if !ok || i < 0 || rv.OverflowUint(uint64(i)) {
+			return mismatch()
+		}
+		rv.SetUint(uint64(i))
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch v := v.(type) {
+		case int64:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			return mismatch()
+		}
+		if rv.OverflowFloat(f) {
+			return mismatch()
+		}
+		rv.SetFloat(f)
+
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		rv.SetString(s)
+
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+		rv.SetBool(b)
+
+	case reflect.Slice:
+		l, ok := v.([]Value)
+		if !ok {
+			return mismatch()
+		}
+		rv.Set(reflect.MakeSlice(t, len(l), len(l)))
+		for i, e := range l {
+			ev, err := fromValue(e, t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.Index(i).Set(ev)
+		}
+
+	case reflect.Map:
+		m, ok := v.(map[string]Value)
+		if !ok {
+			return mismatch()
+		}
+		rv.Set(reflect.MakeMapWithSize(t, len(m)))
+		for k, e := range m {
+			ev, err := fromValue(e, t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), ev)
+		}
+
+	case reflect.Interface:
+		if v != nil {
+			rv.Set(reflect.ValueOf(v))
+		}
+
+	default:
+		return mismatch()
+	}
+
+	return rv, nil
+}
+
+// toValue converts a Go value to a value.
+func toValue(rv reflect.Value) (Value, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows int", u)
+		}
+		return int64(u), nil
+
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+
+	case reflect.String:
+		return rv.String(), nil
+
+	case reflect.Bool:
+		return rv.Bool(), nil
+
+	case reflect.Slice:
+		l := make([]Value, rv.Len())
+		for i := range l {
+			e, err := toValue(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			l[i] = e
+		}
+		return l, nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, err := toValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[iter.Key().String()] = e
+		}
+		return m, nil
+
+	case reflect.Interface:
+		if rv.IsNil() {
+			return nil, errors.New("Cannot use nil as a value")
+		}
+		return toValue(rv.Elem())
+	}
+
+	return nil, fmt.Errorf("Cannot use a Go %s as a value", rv.Type())
+}
+
+// ToValue converts a Go value to a value. It supports the same types as the
+// arguments of the functions wrapped by WrapFunc.
+func ToValue(x interface{}) (Value, error) {
+	if x == nil {
+		return nil, errors.New("Cannot use nil as a value")
+	}
+	return toValue(reflect.ValueOf(x))
+}
+
+// FromValue converts a value to an int64, a float64, a string, a bool, an
+// []interface{} or a map[string]interface{}.
+func FromValue(v Value) interface{} {
+	switch v := v.(type) {
+	case []Value:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = FromValue(e)
+		}
+		return l
+	case map[string]Value:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = FromValue(e)
+		}
+		return m
+	}
+	return v
+}
+
+// describe returns a short description of a value for error messages.
+func describe(v Value) string {
+	switch v.(type) {
+	case []Value, map[string]Value:
+		return "a " + TypeName(v)
+	}
+	return Repr(v)
+}
@@ -0,0 +1,34 @@
+package vm
+
+import (
+	"sort"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// A Hook observes the execution of code, e.g. to debug or profile it. It's
+// called before every grain, so it must be fast.
+type Hook interface {
+	// Step is called before the execution of code[pc]. A returned error
+	// stops the run with a RuntimeError that wraps it.
+	Step(vm *VM, code language.Grains, pc int) error
+}
+
+// An EndHook is a Hook that is also told when a run ends.
+type EndHook interface {
+	Hook
+
+	// End is called when the run of code ends, even if it fails, but before
+	// the output is flushed.
+	End(vm *VM, code language.Grains)
+}
+
+// Variables returns the sorted names of the variables that have a value.
+func (vm *VM) Variables() []string {
+	names := make([]string, 0, len(vm.memory))
+	for name := range vm.memory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,68 @@
+package vm
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Output returns the buffered writer to Stdout. Builtins that write to
+// Stdout must use it so that their output is ordered with the rest.
+func (vm *VM) Output() io.Writer {
+	if vm.stdout == nil || vm.stdoutDst != vm.Stdout {
+		// the stream changed
+		vm.Flush()
+
+		dst := vm.Stdout
+		if dst == nil {
+			dst = ioutil.Discard
+		}
+		vm.stdout = bufio.NewWriter(dst)
+		vm.stdoutDst = vm.Stdout
+	}
+	return vm.stdout
+}
+
+// Flush writes the buffered output to Stdout.
+func (vm *VM) Flush() error {
+	if vm.stdout == nil {
+		return nil
+	}
+	return vm.stdout.Flush()
+}
+
+// Input returns the buffered reader of Stdin, after flushing the output so
+// that prompts are shown. Stdin is used as is if it's a *bufio.Reader, so
+// that a host can share it with the VM.
+func (vm *VM) Input() *bufio.Reader {
+	vm.Flush()
+
+	if vm.stdin == nil || vm.stdinSrc != vm.Stdin {
+		switch src := vm.Stdin.(type) {
+		case *bufio.Reader:
+			vm.stdin = src
+		case nil:
+			vm.stdin = bufio.NewReader(strings.NewReader(""))
+		default:
+			vm.stdin = bufio.NewReader(src)
+		}
+		vm.stdinSrc = vm.Stdin
+	}
+	return vm.stdin
+}
+
+// readLine reads a line from Stdin, without its line ending. It returns
+// io.EOF if the input is over.
+func (vm *VM) readLine() (string, error) {
+	line, err := vm.Input().ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
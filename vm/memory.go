@@ -0,0 +1,102 @@
+package vm
+
+import "fmt"
+
+// Stats are statistics about the executions of a VM.
+type Stats struct {
+	// Instructions is the number of grains, or of instructions of the
+	// register machine, executed.
+	Instructions int64
+
+	// Allocations is the number of strings, lists and maps created by the
+	// code and its builtins, and AllocatedBytes their total size.
+	Allocations    int64
+	AllocatedBytes int64
+
+	// HeapSize is the size of the values held by variables, and
+	// PeakHeapSize the maximum size of these values plus a new allocation.
+	HeapSize     int64
+	PeakHeapSize int64
+}
+
+// Stats returns the statistics of the VM since its creation.
+func (vm *VM) Stats() Stats {
+	return vm.stats
+}
+
+// Estimated sizes in bytes on 64-bit platforms. The sizes of values are
+// estimates and shared values are counted every time they're referenced, so
+// they're upper bounds rather than exact numbers.
+const (
+	interfaceSize   = 16
+	stringSize      = 16
+	sliceSize       = 24
+	mapSize         = 48
+	mapOverheadSize = 8 // per entry
+)
+
+// sizeOf returns the size of the memory a value references, which is zero
+// for ints, floats and bools.
+func sizeOf(v Value) int64 {
+	switch v := v.(type) {
+	case string:
+		return stringSize + int64(len(v))
+	case []Value:
+		size := int64(sliceSize + interfaceSize*len(v))
+		for _, e := range v {
+			size += sizeOf(e)
+		}
+		return size
+	case map[string]Value:
+		size := int64(mapSize)
+		for k, e := range v {
+			size += mapOverheadSize + stringSize + int64(len(k)) + interfaceSize + sizeOf(e)
+		}
+		return size
+	}
+	return 0
+}
+
+// alloc accounts for a value created by the code or a builtin. It fails with
+// ErrOutOfMemory if keeping it would exceed VM.MaxHeapSize.
+func (vm *VM) alloc(v Value) error {
+	size := sizeOf(v)
+	if size == 0 {
+		return nil
+	}
+
+	if err := vm.checkHeap(vm.stats.HeapSize + size); err != nil {
+		return err
+	}
+
+	vm.stats.Allocations++
+	vm.stats.AllocatedBytes += size
+	return nil
+}
+
+// store sets a variable, accounting for the memory it holds.
+func (vm *VM) store(name string, v Value) error {
+	heap := vm.stats.HeapSize - sizeOf(vm.memory[name]) + sizeOf(v)
+
+	// a program can always release memory
+	if heap > vm.stats.HeapSize {
+		if err := vm.checkHeap(heap); err != nil {
+			return err
+		}
+	}
+
+	vm.memory[name] = v
+	vm.stats.HeapSize = heap
+	return nil
+}
+
+func (vm *VM) checkHeap(size int64) error {
+	if vm.MaxHeapSize > 0 && size > vm.MaxHeapSize {
+		return fmt.Errorf("%w: the heap would grow to %d bytes, the limit is %d", ErrOutOfMemory, size, vm.MaxHeapSize)
+	}
+
+	if size > vm.stats.PeakHeapSize {
+		vm.stats.PeakHeapSize = size
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	assert.Nil(t, vm.RegisterGoFunc("abc", func() string { return "abc" }))
+
+	assert.Equal(t, Stats{}, vm.Stats())
+
+	assert.Nil(t, vm.Run(assemble(t, "CALL abc/0\nSTORE a\nDISCARD")))
+	assert.Equal(t, Stats{
+		Instructions:   3,
+		Allocations:    1,
+		AllocatedBytes: 19,
+		HeapSize:       19,
+		PeakHeapSize:   19,
+	}, vm.Stats())
+
+	assert.Nil(t, vm.Run(assemble(t, "LOAD a\nLOAD a\nADD\nSTORE b\nDISCARD\nCONST 1\nSTORE a\nDISCARD")))
+	assert.Equal(t, Stats{
+		Instructions:   11,
+		Allocations:    2,
+		AllocatedBytes: 19 + 22,
+		HeapSize:       22,
+		PeakHeapSize:   19 + 22,
+	}, vm.Stats())
+
+	vm.Set("l", []Value{"ab", int64(1)})
+	assert.Equal(t, int64(22+24+2*16+18), vm.Stats().HeapSize)
+
+	vm.Reset()
+	assert.Equal(t, int64(0), vm.Stats().HeapSize)
+	assert.Equal(t, int64(11), vm.Stats().Instructions)
+}
+
+func TestSizeOf(t *testing.T) {
+	assert.Equal(t, int64(0), sizeOf(int64(1)))
+	assert.Equal(t, int64(0), sizeOf(true))
+	assert.Equal(t, int64(20), sizeOf("abcd"))
+	assert.Equal(t, int64(24), sizeOf([]Value{}))
+	assert.Equal(t, int64(24+16+16+17), sizeOf([]Value{int64(1), "a"}))
+	assert.Equal(t, int64(48+8+17+16+24), sizeOf(map[string]Value{"k": []Value{}}))
+}
+
+func TestOutOfMemory(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.MaxHeapSize = 100
+	assert.Nil(t, vm.RegisterGoFunc("s", func() string { return strings.Repeat("x", 50) }))
+
+	assert.Nil(t, vm.Run(assemble(t, "CALL s/0\nSTORE a\nDISCARD")))
+
+	err := vm.Run(assemble(t, "; 2\nCALL s/0\nSTORE b\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrOutOfMemory))
+		assert.Equal(t, "line 2: Out of memory: the heap would grow to 132 bytes, the limit is 100", err.Error())
+		assert.Equal(t, 0, err.(*RuntimeError).PC)
+	}
+
+	err = vm.Run(assemble(t, "LOAD a\nLOAD a\nADD\nDISCARD"))
+	assert.True(t, errors.Is(err, ErrOutOfMemory))
+
+	// memory can be released, then reused
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nSTORE a\nDISCARD\nCALL s/0\nSTORE b\nDISCARD")))
+	assert.Equal(t, int64(66), vm.Stats().HeapSize)
+}
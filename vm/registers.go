@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/bfontaine/quinoa/language"
+)
+
+// RunRegisters verifies then executes code of the register machine. It shares
+// the memory, the builtins, the streams and the limits of the VM, except
+// MaxStackSize: the registers are allocated by the compiler.
+func (vm *VM) RunRegisters(code *language.RegCode) error {
+	return vm.RunRegistersContext(context.Background(), code)
+}
+
+// RunRegistersContext is like RunRegisters, with the context of RunContext.
+// Hooks aren't supported.
+func (vm *VM) RunRegistersContext(ctx context.Context, code *language.RegCode) error {
+	if vm.Hook != nil {
+		return errors.New("Hooks aren't supported by the register machine")
+	}
+
+	if err := code.Verify(); err != nil {
+		return err
+	}
+
+	prev := vm.ctx
+	vm.ctx = ctx
+	err := vm.runRegisters(ctx, code)
+	vm.ctx = prev
+
+	if ferr := vm.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func registerError(code *language.RegCode, pc int, err error) *RuntimeError {
+	return &RuntimeError{Err: err, PC: pc, Line: code.Instrs[pc].Line}
+}
+
+func (vm *VM) runRegisters(ctx context.Context, code *language.RegCode) error {
+	b := vm.budget(ctx)
+	defer func() { vm.stats.Instructions += b.steps }()
+
+	regs := make([]Value, code.NumRegs)
+
+	for pc, inst := range code.Instrs {
+		if err := b.step(); err != nil {
+			return registerError(code, pc, err)
+		}
+
+		if vm.Debug {
+			log.Printf("vm.next_inst: %04d  %s\nvm.registers: %+v\nvm.memory: %+v\n", pc, inst, regs, vm.memory)
+		}
+
+		switch inst.OpCode {
+		case language.RegConstOpCode:
+			regs[inst.Dst] = inst.Value
+
+		case language.RegLoadOpCode:
+			v, ok := vm.memory[inst.Name]
+			if !ok {
+				// variables are 0 until they're assigned
+				v = int64(0)
+			}
+			regs[inst.Dst] = v
+
+		case language.RegStoreOpCode:
+			if err := vm.store(inst.Name, regs[inst.Args[0]]); err != nil {
+				return registerError(code, pc, err)
+			}
+
+		case language.RegAddOpCode, language.RegAddConstOpCode:
+			var right Value = inst.Value
+			if inst.OpCode == language.RegAddOpCode {
+				right = regs[inst.Args[1]]
+			}
+
+			v, err := add(regs[inst.Args[0]], right)
+			if err == nil {
+				err = vm.alloc(v)
+			}
+			if err != nil {
+				return registerError(code, pc, err)
+			}
+			regs[inst.Dst] = v
+
+		case language.RegCallOpCode:
+			args := make([]Value, len(inst.Args))
+			for i, r := range inst.Args {
+				args[i] = regs[r]
+			}
+
+			ret, err := vm.call(inst.Name, args)
+			if err == nil {
+				err = vm.alloc(ret)
+			}
+			if err != nil {
+				return registerError(code, pc, err)
+			}
+			regs[inst.Dst] = ret
+		}
+	}
+
+	return nil
+}
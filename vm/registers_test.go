@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/stretchr/testify/assert"
+)
+
+// a = x + 1; print(a + "1")
+var regCode = &language.RegCode{
+	Instrs: []language.RegInstr{
+		{OpCode: language.RegLoadOpCode, Dst: 0, Name: "x", Line: 1},
+		{OpCode: language.RegAddConstOpCode, Dst: 0, Args: []int{0}, Value: 1, Line: 1},
+		{OpCode: language.RegStoreOpCode, Name: "a", Args: []int{0}, Line: 1},
+		{OpCode: language.RegLoadOpCode, Dst: 1, Name: "s", Line: 2},
+		{OpCode: language.RegAddOpCode, Dst: 1, Args: []int{0, 1}, Line: 2},
+		{OpCode: language.RegCallOpCode, Dst: 1, Name: "print", Args: []int{1, 0}, Line: 2},
+	},
+	NumRegs: 2,
+}
+
+func TestRunRegisters(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	var out bytes.Buffer
+	vm.Stdout = &out
+
+	vm.Set("s", int64(2))
+	assert.Nil(t, vm.RunRegisters(regCode))
+	assert.Equal(t, "3 1\n", out.String())
+	v, _ := vm.Get("a")
+	assert.Equal(t, int64(1), v)
+	assert.Equal(t, int64(6), vm.Stats().Instructions)
+
+	// the memory is kept between runs
+	vm.Set("x", int64(10))
+	assert.Nil(t, vm.RunRegisters(regCode))
+	assert.Equal(t, "3 1\n13 11\n", out.String())
+}
+
+func TestRunRegistersErrors(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.Stdout = nil
+
+	vm.Set("s", "str")
+	err := vm.RunRegisters(regCode)
+	var rerr *RuntimeError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, 4, rerr.PC)
+		assert.Equal(t, "line 2: Cannot add int and string", rerr.Error())
+	}
+	// the store happened before
+	v, _ := vm.Get("a")
+	assert.Equal(t, int64(1), v)
+
+	vm.MaxInstructions = 3
+	err = vm.RunRegisters(regCode)
+	assert.True(t, errors.Is(err, ErrBudgetExceeded))
+	vm.MaxInstructions = 0
+
+	// invalid code isn't executed
+	err = vm.RunRegisters(&language.RegCode{Instrs: regCode.Instrs[2:], NumRegs: 2})
+	assert.NotNil(t, err)
+	v, _ = vm.Get("a")
+	assert.Equal(t, int64(1), v)
+
+	vm.Hook = hookFunc(func(vm *VM, code language.Grains, pc int) error { return nil })
+	assert.NotNil(t, vm.RunRegisters(regCode))
+}
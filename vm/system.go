@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Builtins that access the system. They need capabilities.
+
+func init() {
+	Register("read_file", WithCapabilities(&vmBuiltin{1, builtinReadFile}, CapFSRead))
+	Register("write_file", WithCapabilities(&vmBuiltin{2, builtinWriteFile}, CapFSWrite))
+	Register("getenv", WithCapabilities(&vmBuiltin{1, builtinGetenv}, CapEnv))
+	Register("now", WithCapabilities(&vmBuiltin{0, builtinNow}, CapClock))
+	Register("exec", WithCapabilities(&vmBuiltin{-1, builtinExec}, CapExec))
+}
+
+// stringArg returns the i-th argument of a builtin, which must be a string.
+func stringArg(name string, args []Value, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s() takes a string as argument %d, got %s", name, i+1, TypeName(args[i]))
+	}
+	return s, nil
+}
+
+// read_file(path) returns the content of a file.
+func builtinReadFile(vm *VM, args []Value) (Value, error) {
+	path, err := stringArg("read_file", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.Check(CapFSRead, path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if vm.MaxHeapSize > 0 {
+		// don't read more than what the heap can hold
+		r = io.LimitReader(f, vm.MaxHeapSize-vm.stats.HeapSize+1)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(content), nil
+}
+
+// write_file(path, content) writes the content to a file, replacing it if
+// it exists.
+func builtinWriteFile(vm *VM, args []Value) (Value, error) {
+	path, err := stringArg("write_file", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.Check(CapFSWrite, path); err != nil {
+		return nil, err
+	}
+
+	return nil, ioutil.WriteFile(path, []byte(Format(args[1])), 0644)
+}
+
+// getenv(name) returns the value of an environment variable, or "" if it
+// isn't set.
+func builtinGetenv(vm *VM, args []Value) (Value, error) {
+	name, err := stringArg("getenv", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.Check(CapEnv, name); err != nil {
+		return nil, err
+	}
+
+	return os.Getenv(name), nil
+}
+
+// now() returns the current time in seconds since the Unix epoch.
+func builtinNow(vm *VM, args []Value) (Value, error) {
+	return float64(time.Now().UnixNano()) / float64(time.Second), nil
+}
+
+// exec(command, args...) runs a command and returns its standard output. It
+// fails if the command fails.
+func builtinExec(vm *VM, args []Value) (Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("exec() takes at least 1 argument, got 0")
+	}
+
+	name, err := stringArg("exec", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := vm.Check(CapExec, name); err != nil {
+		return nil, err
+	}
+
+	cmdArgs := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		cmdArgs[i] = Format(arg)
+	}
+
+	ctx, cancel := context.WithCancel(vm.Context())
+	defer cancel()
+
+	// the command is stopped when its output doesn't fit in the heap
+	stdout := &limitedBuffer{max: -1, full: cancel}
+	if vm.MaxHeapSize > 0 {
+		stdout.max = vm.MaxHeapSize - vm.stats.HeapSize
+	}
+	stderr := &limitedBuffer{max: maxExecStderr}
+
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	if stdout.exceeded {
+		return nil, fmt.Errorf("%w: the output of %s exceeds the %d bytes left in the heap", ErrOutOfMemory, name, stdout.max)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	return stdout.String(), nil
+}
+
+// maximum size of the standard error of the commands run by exec(), which is
+// only used in error messages
+const maxExecStderr = 64 << 10
+
+// limitedBuffer is a buffer that keeps the first max bytes written to it, or
+// all of them if max is negative. It calls full, if any, when more are
+// written, and discards them.
+type limitedBuffer struct {
+	// not embedded, so that io.Copy can't bypass Write with ReadFrom
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+	full     func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	left := b.max - int64(b.buf.Len())
+	if b.max < 0 || int64(len(p)) <= left {
+		return b.buf.Write(p)
+	}
+
+	if left > 0 {
+		b.buf.Write(p[:left])
+	}
+	if !b.exceeded {
+		b.exceeded = true
+		if b.full != nil {
+			b.full()
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string { return b.buf.String() }
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Value is a value manipulated by programs. It's one of int64, float64,
+// string, bool, []Value and map[string]Value.
+type Value interface{}
+
+// TypeName returns the name of the type of a value in the language.
+func TypeName(v Value) string {
+	switch v.(type) {
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []Value:
+		return "list"
+	case map[string]Value:
+		return "map"
+	}
+	return fmt.Sprintf("invalid(%T)", v)
+}
+
+// Format returns the textual representation of a value, as printed by
+// print().
+func Format(v Value) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return Repr(v)
+}
+
+// Repr is like Format, except that strings are quoted.
+func Repr(v Value) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []Value:
+		elements := make([]string, len(v))
+		for i, e := range v {
+			elements[i] = Repr(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]Value:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = strconv.Quote(k) + ": " + Repr(v[k])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return TypeName(v)
+}
+
+// isValue tests if v is a valid value, including its elements.
+func isValue(v Value) bool {
+	switch v := v.(type) {
+	case int64, float64, string, bool:
+		return true
+	case []Value:
+		for _, e := range v {
+			if !isValue(e) {
+				return false
+			}
+		}
+		return true
+	case map[string]Value:
+		for _, e := range v {
+			if !isValue(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// add implements the + operator.
+func add(a, b Value) (Value, error) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return a + b, nil
+		case float64:
+			return float64(a) + b, nil
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return a + float64(b), nil
+		case float64:
+			return a + b, nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return a + b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot add %s and %s", TypeName(a), TypeName(b))
+}
@@ -1,27 +1,81 @@
 package vm
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"time"
 
 	"github.com/bfontaine/quinoa/language"
 )
 
-type Value int64
+// DefaultMaxStackSize is the default value of VM.MaxStackSize.
+const DefaultMaxStackSize = 1 << 16
 
 type VM struct {
 	memory map[string]Value
 	stack  []Value
-	top    uint8
+	top    int
+
+	// builtins registered for this VM only
+	builtins map[string]Builtin
+
+	// allowed capabilities
+	caps map[Capability]*grant
+
+	// context of the current run
+	ctx context.Context
+
+	stats Stats
+
+	// Args are the command-line arguments of the program.
+	Args []string
+
+	// Standard streams of the programs. Nil streams are empty or discard
+	// their output. The output to Stdout is buffered; see Output.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// buffers of Stdin and Stdout, and the streams they were created for
+	stdin     *bufio.Reader
+	stdinSrc  io.Reader
+	stdout    *bufio.Writer
+	stdoutDst io.Writer
+
+	// MaxStackSize is the maximum number of values on the stack. Running
+	// code that needs more fails with ErrStackOverflow.
+	MaxStackSize int
+
+	// MaxInstructions is the maximum number of grains executed by a run, and
+	// MaxDuration its maximum duration. Runs that exceed them fail with
+	// ErrBudgetExceeded. Zero means no limit.
+	MaxInstructions int64
+	MaxDuration     time.Duration
+
+	// MaxHeapSize is the maximum size in bytes of the values held by
+	// variables, including new ones. Exceeding it fails with ErrOutOfMemory.
+	// Zero means no limit.
+	MaxHeapSize int64
+
+	// Hook, if any, is called before the execution of every grain.
+	Hook Hook
 
 	Debug bool
 }
 
 func NewVM(debug bool) *VM {
 	return &VM{
-		memory: make(map[string]Value),
-		stack:  make([]Value, 20), // small stack
-		Debug:  debug,
+		memory:       make(map[string]Value),
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+		Stderr:       os.Stderr,
+		MaxStackSize: DefaultMaxStackSize,
+		Debug:        debug,
 	}
 }
 
@@ -37,10 +91,183 @@ func (vm *VM) peek() Value {
 	return vm.stack[vm.top-1]
 }
 
+// Run verifies then executes the code. The memory is kept between runs.
 func (vm *VM) Run(code language.Grains) error {
-	for _, inst := range code {
+	return vm.RunContext(context.Background(), code)
+}
+
+// RunContext is like Run, but stops with an error wrapping ctx.Err() when the
+// context is done. The output is flushed at the end, even if it fails.
+func (vm *VM) RunContext(ctx context.Context, code language.Grains) error {
+	top := vm.top
+
+	v, err := language.Verify(code)
+	if err != nil {
+		return err
+	}
+
+	if err := vm.reserveStack(code, v); err != nil {
+		return err
+	}
+
+	// hooks can run code while the VM is running
+	prev := vm.ctx
+	vm.ctx = ctx
+	err = vm.run(ctx, code)
+	vm.ctx = prev
+
+	if h, ok := vm.Hook.(EndHook); ok {
+		h.End(vm, code)
+	}
+
+	if err != nil {
+		// leave the stack as we found it
+		vm.top = top
+	}
+
+	if ferr := vm.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// reserveStack grows the stack so that it can hold the values the code
+// pushes, as computed by its verification.
+func (vm *VM) reserveStack(code language.Grains, v *language.Verification) error {
+	size := vm.top + v.MaxDepth
+
+	if size > vm.MaxStackSize {
+		// report the first grain that overflows
+		for pc, depth := range v.Depths[1:] {
+			if vm.top+depth > vm.MaxStackSize {
+				return runtimeError(code, pc, fmt.Errorf("%w: the code needs %d values on the stack, the limit is %d",
+					ErrStackOverflow, size, vm.MaxStackSize))
+			}
+		}
+	}
+
+	if size > len(vm.stack) {
+		stack := make([]Value, size)
+		copy(stack, vm.stack[:vm.top])
+		vm.stack = stack
+	}
+
+	return nil
+}
+
+// Eval executes code that leaves one value on the stack, such as an
+// expression, and returns that value.
+func (vm *VM) Eval(code language.Grains) (Value, error) {
+	return vm.EvalContext(context.Background(), code)
+}
+
+// EvalContext is like Eval, with the context of RunContext.
+func (vm *VM) EvalContext(ctx context.Context, code language.Grains) (Value, error) {
+	top := vm.top
+
+	if err := vm.RunContext(ctx, code); err != nil {
+		return nil, err
+	}
+
+	if vm.top != top+1 {
+		vm.top = top
+		return nil, errors.New("The code didn't produce a value")
+	}
+
+	return vm.pop(), nil
+}
+
+// Context returns the context of the current run, for builtins.
+func (vm *VM) Context() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+// Get returns the value of a variable.
+func (vm *VM) Get(name string) (Value, bool) {
+	v, ok := vm.memory[name]
+	return v, ok
+}
+
+// Set sets the value of a variable. Its size counts in the heap, but isn't
+// checked against MaxHeapSize.
+func (vm *VM) Set(name string, v Value) {
+	vm.stats.HeapSize += sizeOf(v) - sizeOf(vm.memory[name])
+	if vm.stats.HeapSize > vm.stats.PeakHeapSize {
+		vm.stats.PeakHeapSize = vm.stats.HeapSize
+	}
+	vm.memory[name] = v
+}
+
+// Reset clears the memory of the VM.
+func (vm *VM) Reset() {
+	vm.memory = make(map[string]Value)
+	vm.top = 0
+	vm.stats.HeapSize = 0
+}
+
+// number of instructions executed between two checks of the context and the
+// deadline
+const checkInterval = 1024
+
+// A budget checks the limits of a run.
+type budget struct {
+	ctx      context.Context
+	max      int64
+	deadline time.Time
+	duration time.Duration
+	steps    int64
+}
+
+func (vm *VM) budget(ctx context.Context) *budget {
+	b := &budget{ctx: ctx, max: vm.MaxInstructions, duration: vm.MaxDuration}
+	if b.duration > 0 {
+		b.deadline = time.Now().Add(b.duration)
+	}
+	return b
+}
+
+// step counts an instruction, or returns why it can't be executed.
+func (b *budget) step() error {
+	if b.max > 0 && b.steps >= b.max {
+		return fmt.Errorf("%w: executed %d instructions", ErrBudgetExceeded, b.steps)
+	}
+
+	if b.steps%checkInterval == 0 {
+		select {
+		case <-b.ctx.Done():
+			return b.ctx.Err()
+		default:
+		}
+
+		if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+			return fmt.Errorf("%w: ran for more than %s", ErrBudgetExceeded, b.duration)
+		}
+	}
+
+	b.steps++
+	return nil
+}
+
+func (vm *VM) run(ctx context.Context, code language.Grains) error {
+	b := vm.budget(ctx)
+	defer func() { vm.stats.Instructions += b.steps }()
+
+	for pc, inst := range code {
+		if err := b.step(); err != nil {
+			return runtimeError(code, pc, err)
+		}
+
+		if vm.Hook != nil {
+			if err := vm.Hook.Step(vm, code, pc); err != nil {
+				return runtimeError(code, pc, err)
+			}
+		}
+
 		if vm.Debug {
-			log.Printf("vm.next_inst: %+v\nvm.memory: %+v\n", inst, vm.memory)
+			log.Printf("vm.next_inst: %04d  %s\nvm.memory: %+v\n", pc, inst, vm.memory)
 		}
 
 		switch inst.OpCode {
@@ -48,37 +275,83 @@ func (vm *VM) Run(code language.Grains) error {
 			vm.top--
 
 		case language.StoreOpCode:
-			vm.memory[inst.Name] = vm.peek()
+			if err := vm.store(inst.Name, vm.peek()); err != nil {
+				return runtimeError(code, pc, err)
+			}
 
 		case language.LoadOpCode:
-			vm.push(vm.memory[inst.Name])
+			v, ok := vm.memory[inst.Name]
+			if !ok {
+				// variables are 0 until they're assigned
+				v = int64(0)
+			}
+			vm.push(v)
 
 		case language.ConstOpCode:
-			vm.push(Value(inst.Value))
+			vm.push(inst.Value)
 
 		case language.AddOpCode:
 			switch inst.Name {
 			case "+":
 				e1 := vm.pop()
 				e2 := vm.pop()
-				vm.push(e1 + e2)
+				v, err := add(e1, e2)
+				if err == nil {
+					err = vm.alloc(v)
+				}
+				if err != nil {
+					return runtimeError(code, pc, err)
+				}
+				vm.push(v)
 			}
 
 		case language.CallOpCode:
-			args := make([]interface{}, 0, inst.PopN)
+			args := make([]Value, inst.PopN)
 
-			for i := 0; i < inst.PopN; i++ {
-				args = append(args, interface{}(vm.pop()))
+			for i := range args {
+				args[i] = vm.pop()
 			}
 
-			switch inst.Name {
-			case "print":
-				fmt.Println(args...)
-			default:
-				return fmt.Errorf("Unknown function '%s'", inst.Name)
+			ret, err := vm.call(inst.Name, args)
+			if err == nil {
+				err = vm.alloc(ret)
+			}
+			if err != nil {
+				return runtimeError(code, pc, err)
+			}
+
+			vm.push(ret)
+
+		case language.StorePopOpCode:
+			if err := vm.store(inst.Name, vm.pop()); err != nil {
+				return runtimeError(code, pc, err)
 			}
 
-			vm.push(0)
+		case language.AddConstOpCode:
+			v, err := add(vm.pop(), inst.Value)
+			if err == nil {
+				err = vm.alloc(v)
+			}
+			if err != nil {
+				return runtimeError(code, pc, err)
+			}
+			vm.push(v)
+
+		case language.IncLocalOpCode:
+			v, ok := vm.memory[inst.Name]
+			if !ok {
+				v = int64(0)
+			}
+			v, err := add(v, inst.Value)
+			if err == nil {
+				err = vm.alloc(v)
+			}
+			if err == nil {
+				err = vm.store(inst.Name, v)
+			}
+			if err != nil {
+				return runtimeError(code, pc, err)
+			}
 		}
 	}
 
@@ -0,0 +1,235 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfontaine/quinoa/language"
+	"github.com/stretchr/testify/assert"
+)
+
+func assemble(t *testing.T, code string) language.Grains {
+	gs, err := language.Assemble(code)
+	assert.Nil(t, err)
+	return gs
+}
+
+func TestRunRejectsInvalidGrains(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	for _, code := range []string{
+		"DISCARD",
+		"CONST 1\nCALL print/2",
+		"CONST 1\nADD",
+	} {
+		err := vm.Run(assemble(t, code))
+		assert.NotNil(t, err, code)
+		_, ok := err.(*language.VerifyError)
+		assert.True(t, ok, code)
+	}
+
+	// nothing is executed, even the valid grains at the beginning
+	assert.NotNil(t, vm.Run(assemble(t, "CONST 5\nSTORE a\nDISCARD\nDISCARD")))
+
+	v, err := vm.Eval(assemble(t, "LOAD a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), v)
+}
+
+func TestRunGrowsTheStack(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.RegisterFunc("count", -1, func(args []Value) (Value, error) {
+		return int64(len(args)), nil
+	})
+
+	code := ""
+	for i := 0; i < 100; i++ {
+		code += "CONST 1\n"
+	}
+	code += "CALL count/100\nSTORE a\nDISCARD"
+	assert.Nil(t, vm.Run(assemble(t, code)))
+
+	// the stack is empty after the run
+	v, err := vm.Eval(assemble(t, "LOAD a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), v)
+}
+
+func TestRunStackOverflow(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.MaxStackSize = 3
+	vm.RegisterFunc("count", -1, func(args []Value) (Value, error) {
+		return int64(len(args)), nil
+	})
+
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nCONST 1\nCONST 1\nCALL count/3\nDISCARD")))
+
+	err := vm.Run(assemble(t, "; 1\nCONST 1\nCONST 1\nDISCARD\nDISCARD\n; 2\nCONST 1\nCONST 1\n; 3\nCONST 1\nCONST 1\nCALL count/4\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrStackOverflow))
+		assert.Equal(t, "line 3: Stack overflow: the code needs 4 values on the stack, the limit is 3", err.Error())
+		assert.Equal(t, 7, err.(*RuntimeError).PC)
+	}
+}
+
+func TestRun(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	assert.Nil(t, vm.Run(assemble(t, "CONST 2\nCONST 1\nADD\nSTORE a\nDISCARD")))
+
+	v, err := vm.Eval(assemble(t, "LOAD a\nLOAD a\nADD"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), v)
+}
+
+func TestRunSuperinstructions(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	// a = 1; a = a + 2; b = a + 3; c = c + 4
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nSTOREPOP a\nINCLOCAL a 2\nLOAD a\nADDCONST 3\nSTOREPOP b\nINCLOCAL c 4")))
+	assert.Equal(t, 0, vm.top)
+	for name, expected := range map[string]int64{"a": 3, "b": 6, "c": 4} {
+		v, _ := vm.Get(name)
+		assert.Equal(t, expected, v, name)
+	}
+
+	// the constant is on the right
+	vm.Set("s", "x")
+	err := vm.Run(assemble(t, "LOAD s\nADDCONST 1\nSTOREPOP s"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Cannot add string and int", err.(*RuntimeError).Err.Error())
+	}
+	err = vm.Run(assemble(t, "INCLOCAL s 1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Cannot add string and int", err.(*RuntimeError).Err.Error())
+	}
+	v, _ := vm.Get("s")
+	assert.Equal(t, "x", v)
+}
+
+func TestRunInstructionBudget(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.MaxInstructions = 4
+
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nSTORE a\nDISCARD")))
+	// the budget is per run
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nSTORE b\nDISCARD")))
+
+	err := vm.Run(assemble(t, "; 1\nCONST 1\nSTORE c\nDISCARD\n; 2\nCONST 2\nSTORE c\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrBudgetExceeded))
+		assert.Equal(t, "line 2: Budget exceeded: executed 4 instructions", err.Error())
+		assert.Equal(t, 4, err.(*RuntimeError).PC)
+	}
+
+	v, err := vm.Eval(assemble(t, "LOAD c"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), v, "the execution stopped before the second STORE")
+}
+
+// longCode returns code that calls f() then executes many grains.
+func longCode(t *testing.T) language.Grains {
+	return assemble(t, "CALL f/0\nDISCARD\n"+strings.Repeat("CONST 1\nDISCARD\n", 2*checkInterval))
+}
+
+func TestRunDuration(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	vm.MaxDuration = time.Millisecond
+	vm.RegisterFunc("f", 0, func(args []Value) (Value, error) {
+		time.Sleep(5 * time.Millisecond)
+		return nil, nil
+	})
+
+	err := vm.Run(longCode(t))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, ErrBudgetExceeded))
+		assert.Equal(t, "Budget exceeded: ran for more than 1ms", err.Error())
+		assert.Equal(t, checkInterval, err.(*RuntimeError).PC)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vm.RegisterFunc("f", 0, func(args []Value) (Value, error) {
+		cancel()
+		return nil, nil
+	})
+
+	err := vm.RunContext(ctx, longCode(t))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, checkInterval, err.(*RuntimeError).PC)
+	}
+
+	// a done context stops the code before it starts
+	_, err = vm.EvalContext(ctx, assemble(t, "; 1\nCONST 1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "line 1: context canceled", err.Error())
+	}
+}
+
+type hookFunc func(vm *VM, code language.Grains, pc int) error
+
+func (f hookFunc) Step(vm *VM, code language.Grains, pc int) error {
+	return f(vm, code, pc)
+}
+
+func TestHook(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+
+	var pcs []int
+	errStop := errors.New("Stop")
+
+	vm.Hook = hookFunc(func(vm *VM, code language.Grains, pc int) error {
+		pcs = append(pcs, pc)
+		if code[pc].OpCode == language.DiscardOpCode {
+			return errStop
+		}
+		return nil
+	})
+
+	err := vm.Run(assemble(t, "; 2\nCONST 1\nSTORE a\nDISCARD"))
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.Is(err, errStop))
+		assert.Equal(t, "line 2: Stop", err.Error())
+	}
+	assert.Equal(t, []int{0, 1, 2}, pcs)
+	assert.Equal(t, []string{"a"}, vm.Variables())
+}
+
+type endHook struct {
+	steps  int
+	output []string
+}
+
+func (h *endHook) Step(vm *VM, code language.Grains, pc int) error {
+	h.steps++
+	return nil
+}
+
+func (h *endHook) End(vm *VM, code language.Grains) {
+	h.output = append(h.output, vm.Stdout.(*bytes.Buffer).String())
+}
+
+func TestEndHook(t *testing.T) {
+	vm := NewVM(testing.Verbose())
+	var out bytes.Buffer
+	vm.Stdout = &out
+
+	h := &endHook{}
+	vm.Hook = h
+
+	assert.Nil(t, vm.Run(assemble(t, "CONST 1\nCALL print/1\nDISCARD")))
+	assert.NotNil(t, vm.Run(assemble(t, "CONST 2\nCALL print/1\nCALL fail/0")))
+
+	// the output isn't flushed yet
+	assert.Equal(t, 6, h.steps)
+	assert.Equal(t, []string{"", "1\n"}, h.output)
+	assert.Equal(t, "1\n2\n", out.String())
+}